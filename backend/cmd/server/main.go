@@ -6,11 +6,17 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/prathyushnallamothu/startit/backend/internal/ai"
 	"github.com/prathyushnallamothu/startit/backend/internal/api"
+	"github.com/prathyushnallamothu/startit/backend/internal/executor"
+	"github.com/prathyushnallamothu/startit/backend/internal/git"
+	"github.com/prathyushnallamothu/startit/backend/internal/logging"
 )
 
 func main() {
@@ -19,12 +25,108 @@ func main() {
 		log.Println("Warning: No .env file found or error loading .env file. Using system environment variables.")
 	}
 
+	// Optionally change how verbose logging is; command output is only logged at debug level
+	if logLevel := os.Getenv("LOG_LEVEL"); logLevel != "" {
+		if level, err := logging.ParseLevel(logLevel); err == nil {
+			logging.SetLevel(level)
+		} else {
+			log.Printf("Warning: Invalid LOG_LEVEL %q, using info", logLevel)
+		}
+	}
+
 	// Get the port from environment variable or use default
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
+	// Optionally override the per-command output size limit
+	if maxOutput := os.Getenv("MAX_OUTPUT_BYTES"); maxOutput != "" {
+		if n, err := strconv.Atoi(maxOutput); err == nil {
+			executor.DefaultMaxOutputBytes = n
+		} else {
+			log.Printf("Warning: Invalid MAX_OUTPUT_BYTES %q, using default of %d", maxOutput, executor.DefaultMaxOutputBytes)
+		}
+	}
+
+	// Optionally override how many background commands may run at once
+	if maxConcurrent := os.Getenv("MAX_CONCURRENT_COMMANDS"); maxConcurrent != "" {
+		if n, err := strconv.Atoi(maxConcurrent); err == nil && n > 0 {
+			executor.DefaultMaxConcurrentCommands = n
+		} else {
+			log.Printf("Warning: Invalid MAX_CONCURRENT_COMMANDS %q, using default of %d", maxConcurrent, executor.DefaultMaxConcurrentCommands)
+		}
+	}
+
+	// Optionally batch streamed output lines instead of delivering them one at a time
+	if batchWindow := os.Getenv("OUTPUT_BATCH_WINDOW_MS"); batchWindow != "" {
+		if n, err := strconv.Atoi(batchWindow); err == nil && n >= 0 {
+			executor.OutputBatchWindow = time.Duration(n) * time.Millisecond
+		} else {
+			log.Printf("Warning: Invalid OUTPUT_BATCH_WINDOW_MS %q, streaming output line by line", batchWindow)
+		}
+	}
+
+	// Optionally keep clones on a dedicated volume instead of the system temp directory
+	if workDir := os.Getenv("STARTIT_WORKDIR"); workDir != "" {
+		if err := api.SetWorkDir(workDir); err != nil {
+			log.Fatalf("Invalid STARTIT_WORKDIR: %v", err)
+		}
+		log.Printf("Cloning repositories under %s", workDir)
+	}
+
+	// Optionally send all clone and remote traffic through a proxy, overriding HTTPS_PROXY for git
+	if proxy := os.Getenv("GIT_PROXY"); proxy != "" {
+		if err := git.ValidateProxyURL(proxy); err != nil {
+			log.Fatalf("Invalid GIT_PROXY: %v", err)
+		}
+	}
+
+	// Optionally change how many times clones that hit network errors are attempted
+	if cloneAttempts := os.Getenv("CLONE_MAX_ATTEMPTS"); cloneAttempts != "" {
+		if n, err := strconv.Atoi(cloneAttempts); err == nil && n > 0 {
+			git.CloneAttempts = n
+		} else {
+			log.Printf("Warning: Invalid CLONE_MAX_ATTEMPTS %q, using default of %d", cloneAttempts, git.CloneAttempts)
+		}
+	}
+
+	// Optionally run executed commands as an unprivileged user, which needs the server to run as root
+	if runAsUser := os.Getenv("RUN_AS_USER"); runAsUser != "" {
+		runAs, err := executor.LookupRunAs(runAsUser)
+		if err != nil {
+			log.Fatalf("Invalid RUN_AS_USER: %v", err)
+		}
+		executor.DefaultRunAs = runAs
+		log.Printf("Running commands as %s", runAs)
+	}
+
+	// Optionally let requests pick other users with runAs; without this list they can only pick RUN_AS_USER
+	if allowedUsers := os.Getenv("RUN_AS_ALLOWED_USERS"); allowedUsers != "" {
+		if executor.DefaultRunAs == nil {
+			log.Println("Warning: RUN_AS_ALLOWED_USERS has no effect without RUN_AS_USER")
+		}
+		for _, spec := range strings.Split(allowedUsers, ",") {
+			if strings.TrimSpace(spec) == "" {
+				continue
+			}
+			runAs, err := executor.LookupRunAs(spec)
+			if err != nil {
+				log.Fatalf("Invalid RUN_AS_ALLOWED_USERS: %v", err)
+			}
+			executor.AllowedRunAs = append(executor.AllowedRunAs, runAs)
+		}
+	}
+
+	// Optionally override how long troubleshooting may wait for the AI provider
+	if troubleshootTimeout := os.Getenv("TROUBLESHOOT_TIMEOUT_SECONDS"); troubleshootTimeout != "" {
+		if n, err := strconv.Atoi(troubleshootTimeout); err == nil && n > 0 {
+			ai.TroubleshootTimeout = time.Duration(n) * time.Second
+		} else {
+			log.Printf("Warning: Invalid TROUBLESHOOT_TIMEOUT_SECONDS %q, using default of %v", troubleshootTimeout, ai.TroubleshootTimeout)
+		}
+	}
+
 	// Initialize the router
 	router := api.NewRouter()
 
@@ -52,6 +154,15 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	// Stop background commands first so their output streams end and the server can go idle
+	interrupted, err := executor.GetBackgroundManager().Shutdown(ctx)
+	if interrupted > 0 {
+		log.Printf("Interrupted %d background command(s)", interrupted)
+	}
+	if err != nil {
+		log.Printf("Warning: Background commands did not stop before the shutdown deadline: %v", err)
+	}
+
 	// Attempt graceful shutdown
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
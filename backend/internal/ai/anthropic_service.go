@@ -0,0 +1,195 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prathyushnallamothu/startit/backend/internal/git"
+	"github.com/prathyushnallamothu/startit/backend/internal/metrics"
+)
+
+const (
+	anthropicAPIURL       = "https://api.anthropic.com/v1/messages"
+	anthropicAPIVersion   = "2023-06-01"
+	anthropicDefaultModel = "claude-3-5-sonnet-latest"
+	anthropicMaxTokens    = 4096
+)
+
+// AnthropicService handles interactions with the Anthropic Messages API
+type AnthropicService struct {
+	httpClient *http.Client
+	apiKey     string
+	model      string
+}
+
+// anthropicMessage is a single message in an Anthropic Messages API request
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// anthropicRequest is the request body for the Anthropic Messages API
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	Temperature *float64           `json:"temperature,omitempty"`
+}
+
+// anthropicResponse is the subset of the Anthropic Messages API response we use
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	Usage struct {
+		InputTokens  int64 `json:"input_tokens"`
+		OutputTokens int64 `json:"output_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// NewAnthropicService creates a new Anthropic service with the API key from environment
+func NewAnthropicService() (*AnthropicService, error) {
+	apiKey := os.Getenv("ANTHROPIC_API_KEY")
+	if apiKey == "" {
+		return nil, errors.New("ANTHROPIC_API_KEY environment variable is not set")
+	}
+
+	model := os.Getenv("ANTHROPIC_MODEL")
+	if model == "" {
+		model = anthropicDefaultModel
+	}
+
+	return &AnthropicService{
+		httpClient: http.DefaultClient,
+		apiKey:     apiKey,
+		model:      model,
+	}, nil
+}
+
+// AnalyzeRepository analyzes a Git repository using Anthropic
+func (s *AnthropicService) AnalyzeRepository(ctx context.Context, repo *git.Repository, opts AnalysisOptions) (RepositoryAnalysis, error) {
+	opts.progress(ProgressReadingFiles, "Reading the README, Makefile and setup documentation")
+
+	// Without documentation the model would only guess, so fall back to stack heuristics
+	if analysis, ok := undocumentedAnalysis(repo); ok {
+		opts.progress(ProgressHeuristics, "No setup documentation found; inferring commands from manifest files")
+		return analysis, nil
+	}
+
+	prompt, warnings := buildAnalysisPrompt(repo, opts)
+
+	messages := []anthropicMessage{{Role: RoleUser, Content: analysisUserMessage}}
+	model := opts.modelOr(s.model)
+	opts.progress(ProgressCallingModel, "Asking %s to analyze the repository", model)
+	content, usage, err := s.callAnthropic(ctx, model, prompt, messages, nil)
+	if err != nil {
+		return RepositoryAnalysis{}, fmt.Errorf("failed to call Anthropic: %w", err)
+	}
+
+	opts.progress(ProgressParsingResponse, "Parsing the model's response")
+	analysis, err := parseAnalysisResponse(content)
+	if err != nil {
+		return RepositoryAnalysis{}, err
+	}
+	analysis.Usage = usage
+	analysis.Warnings = append(analysis.Warnings, warnings...)
+
+	return applyRepositoryFacts(repo, analysis), nil
+}
+
+// TroubleshootError generates troubleshooting instructions for an error
+func (s *AnthropicService) TroubleshootError(ctx context.Context, errorMessage, contextStr string, history []ConversationTurn) (string, *TokenUsage, error) {
+	// Replay the conversation so far before the new question
+	messages := make([]anthropicMessage, 0, len(history)+1)
+	for _, turn := range history {
+		messages = append(messages, anthropicMessage{Role: turn.Role, Content: turn.Content})
+	}
+	messages = append(messages, anthropicMessage{Role: RoleUser, Content: buildTroubleshootPrompt(errorMessage, contextStr)})
+
+	temperature := 0.7
+	content, usage, err := s.callAnthropic(ctx, s.model, troubleshootSystemPrompt, messages, &temperature)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get troubleshooting advice: %w", err)
+	}
+
+	return content, usage, nil
+}
+
+// callAnthropic sends the messages to model and returns the concatenated text response and token usage
+func (s *AnthropicService) callAnthropic(ctx context.Context, model, system string, messages []anthropicMessage, temperature *float64) (content string, usage *TokenUsage, err error) {
+	start := time.Now()
+	defer func() { metrics.ObserveAIRequest("anthropic", time.Since(start), err) }()
+
+	body, err := json.Marshal(anthropicRequest{
+		Model:       model,
+		MaxTokens:   anthropicMaxTokens,
+		System:      system,
+		Messages:    messages,
+		Temperature: temperature,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, anthropicAPIURL, bytes.NewReader(body))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", s.apiKey)
+	req.Header.Set("anthropic-version", anthropicAPIVersion)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("Anthropic API error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read Anthropic response: %w", err)
+	}
+
+	var parsed anthropicResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return "", nil, fmt.Errorf("failed to decode Anthropic response (status %d): %w", resp.StatusCode, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if parsed.Error != nil {
+			return "", nil, fmt.Errorf("Anthropic API error (status %d): %s", resp.StatusCode, parsed.Error.Message)
+		}
+		return "", nil, fmt.Errorf("Anthropic API error: status %d", resp.StatusCode)
+	}
+
+	var text strings.Builder
+	for _, block := range parsed.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", nil, errors.New("no response from Anthropic")
+	}
+
+	content = text.String()
+	log.Printf("AI Response: %s", content)
+
+	usage = newTokenUsage(model, parsed.Usage.InputTokens, parsed.Usage.OutputTokens)
+	return content, usage, nil
+}
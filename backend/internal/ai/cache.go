@@ -0,0 +1,57 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/prathyushnallamothu/startit/backend/internal/git"
+)
+
+// analysisCache holds analysis results keyed by provider, repository path, commit hash, language and instructions
+var analysisCache = struct {
+	sync.RWMutex
+	entries map[string]RepositoryAnalysis
+}{entries: make(map[string]RepositoryAnalysis)}
+
+// AnalyzeRepositoryCached returns a cached analysis for the repository's current commit when one
+// exists, otherwise it analyzes the repository and caches the result. Set force to bypass the cache.
+// The returned bool reports whether the result came from the cache.
+func AnalyzeRepositoryCached(ctx context.Context, provider AIProvider, repo *git.Repository, opts AnalysisOptions, force bool) (RepositoryAnalysis, bool, error) {
+	commit, err := repo.CurrentCommit()
+	if err != nil {
+		// Without a commit there is nothing stable to key on, so skip caching
+		log.Printf("Analysis cache disabled for %s: %v", repo.LocalDir, err)
+		analysis, err := provider.AnalyzeRepository(ctx, repo, opts)
+		return analysis, false, err
+	}
+
+	// Instructions can be long, so key on their hash
+	instructionsHash := sha256.Sum256([]byte(strings.TrimSpace(opts.Instructions)))
+	key := fmt.Sprintf("%T|%s|%s|%s|%x|%s", provider, repo.LocalDir, commit, strings.ToLower(opts.language()), instructionsHash[:8], strings.TrimSpace(opts.Model))
+
+	if !force {
+		analysisCache.RLock()
+		analysis, found := analysisCache.entries[key]
+		analysisCache.RUnlock()
+		if found {
+			log.Printf("Using cached analysis for %s at commit %s", repo.LocalDir, commit)
+			opts.progress(ProgressCached, "Using the cached analysis of commit %s", commit)
+			return analysis, true, nil
+		}
+	}
+
+	analysis, err := provider.AnalyzeRepository(ctx, repo, opts)
+	if err != nil {
+		return RepositoryAnalysis{}, false, err
+	}
+
+	analysisCache.Lock()
+	analysisCache.entries[key] = analysis
+	analysisCache.Unlock()
+
+	return analysis, false, nil
+}
@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Roles of the turns in a troubleshooting conversation
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// maxConversationTurns caps how many prior turns are kept and sent back to the model
+const maxConversationTurns = 10
+
+// ConversationTurn is one message of a troubleshooting conversation
+type ConversationTurn struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// conversation is the history of a troubleshooting conversation
+type conversation struct {
+	turns     []ConversationTurn
+	updatedAt time.Time
+}
+
+// conversations holds troubleshooting histories keyed by conversation ID
+var conversations = struct {
+	sync.Mutex
+	entries map[string]*conversation
+}{entries: make(map[string]*conversation)}
+
+// NewConversation starts an empty troubleshooting conversation and returns its ID
+func NewConversation() string {
+	id := uuid.New().String()
+
+	conversations.Lock()
+	defer conversations.Unlock()
+	conversations.entries[id] = &conversation{updatedAt: time.Now()}
+	return id
+}
+
+// GetConversation returns the prior turns of a conversation, or false if it does not exist or has expired
+func GetConversation(id string) ([]ConversationTurn, bool) {
+	conversations.Lock()
+	defer conversations.Unlock()
+
+	conv, exists := conversations.entries[id]
+	if !exists {
+		return nil, false
+	}
+	return append([]ConversationTurn(nil), conv.turns...), true
+}
+
+// RecordTroubleshootTurn adds a troubleshooting question and the model's answer to a conversation,
+// dropping the oldest exchange once the history is full
+func RecordTroubleshootTurn(id, errorMessage, contextStr, solution string) {
+	conversations.Lock()
+	defer conversations.Unlock()
+
+	conv, exists := conversations.entries[id]
+	if !exists {
+		conv = &conversation{}
+		conversations.entries[id] = conv
+	}
+
+	conv.turns = append(conv.turns,
+		ConversationTurn{Role: RoleUser, Content: buildTroubleshootPrompt(errorMessage, contextStr)},
+		ConversationTurn{Role: RoleAssistant, Content: solution},
+	)
+	if len(conv.turns) > maxConversationTurns {
+		conv.turns = conv.turns[len(conv.turns)-maxConversationTurns:]
+	}
+	conv.updatedAt = time.Now()
+}
+
+// CleanupConversations removes conversations that have not been used for longer than olderThan
+func CleanupConversations(olderThan time.Duration) {
+	conversations.Lock()
+	defer conversations.Unlock()
+
+	now := time.Now()
+	for id, conv := range conversations.entries {
+		if now.Sub(conv.updatedAt) > olderThan {
+			delete(conversations.entries, id)
+			log.Printf("Cleaned up troubleshooting conversation [%s]", id)
+		}
+	}
+}
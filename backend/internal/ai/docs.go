@@ -0,0 +1,101 @@
+package ai
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/prathyushnallamothu/startit/backend/internal/git"
+)
+
+// setupDocPatterns match the top-level files besides the README that usually hold build and run instructions
+var setupDocPatterns = []string{"CONTRIBUTING*", "DEVELOPMENT*"}
+
+// setupDocKeywords rank docs/ pages whose names suggest setup instructions ahead of the rest, so
+// they are the last to be cut when the documentation has to be truncated
+var setupDocKeywords = []string{"install", "setup", "getting-started", "getting_started", "quickstart", "develop", "build", "contribut"}
+
+// getSetupDocsContent collects CONTRIBUTING and DEVELOPMENT files plus the markdown pages directly
+// inside docs/, each under a header naming its path. It returns an empty string when there are none,
+// along with the paths that were skipped because they could not be read.
+func getSetupDocsContent(repoPath string) (string, []string, error) {
+	var paths, skipped []string
+	for _, pattern := range setupDocPatterns {
+		matches, err := filepath.Glob(filepath.Join(repoPath, pattern))
+		if err != nil {
+			return "", nil, err
+		}
+		for _, match := range matches {
+			if fileExists(match) {
+				rel, _ := filepath.Rel(repoPath, match)
+				paths = append(paths, rel)
+			}
+		}
+	}
+
+	contents := make(map[string]string)
+	docsDir := filepath.Join(repoPath, "docs")
+	if info, err := os.Stat(docsDir); err == nil && info.IsDir() {
+		// A missing markdown file is not an error; docs/ may only hold images or generated sites
+		docs, unreadable, _ := git.NewRepository("", "", docsDir).GetAllMarkdownFiles()
+		for _, rel := range unreadable {
+			skipped = append(skipped, filepath.Join("docs", rel))
+		}
+
+		var pages []string
+		for rel, content := range docs {
+			// Only the top level of docs/; nested pages are usually API references or translations
+			if strings.ContainsRune(rel, filepath.Separator) {
+				continue
+			}
+			path := filepath.Join("docs", rel)
+			contents[path] = content
+			pages = append(pages, path)
+		}
+		sort.Slice(pages, func(i, j int) bool {
+			ri, rj := setupDocRank(pages[i]), setupDocRank(pages[j])
+			if ri != rj {
+				return ri < rj
+			}
+			return pages[i] < pages[j]
+		})
+		paths = append(paths, pages...)
+	}
+
+	var builder strings.Builder
+	for _, path := range paths {
+		content, ok := contents[path]
+		if !ok {
+			data, err := os.ReadFile(filepath.Join(repoPath, path))
+			if err != nil {
+				log.Printf("Skipping unreadable file %s: %v", path, err)
+				skipped = append(skipped, path)
+				continue
+			}
+			content = string(data)
+		}
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+		if builder.Len() > 0 {
+			builder.WriteString("\n\n")
+		}
+		fmt.Fprintf(&builder, "===== %s =====\n%s", filepath.ToSlash(path), strings.TrimSpace(content))
+	}
+
+	return builder.String(), skipped, nil
+}
+
+// setupDocRank orders docs/ pages: names containing a setup keyword first, then everything else
+func setupDocRank(path string) int {
+	name := strings.ToLower(filepath.Base(path))
+	for _, keyword := range setupDocKeywords {
+		if strings.Contains(name, keyword) {
+			return 0
+		}
+	}
+	return 1
+}
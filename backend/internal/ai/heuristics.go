@@ -0,0 +1,112 @@
+package ai
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/prathyushnallamothu/startit/backend/internal/git"
+)
+
+// installCommands are the commands used to set up a project for each detected package manager
+var installCommands = map[string][]string{
+	"npm":        {"npm install"},
+	"yarn":       {"yarn install"},
+	"pnpm":       {"pnpm install"},
+	"bun":        {"bun install"},
+	"go modules": {"go mod download", "go build ./..."},
+	"pip":        {"pip install -r requirements.txt"},
+	"pipenv":     {"pipenv install"},
+	"poetry":     {"poetry install"},
+	"uv":         {"uv sync"},
+	"cargo":      {"cargo build"},
+	"maven":      {"mvn install"},
+	"gradle":     {"gradle build"},
+	"bundler":    {"bundle install"},
+	"composer":   {"composer install"},
+	"mix":        {"mix deps.get", "mix compile"},
+	"pub":        {"dart pub get"},
+	"dotnet":     {"dotnet build"},
+	"cmake":      {"cmake -B build", "cmake --build build"},
+}
+
+// stackInstallCommands returns the setup commands for a detected technology
+func stackInstallCommands(repo *git.Repository, tech git.DetectedTech) []string {
+	// pip projects configured only through pyproject.toml or setup.py have no requirements file
+	if tech.PackageManager == "pip" && !fileExists(filepath.Join(repo.LocalDir, "requirements.txt")) {
+		return []string{"pip install -e ."}
+	}
+	return installCommands[tech.PackageManager]
+}
+
+// runtimeForLanguage names the runtime prerequisite for languages whose name differs from it
+var runtimeForLanguage = map[string]string{
+	"JavaScript": "Node.js",
+	"TypeScript": "Node.js",
+}
+
+// undocumentedAnalysis builds an analysis from stack heuristics alone when the repository has no README,
+// Makefile, Taskfile, justfile, CI configuration or other setup documentation, so the model is not asked to guess from an almost empty prompt. It returns false
+// when there is documentation to analyze.
+func undocumentedAnalysis(repo *git.Repository) (RepositoryAnalysis, bool) {
+	if _, err := getRepositoryReadmeContent(repo.LocalDir); err == nil {
+		return RepositoryAnalysis{}, false
+	}
+	if _, err := getMakefileContent(repo.LocalDir); err == nil {
+		return RepositoryAnalysis{}, false
+	}
+	if docs, _, _ := getSetupDocsContent(repo.LocalDir); docs != "" {
+		return RepositoryAnalysis{}, false
+	}
+	if runners, _ := repo.DetectTaskRunners(); len(runners) > 0 {
+		return RepositoryAnalysis{}, false
+	}
+	if ciCommands, _ := repo.DetectCICommands(); len(ciCommands) > 0 {
+		return RepositoryAnalysis{}, false
+	}
+
+	stack, err := repo.DetectStack()
+	if err != nil {
+		log.Printf("Error detecting repository stack: %v", err)
+	}
+
+	analysis := RepositoryAnalysis{
+		Warnings: []string{"The repository has no README or Makefile, so setup instructions could not be read from its documentation."},
+	}
+
+	if len(stack) == 0 {
+		analysis.Description = "No README, Makefile or recognized manifest file was found in this repository."
+		analysis.Warnings = append(analysis.Warnings, "No recognized build or manifest files were found either, so no commands could be suggested.")
+		return analysis, true
+	}
+
+	languages := make([]string, 0, len(stack))
+	seen := make(map[string]bool)
+	for _, tech := range stack {
+		languages = append(languages, tech.Language)
+
+		runtime := tech.Language
+		if name, ok := runtimeForLanguage[tech.Language]; ok {
+			runtime = name
+		}
+		if !seen[runtime] {
+			seen[runtime] = true
+			analysis.Prerequisites = append(analysis.Prerequisites, Prerequisite{Name: runtime})
+		}
+
+		// Manifests are only detected in the repository root, so that's where the commands run
+		for _, command := range stackInstallCommands(repo, tech) {
+			analysis.CommandsToRun = append(analysis.CommandsToRun, Command{Cmd: command})
+		}
+		if tech.Warning != "" {
+			analysis.Warnings = append(analysis.Warnings, tech.Warning)
+		}
+	}
+
+	analysis.Description = fmt.Sprintf("A %s project without documentation.", strings.Join(languages, " / "))
+	analysis.Warnings = append(analysis.Warnings, "Commands were inferred from the detected manifest files only and may be incomplete.")
+	analysis.Setup = commandStrings(analysis.CommandsToRun)
+
+	return applyRepositoryFacts(repo, analysis), true
+}
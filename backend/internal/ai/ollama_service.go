@@ -0,0 +1,195 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prathyushnallamothu/startit/backend/internal/git"
+	"github.com/prathyushnallamothu/startit/backend/internal/metrics"
+)
+
+const (
+	ollamaDefaultHost  = "http://localhost:11434"
+	ollamaDefaultModel = "llama3.1"
+)
+
+// OllamaService handles interactions with a local Ollama server, keeping repository contents on the machine
+type OllamaService struct {
+	httpClient *http.Client
+	host       string
+	model      string
+}
+
+// ollamaMessage is a single message in an Ollama chat request or response
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ollamaOptions holds the model parameters we set on Ollama requests
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+}
+
+// ollamaRequest is the request body for Ollama's /api/chat endpoint
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Format   string          `json:"format,omitempty"`
+	Options  *ollamaOptions  `json:"options,omitempty"`
+}
+
+// ollamaResponse is the subset of Ollama's non-streaming chat response we use
+type ollamaResponse struct {
+	Message         ollamaMessage `json:"message"`
+	PromptEvalCount int64         `json:"prompt_eval_count"`
+	EvalCount       int64         `json:"eval_count"`
+	Error           string        `json:"error,omitempty"`
+}
+
+// NewOllamaService creates a new Ollama service using OLLAMA_HOST and OLLAMA_MODEL from the environment
+func NewOllamaService() (*OllamaService, error) {
+	host := ollamaHost()
+
+	model := strings.TrimSpace(os.Getenv("OLLAMA_MODEL"))
+	if model == "" {
+		model = ollamaDefaultModel
+	}
+	log.Printf("Using Ollama model %s at %s", model, host)
+
+	return &OllamaService{
+		httpClient: http.DefaultClient,
+		host:       host,
+		model:      model,
+	}, nil
+}
+
+// ollamaHost returns the Ollama base URL. OLLAMA_HOST may omit the scheme, as the Ollama CLI allows.
+func ollamaHost() string {
+	host := strings.TrimSpace(os.Getenv("OLLAMA_HOST"))
+	if host == "" {
+		return ollamaDefaultHost
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return strings.TrimSuffix(host, "/")
+}
+
+// AnalyzeRepository analyzes a Git repository using the local Ollama model
+func (s *OllamaService) AnalyzeRepository(ctx context.Context, repo *git.Repository, opts AnalysisOptions) (RepositoryAnalysis, error) {
+	opts.progress(ProgressReadingFiles, "Reading the README, Makefile and setup documentation")
+
+	// Without documentation the model would only guess, so fall back to stack heuristics
+	if analysis, ok := undocumentedAnalysis(repo); ok {
+		opts.progress(ProgressHeuristics, "No setup documentation found; inferring commands from manifest files")
+		return analysis, nil
+	}
+
+	prompt, warnings := buildAnalysisPrompt(repo, opts)
+
+	messages := []ollamaMessage{
+		{Role: "system", Content: prompt},
+		{Role: RoleUser, Content: analysisUserMessage},
+	}
+	// Ollama's JSON mode keeps local models from adding prose around the object
+	model := opts.modelOr(s.model)
+	opts.progress(ProgressCallingModel, "Asking %s to analyze the repository", model)
+	content, usage, err := s.callOllama(ctx, model, messages, "json", nil)
+	if err != nil {
+		return RepositoryAnalysis{}, fmt.Errorf("failed to call Ollama: %w", err)
+	}
+
+	opts.progress(ProgressParsingResponse, "Parsing the model's response")
+	analysis, err := parseAnalysisResponse(content)
+	if err != nil {
+		return RepositoryAnalysis{}, err
+	}
+	analysis.Usage = usage
+	analysis.Warnings = append(analysis.Warnings, warnings...)
+
+	return applyRepositoryFacts(repo, analysis), nil
+}
+
+// TroubleshootError generates troubleshooting instructions for an error
+func (s *OllamaService) TroubleshootError(ctx context.Context, errorMessage, contextStr string, history []ConversationTurn) (string, *TokenUsage, error) {
+	// Replay the conversation so far before the new question
+	messages := []ollamaMessage{{Role: "system", Content: troubleshootSystemPrompt}}
+	for _, turn := range history {
+		messages = append(messages, ollamaMessage{Role: turn.Role, Content: turn.Content})
+	}
+	messages = append(messages, ollamaMessage{Role: RoleUser, Content: buildTroubleshootPrompt(errorMessage, contextStr)})
+
+	temperature := 0.7
+	content, usage, err := s.callOllama(ctx, s.model, messages, "", &ollamaOptions{Temperature: &temperature})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get troubleshooting advice: %w", err)
+	}
+
+	return content, usage, nil
+}
+
+// callOllama sends a non-streaming chat request to model and returns the response text and token usage
+func (s *OllamaService) callOllama(ctx context.Context, model string, messages []ollamaMessage, format string, options *ollamaOptions) (content string, usage *TokenUsage, err error) {
+	start := time.Now()
+	defer func() { metrics.ObserveAIRequest("ollama", time.Since(start), err) }()
+
+	body, err := json.Marshal(ollamaRequest{
+		Model:    model,
+		Messages: messages,
+		Stream:   false,
+		Format:   format,
+		Options:  options,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.host+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("Ollama API error (is Ollama running at %s?): %w", s.host, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read Ollama response: %w", err)
+	}
+
+	var parsed ollamaResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return "", nil, fmt.Errorf("failed to decode Ollama response (status %d): %w", resp.StatusCode, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if parsed.Error != "" {
+			return "", nil, fmt.Errorf("Ollama API error (status %d): %s", resp.StatusCode, parsed.Error)
+		}
+		return "", nil, fmt.Errorf("Ollama API error: status %d", resp.StatusCode)
+	}
+
+	content = parsed.Message.Content
+	if content == "" {
+		return "", nil, errors.New("no response from Ollama")
+	}
+	log.Printf("AI Response: %s", content)
+
+	usage = newTokenUsage(model, parsed.PromptEvalCount, parsed.EvalCount)
+	return content, usage, nil
+}
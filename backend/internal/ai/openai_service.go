@@ -8,19 +8,21 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
 	"github.com/prathyushnallamothu/startit/backend/internal/git"
+	"github.com/prathyushnallamothu/startit/backend/internal/metrics"
 )
 
 // OpenAIService handles interactions with the OpenAI API
 type OpenAIService struct {
-	client *openai.Client
-	model  string
+	client      *openai.Client
+	model       string
+	maxAttempts int // Total attempts for rate-limited or failed requests
 }
 
 // NewOpenAIService creates a new OpenAI service with the API key from environment
@@ -30,259 +32,206 @@ func NewOpenAIService() (*OpenAIService, error) {
 		return nil, errors.New("OPENAI_API_KEY environment variable is not set")
 	}
 
-	// Create the OpenAI client
+	// Create the OpenAI client; retries are handled by withRetry so the client's own are disabled
 	client := openai.NewClient(
 		option.WithAPIKey(apiKey),
+		option.WithMaxRetries(0),
 	)
 
+	// Allow operators to pick the model, falling back to GPT-4o mini
+	model := strings.TrimSpace(os.Getenv("OPENAI_MODEL"))
+	if model == "" {
+		model = string(openai.ChatModelGPT4oMini)
+	}
+	log.Printf("Using OpenAI model: %s", model)
+
 	return &OpenAIService{
-		client: client,
-		model:  string(openai.ChatModelGPT4oMini), // Use GPT-4 as string
+		client:      client,
+		model:       model,
+		maxAttempts: maxAttemptsFromEnv(),
 	}, nil
 }
 
 // AnalyzeRepository analyzes a Git repository using OpenAI
-func (s *OpenAIService) AnalyzeRepository(ctx context.Context, repo *git.Repository) (RepositoryAnalysis, error) {
-	// Get repository markdown files
-	readmeContent, err := getRepositoryReadmeContent(repo.LocalDir)
-	if err != nil {
-		log.Printf("Error reading repository README: %v", err)
-	}
+func (s *OpenAIService) AnalyzeRepository(ctx context.Context, repo *git.Repository, opts AnalysisOptions) (RepositoryAnalysis, error) {
+	opts.progress(ProgressReadingFiles, "Reading the README, Makefile and setup documentation")
 
-	// Get Makefile content if available
-	makefileContent, err := getMakefileContent(repo.LocalDir)
-	if err != nil {
-		log.Printf("Makefile not found or couldn't be read: %v", err)
-		// Continue without Makefile content
-		makefileContent = "No Makefile found"
+	// Without documentation the model would only guess, so fall back to stack heuristics
+	if analysis, ok := undocumentedAnalysis(repo); ok {
+		opts.progress(ProgressHeuristics, "No setup documentation found; inferring commands from manifest files")
+		return analysis, nil
 	}
 
-	// Get directory structure to provide context about where to run commands
-	dirStructure, err := getDirectoryStructure(repo.LocalDir, 3) // Limit to 3 levels deep to avoid excessive output
-	if err != nil {
-		log.Printf("Error generating directory structure: %v", err)
-		// Continue without the directory structure if there's an error
-		dirStructure = "Unable to generate directory structure"
-	}
+	prompt, warnings := buildAnalysisPrompt(repo, opts)
 
-	// Construct the repository info string
-	repoInfo := fmt.Sprintf("Repository name: %s, Repository URL: %s", filepath.Base(repo.LocalDir), repo.URL)
-
-	// Construct the prompt
-	prompt := fmt.Sprintf(`Analyze the following repository and provide the following information in JSON format:
-
-{
-  "description": "A concise description of what this repository/project is",
-  "prerequisites": [
-    {
-      "name": "Name of prerequisite/dependency",
-      "description": "Brief description of why it's needed", 
-      "installCommand": "Command to install this prerequisite"
-    }
-  ],
-  "commands": [
-    "Command 1 to run",
-    "Command 2 to run"
-  ]
-}
-
-Instructions:
-- ONLY return the clean JSON object with no additional text.
-- For commands, provide ONLY executable commands that can be directly copied into a terminal without any formatting.
-- For prerequisites, include common software, tools, or dependencies required for this project.
-- Only provide the information that are defined in the repository markdown files DO NOT MAKE UP ANYTHING.
-- Imagine you are running the project locally so provide commands that you would run to execute the commands.
-- Look at the directory structure below to determine the appropriate directories where commands should be run.
-- Use the Makefile targets if a Makefile is present to determine the correct build/run commands.
-
-Repository Information:
-%s
-
-Directory Structure:
-%s
-
-Repository README content:
-%s
-
-Makefile content:
-%s`, repoInfo, dirStructure, readmeContent, makefileContent)
-
-	// Call OpenAI API to analyze the repository
-	content, err := s.callOpenAI(ctx, prompt)
+	// Call OpenAI API to analyze the repository; the model is passed along so overrides never touch the shared service
+	model := opts.modelOr(s.model)
+	opts.progress(ProgressCallingModel, "Asking %s to analyze the repository", model)
+	content, usage, err := s.callOpenAI(ctx, model, prompt)
 	if err != nil {
 		return RepositoryAnalysis{}, fmt.Errorf("failed to call OpenAI: %w", err)
 	}
 
-	// Parse the response into structured data
-	var jsonResponse struct {
-		Description   string        `json:"description"`
-		Commands     []string      `json:"commands"`
-		Prerequisites []Prerequisite `json:"prerequisites"`
-	}
-
-	// Try to parse the content as JSON
-	err = json.Unmarshal([]byte(content), &jsonResponse)
+	opts.progress(ProgressParsingResponse, "Parsing the model's response")
+	analysis, err := parseAnalysisResponse(content)
 	if err != nil {
-		// If we failed to parse the JSON, the response might be wrapped in markdown code block
-		if strings.Contains(content, "```json") && strings.Contains(content, "```") {
-			// Extract content between ```json and ```
-			jsonMatch := regexp.MustCompile("```json\\s*([\\s\\S]*?)```").FindStringSubmatch(content)
-			if len(jsonMatch) > 1 {
-				jsonContent := jsonMatch[1]
-				// Try to parse the extracted JSON
-				err = json.Unmarshal([]byte(jsonContent), &jsonResponse)
-			}
-		}
-		
-		// If we still failed, return an error
-		if err != nil {
-			return RepositoryAnalysis{}, fmt.Errorf("failed to parse OpenAI response as JSON: %w", err)
-		}
-	}
-
-	// Convert the parsed JSON to our RepositoryAnalysis struct
-	analysis := RepositoryAnalysis{
-		Description:   jsonResponse.Description,
-		CommandsToRun: jsonResponse.Commands,
-		Prerequisites: jsonResponse.Prerequisites,
-		Setup:         jsonResponse.Commands, // Use the same commands for Setup to maintain compatibility
+		return RepositoryAnalysis{}, err
 	}
+	analysis.Usage = usage
+	analysis.Warnings = append(analysis.Warnings, warnings...)
 
-	log.Printf("Extracted Setup Instructions: %v", analysis.Setup)
-	log.Printf("Extracted Commands: %v", analysis.CommandsToRun)
-	log.Printf("Extracted Prerequisites: %v", analysis.Prerequisites)
-
-	return analysis, nil
+	return applyRepositoryFacts(repo, analysis), nil
 }
 
 // TroubleshootError generates troubleshooting instructions for an error
-func (s *OpenAIService) TroubleshootError(errorMessage, contextStr string) (string, error) {
-	ctx := context.Background()
-	
+func (s *OpenAIService) TroubleshootError(ctx context.Context, errorMessage, contextStr string, history []ConversationTurn) (string, *TokenUsage, error) {
 	// Create the messages and prompt
-	prompt := fmt.Sprintf("I encountered this error while working with a repository:\n\n%s\n\nContext: %s\n\nPlease provide troubleshooting steps and a potential solution.", errorMessage, contextStr)
+	prompt := buildTroubleshootPrompt(errorMessage, contextStr)
 	
-	// Create the chat completion
-	completion, err := s.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
-			openai.SystemMessage("You are a helpful programming assistant specializing in troubleshooting development environment issues."),
-			openai.UserMessage(prompt),
-		}),
-		Model:       openai.F(s.model),
-		Temperature: openai.Float(0.7),
-	})
+	// Create the chat completion, retrying transient failures
+	completion, err := s.createCompletion(ctx, s.troubleshootParams(history, prompt))
 	
 	if err != nil {
-		return "", fmt.Errorf("failed to get troubleshooting advice: %w", err)
+		return "", nil, fmt.Errorf("failed to get troubleshooting advice: %w", err)
 	}
 	
 	if len(completion.Choices) == 0 {
-		return "", errors.New("no troubleshooting advice received")
+		return "", nil, errors.New("no troubleshooting advice received")
 	}
 	
-	return completion.Choices[0].Message.Content, nil
+	usage := newTokenUsage(s.model, completion.Usage.PromptTokens, completion.Usage.CompletionTokens)
+	return completion.Choices[0].Message.Content, usage, nil
 }
 
-// getDirectoryStructure generates a simplified directory tree structure starting from rootPath
-func getDirectoryStructure(rootPath string, maxDepth int) (string, error) {
-	var result strings.Builder
-	baseName := filepath.Base(rootPath)
-	result.WriteString(baseName + "/\n")
+// TroubleshootErrorStream generates troubleshooting instructions, passing each chunk to onChunk as it
+// arrives. It returns the fully assembled text, which matches what TroubleshootError would return.
+func (s *OpenAIService) TroubleshootErrorStream(ctx context.Context, errorMessage, contextStr string, history []ConversationTurn, onChunk func(string)) (string, error) {
+	prompt := buildTroubleshootPrompt(errorMessage, contextStr)
 
-	err := walkDirectoryStructure(rootPath, &result, "", 0, maxDepth)
-	if err != nil {
-		return "", err
-	}
-
-	return result.String(), nil
-}
+	start := time.Now()
+	stream := s.client.Chat.Completions.NewStreaming(ctx, s.troubleshootParams(history, prompt))
+	defer stream.Close()
 
-// walkDirectoryStructure recursively walks the directory structure up to maxDepth
-func walkDirectoryStructure(path string, output *strings.Builder, indent string, depth, maxDepth int) error {
-	if depth >= maxDepth {
-		return nil
+	var content strings.Builder
+	for stream.Next() {
+		chunk := stream.Current()
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		delta := chunk.Choices[0].Delta.Content
+		content.WriteString(delta)
+		if onChunk != nil {
+			onChunk(delta)
+		}
 	}
 
-	files, err := os.ReadDir(path)
+	err := stream.Err()
+	metrics.ObserveAIRequest("openai", time.Since(start), err)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("failed to stream troubleshooting advice: %w", err)
 	}
 
-	// Sort files and directories to make output consistent
-	sort.Slice(files, func(i, j int) bool {
-		// Directories come first, then files
-		if files[i].IsDir() != files[j].IsDir() {
-			return files[i].IsDir()
-		}
-		return files[i].Name() < files[j].Name()
-	})
+	if content.Len() == 0 {
+		return "", errors.New("no troubleshooting advice received")
+	}
 
-	for i, file := range files {
-		if shouldSkip(file.Name()) {
-			continue
-		}
+	return content.String(), nil
+}
 
-		// Determine the prefix for this item
-		var linePrefix string
-		if i == len(files)-1 {
-			linePrefix = indent + "└── "
-			// Next level indent
-			nextIndent := indent + "    "
-			if file.IsDir() {
-				output.WriteString(linePrefix + file.Name() + "/\n")
-				nextPath := filepath.Join(path, file.Name())
-				err := walkDirectoryStructure(nextPath, output, nextIndent, depth+1, maxDepth)
-				if err != nil {
-					return err
-				}
-			} else {
-				output.WriteString(linePrefix + file.Name() + "\n")
-			}
+// troubleshootParams builds the chat completion parameters for a troubleshooting prompt that follows
+// the given conversation history
+func (s *OpenAIService) troubleshootParams(history []ConversationTurn, prompt string) openai.ChatCompletionNewParams {
+	messages := []openai.ChatCompletionMessageParamUnion{openai.SystemMessage(troubleshootSystemPrompt)}
+	for _, turn := range history {
+		if turn.Role == RoleAssistant {
+			messages = append(messages, openai.AssistantMessage(turn.Content))
 		} else {
-			linePrefix = indent + "├── "
-			// Next level indent
-			nextIndent := indent + "│   "
-			if file.IsDir() {
-				output.WriteString(linePrefix + file.Name() + "/\n")
-				nextPath := filepath.Join(path, file.Name())
-				err := walkDirectoryStructure(nextPath, output, nextIndent, depth+1, maxDepth)
-				if err != nil {
-					return err
-				}
-			} else {
-				output.WriteString(linePrefix + file.Name() + "\n")
-			}
+			messages = append(messages, openai.UserMessage(turn.Content))
 		}
 	}
+	messages = append(messages, openai.UserMessage(prompt))
 
-	return nil
+	return openai.ChatCompletionNewParams{
+		Messages: openai.F(messages),
+		Model:       openai.F(s.model),
+		Temperature: openai.Float(0.7),
+	}
 }
 
-// shouldSkip returns true if the filename should be skipped in the directory structure
-func shouldSkip(filename string) bool {
-	// Skip hidden files and common directories to avoid noise
-	if strings.HasPrefix(filename, ".") {
-		return true
+// getDirectoryStructure renders the repository's directory tree as ASCII art for the prompt,
+// also returning the directories that were skipped because they could not be read
+func getDirectoryStructure(repo *git.Repository, maxDepth int) (string, []string, error) {
+	tree, err := repo.GetDirectoryTree(maxDepth)
+	if err != nil {
+		return "", nil, err
 	}
-	
-	// Skip common large directories that don't help with command context
-	skipDirs := map[string]bool{
-		"node_modules": true,
-		"vendor":      true,
-		"dist":        true,
-		"build":       true,
-		".git":        true,
+
+	var result strings.Builder
+	result.WriteString(tree.Name + "/\n")
+	renderDirectoryTree(&result, tree.Children, "")
+
+	return result.String(), tree.UnreadablePaths(), nil
+}
+
+// renderDirectoryTree writes nodes and their children with tree-drawing prefixes
+func renderDirectoryTree(output *strings.Builder, nodes []*git.DirectoryNode, indent string) {
+	for i, node := range nodes {
+		// Determine the prefix for this item and the indent for its children
+		linePrefix, nextIndent := indent+"├── ", indent+"│   "
+		if i == len(nodes)-1 {
+			linePrefix, nextIndent = indent+"└── ", indent+"    "
+		}
+
+		if node.IsDir {
+			output.WriteString(linePrefix + node.Name + "/\n")
+			renderDirectoryTree(output, node.Children, nextIndent)
+		} else {
+			output.WriteString(linePrefix + node.Name + "\n")
+		}
 	}
-	
-	return skipDirs[filename]
 }
 
 // RepositoryAnalysis is the structured response from repository analysis
 type RepositoryAnalysis struct {
 	Description   string        `json:"description"`
-	CommandsToRun []string      `json:"commands"`
+	CommandsToRun []Command     `json:"commands"`
 	Prerequisites []Prerequisite `json:"prerequisites"`
 	Setup         []string      `json:"setup,omitempty"`
+	Warnings      []string      `json:"warnings,omitempty"` // Why the analysis may be incomplete
+	Usage         *TokenUsage   `json:"usage,omitempty"` // Tokens spent producing this analysis
+}
+
+// Command is a setup command and the directory it runs in
+type Command struct {
+	Cmd        string `json:"cmd"`
+	WorkingDir string `json:"workingDir,omitempty"` // Relative to the repository root; empty for the root itself
+}
+
+// UnmarshalJSON accepts a plain command string as well as a command object, since models don't
+// always follow the schema and a bare string is a command run in the repository root
+func (c *Command) UnmarshalJSON(data []byte) error {
+	var cmd string
+	if err := json.Unmarshal(data, &cmd); err == nil {
+		*c = Command{Cmd: cmd}
+		return nil
+	}
+
+	type command Command // Without the UnmarshalJSON method, so this doesn't recurse
+	var decoded command
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*c = Command(decoded)
+	return nil
+}
+
+// commandStrings returns just the command lines, for the flat Setup list
+func commandStrings(commands []Command) []string {
+	lines := make([]string, 0, len(commands))
+	for _, command := range commands {
+		lines = append(lines, command.Cmd)
+	}
+	return lines
 }
 
 // Prerequisite represents a required dependency for the repository
@@ -290,24 +239,92 @@ type Prerequisite struct {
 	Name            string `json:"name"`
 	Description     string `json:"description,omitempty"`
 	InstallCommand  string `json:"installCommand,omitempty"`
+	Version         string `json:"version,omitempty"`      // Required version pinned by the repository, if any
+	CheckCommand    string `json:"checkCommand,omitempty"` // Prints the installed version, e.g. "node --version"
 }
 
+// readmeExtensionRank orders README formats from most to least useful; unknown extensions rank after all of these
+var readmeExtensionRank = map[string]int{".md": 0, ".markdown": 1, ".rst": 2, ".txt": 3, "": 4}
+
+// readmeDocDirs are searched one level deep when the repository root has no README
+var readmeDocDirs = []string{"docs", "doc", "documentation", ".github"}
+
+// getRepositoryReadmeContent returns the repository's README, preferring README.md over README.rst,
+// README.txt and a bare README, and those over variants such as README.template or README.zh-CN.md.
+// When the root has none, the common documentation directories are searched as well.
 func getRepositoryReadmeContent(repoPath string) (string, error) {
-	readmeFiles, err := filepath.Glob(filepath.Join(repoPath, "README*"))
+	for _, dir := range append([]string{""}, readmeDocDirs...) {
+		readmePath, err := findReadme(filepath.Join(repoPath, dir))
+		if err != nil {
+			return "", err
+		}
+		if readmePath == "" {
+			continue
+		}
+
+		readmeContent, err := os.ReadFile(readmePath)
+		if err != nil {
+			return "", err
+		}
+		return string(readmeContent), nil
+	}
+
+	return "", errors.New("no README file found")
+}
+
+// findReadme returns the path of the best README file directly inside dir, or an empty string when
+// there is none. Exact README names win over variants, then by format, then the larger file, so the
+// choice doesn't depend on directory order.
+func findReadme(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
 		return "", err
 	}
 
-	if len(readmeFiles) == 0 {
-		return "", errors.New("no README file found")
+	type candidate struct {
+		name string
+		rank int
+		size int64
 	}
+	var candidates []candidate
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(strings.ToLower(name), "readme") {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil || !info.Mode().IsRegular() || info.Size() == 0 {
+			continue
+		}
 
-	readmeContent, err := os.ReadFile(readmeFiles[0])
-	if err != nil {
-		return "", err
+		ext := strings.ToLower(filepath.Ext(name))
+		rank, known := readmeExtensionRank[ext]
+		if !known {
+			rank = len(readmeExtensionRank)
+		}
+		// README.zh-CN.md and README.template are variants of the main README
+		if !strings.EqualFold(strings.TrimSuffix(name, filepath.Ext(name)), "readme") || !known {
+			rank += len(readmeExtensionRank) + 1
+		}
+		candidates = append(candidates, candidate{name: name, rank: rank, size: info.Size()})
+	}
+	if len(candidates) == 0 {
+		return "", nil
 	}
 
-	return string(readmeContent), nil
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].rank != candidates[j].rank {
+			return candidates[i].rank < candidates[j].rank
+		}
+		if candidates[i].size != candidates[j].size {
+			return candidates[i].size > candidates[j].size
+		}
+		return candidates[i].name < candidates[j].name
+	})
+	return filepath.Join(dir, candidates[0].name), nil
 }
 
 func getMakefileContent(repoPath string) (string, error) {
@@ -338,26 +355,51 @@ func fileExists(filename string) bool {
 	return !info.IsDir()
 }
 
-func (s *OpenAIService) callOpenAI(ctx context.Context, prompt string) (string, error) {
-	// Build the messages
-	chatCompletion, err := s.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+// createCompletion creates a chat completion, retrying rate limits and server errors with backoff
+func (s *OpenAIService) createCompletion(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	var completion *openai.ChatCompletion
+	err := withRetry(ctx, s.maxAttempts, func() error {
+		start := time.Now()
+		var err error
+		completion, err = s.client.Chat.Completions.New(ctx, params)
+		metrics.ObserveAIRequest("openai", time.Since(start), err)
+		return err
+	})
+	return completion, err
+}
+
+// callOpenAI sends the analysis prompt and returns the response text along with its token usage
+func (s *OpenAIService) callOpenAI(ctx context.Context, model, prompt string) (string, *TokenUsage, error) {
+	// Build the messages, asking for JSON that follows the analysis schema
+	params := openai.ChatCompletionNewParams{
 		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
 			openai.SystemMessage(prompt),
-			openai.UserMessage("Analyze this repository and provide your response as a clean JSON object with description, prerequisites, and commands. Do NOT include any markdown formatting or backticks in your response."),
+			openai.UserMessage(analysisUserMessage),
 		}),
-		Model: openai.F(s.model),
-	})
+		Model:          openai.F(model),
+		ResponseFormat: openai.F(analysisResponseFormat()),
+	}
+
+	chatCompletion, err := s.createCompletion(ctx, params)
+
+	// Older models reject structured outputs; fall back to a plain request and lenient parsing
+	if err != nil && isResponseFormatUnsupported(err) {
+		log.Printf("Model %s does not support structured outputs, retrying without a response format", model)
+		params.ResponseFormat = openai.Null[openai.ChatCompletionNewParamsResponseFormatUnion]()
+		chatCompletion, err = s.createCompletion(ctx, params)
+	}
 
 	if err != nil {
-		return "", fmt.Errorf("OpenAI API error: %w", err)
+		return "", nil, fmt.Errorf("OpenAI API error: %w", err)
 	}
 
 	if len(chatCompletion.Choices) == 0 {
-		return "", errors.New("no response from OpenAI")
+		return "", nil, errors.New("no response from OpenAI")
 	}
 
 	content := chatCompletion.Choices[0].Message.Content
 	log.Printf("AI Response: %s", content)
 
-	return content, nil
+	usage := newTokenUsage(model, chatCompletion.Usage.PromptTokens, chatCompletion.Usage.CompletionTokens)
+	return content, usage, nil
 }
@@ -0,0 +1,69 @@
+package ai
+
+import (
+	"strings"
+)
+
+// defaultCheckCommands are version commands for well-known tools, keyed by the lowercase first word
+// of a prerequisite name, used when the model doesn't give a check command
+var defaultCheckCommands = map[string]string{
+	"node":       "node --version",
+	"node.js":    "node --version",
+	"nodejs":     "node --version",
+	"npm":        "npm --version",
+	"yarn":       "yarn --version",
+	"pnpm":       "pnpm --version",
+	"bun":        "bun --version",
+	"deno":       "deno --version",
+	"python":     "python3 --version",
+	"python3":    "python3 --version",
+	"pip":        "pip3 --version",
+	"pipenv":     "pipenv --version",
+	"poetry":     "poetry --version",
+	"go":         "go version",
+	"golang":     "go version",
+	"rust":       "rustc --version",
+	"rustc":      "rustc --version",
+	"cargo":      "cargo --version",
+	"java":       "java -version",
+	"jdk":        "java -version",
+	"maven":      "mvn --version",
+	"gradle":     "gradle --version",
+	"ruby":       "ruby --version",
+	"bundler":    "bundle --version",
+	"php":        "php --version",
+	"composer":   "composer --version",
+	"elixir":     "elixir --version",
+	"erlang":     "erl -version",
+	"dart":       "dart --version",
+	"flutter":    "flutter --version",
+	".net":       "dotnet --version",
+	"dotnet":     "dotnet --version",
+	"c#":         "dotnet --version",
+	"cmake":      "cmake --version",
+	"make":       "make --version",
+	"git":        "git --version",
+	"docker":     "docker --version",
+	"postgresql": "psql --version",
+	"postgres":   "psql --version",
+	"redis":      "redis-server --version",
+}
+
+// applyCheckCommands fills in the check command of prerequisites the model left without one when
+// they name a well-known tool
+func applyCheckCommands(analysis RepositoryAnalysis) RepositoryAnalysis {
+	prerequisites := append([]Prerequisite(nil), analysis.Prerequisites...)
+	for i := range prerequisites {
+		prerequisites[i].CheckCommand = strings.TrimSpace(prerequisites[i].CheckCommand)
+		if prerequisites[i].CheckCommand != "" {
+			continue
+		}
+		fields := strings.Fields(strings.ToLower(prerequisites[i].Name))
+		if len(fields) > 0 {
+			prerequisites[i].CheckCommand = defaultCheckCommands[fields[0]]
+		}
+	}
+
+	analysis.Prerequisites = prerequisites
+	return analysis
+}
@@ -0,0 +1,587 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/prathyushnallamothu/startit/backend/internal/git"
+)
+
+// analysisUserMessage is the user turn that accompanies the analysis prompt
+const analysisUserMessage = "Analyze this repository and provide your response as a clean JSON object with description, prerequisites, and commands. Do NOT include any markdown formatting or backticks in your response."
+
+// troubleshootSystemPrompt is the system prompt used for troubleshooting requests
+const troubleshootSystemPrompt = "You are a helpful programming assistant specializing in troubleshooting development environment issues."
+
+// buildAnalysisPrompt gathers repository context and builds the analysis prompt shared by all providers.
+// It also returns warnings about repository content that was left out of the prompt.
+func buildAnalysisPrompt(repo *git.Repository, opts AnalysisOptions) (string, []string) {
+	var warnings []string
+
+	// Get repository markdown files
+	readmeContent, err := getRepositoryReadmeContent(repo.LocalDir)
+	if err != nil {
+		log.Printf("Error reading repository README: %v", err)
+	}
+
+	// Get Makefile content if available
+	makefileContent, err := getMakefileContent(repo.LocalDir)
+	if err != nil {
+		log.Printf("Makefile not found or couldn't be read: %v", err)
+		// Continue without Makefile content
+		makefileContent = "No Makefile found"
+	}
+
+	// Build and run instructions often live in CONTRIBUTING, DEVELOPMENT or docs/ instead of the README
+	docsContent, unreadableDocs, err := getSetupDocsContent(repo.LocalDir)
+	if err != nil {
+		log.Printf("Error reading repository documentation: %v", err)
+	}
+	if docsContent == "" {
+		docsContent = "No CONTRIBUTING, DEVELOPMENT or docs/ files found"
+	}
+
+	// Get directory structure to provide context about where to run commands; huge repositories
+	// only get their top level walked so the scan stays fast
+	treeDepth, sizeWarning := directoryScanDepth(repo)
+	if sizeWarning != "" {
+		warnings = append(warnings, sizeWarning)
+	}
+	opts.progress(ProgressScanningTree, "Scanning the directory structure")
+	dirStructure, unreadableDirs, err := getDirectoryStructure(repo, treeDepth)
+	if err != nil {
+		log.Printf("Error generating directory structure: %v", err)
+		// Continue without the directory structure if there's an error
+		dirStructure = "Unable to generate directory structure"
+	}
+	if warning := unreadablePathsWarning(append(unreadableDirs, unreadableDocs...)); warning != "" {
+		warnings = append(warnings, warning)
+	}
+
+	// Detect the stack from manifest files so the model has signals even without a README
+	stackInfo := "No known build or manifest files detected"
+	if stack, err := repo.DetectStack(); err != nil {
+		log.Printf("Error detecting repository stack: %v", err)
+	} else if len(stack) > 0 {
+		stackInfo = formatDetectedStack(stack)
+		languages := make([]string, 0, len(stack))
+		for _, tech := range stack {
+			languages = append(languages, tech.Language)
+		}
+		opts.progress(ProgressDetectedStack, "Detected stack: %s", strings.Join(languages, ", "))
+	}
+
+	// Include package.json scripts so the model uses real script names instead of guessing
+	scriptsInfo := "No package.json scripts found"
+	if scripts, err := repo.GetPackageScripts(); err == nil && len(scripts) > 0 {
+		scriptsInfo = formatPackageScripts(scripts)
+	}
+
+	// List Taskfile and justfile tasks so the model runs them by name instead of copying their commands
+	taskRunnersInfo := "No Taskfile or justfile found"
+	if runners, err := repo.DetectTaskRunners(); err != nil {
+		log.Printf("Error reading task runner files: %v", err)
+	} else if len(runners) > 0 {
+		taskRunnersInfo = formatTaskRunners(runners)
+	}
+
+	// CI workflows run the project's real build and test commands, which READMEs often leave out
+	ciInfo := "No GitHub Actions or GitLab CI configuration found"
+	ciCommands, err := repo.DetectCICommands()
+	if err != nil {
+		log.Printf("Error reading CI configuration: %v", err)
+	}
+	if len(ciCommands) > 0 {
+		ciInfo = formatCICommands(ciCommands)
+	}
+
+	// Keep large READMEs, Makefiles, docs and trees from overflowing the model's context window
+	sections := promptSections{
+		readme:   readmeContent,
+		makefile: makefileContent,
+		tree:     dirStructure,
+		docs:     docsContent,
+	}.fitToBudget(contentTokenBudgetFromEnv())
+
+	// Construct the repository info string
+	repoInfo := fmt.Sprintf("Repository name: %s, Repository URL: %s", filepath.Base(repo.LocalDir), repo.URL)
+
+	// Construct the prompt
+	prompt := fmt.Sprintf(`Analyze the following repository and provide the following information in JSON format:
+
+{
+  "description": "A concise description of what this repository/project is",
+  "prerequisites": [
+    {
+      "name": "Name of prerequisite/dependency",
+      "description": "Brief description of why it's needed", 
+      "installCommand": "Command to install this prerequisite",
+      "checkCommand": "Command that prints the installed version, e.g. node --version"
+    }
+  ],
+  "commands": [
+    {
+      "cmd": "Command 1 to run",
+      "workingDir": "Directory to run it in, relative to the repository root, or an empty string for the root"
+    }
+  ]
+}
+
+Instructions:
+- ONLY return the clean JSON object with no additional text.
+- For commands, provide ONLY executable commands that can be directly copied into a terminal without any formatting.
+- For prerequisites, include common software, tools, or dependencies required for this project.
+- For each prerequisite, set checkCommand to a single command that succeeds and prints its version only when it is installed (e.g. "node --version" or "go version"), or an empty string if there is none; it must not install or change anything.
+- Only provide the information that are defined in the repository markdown files DO NOT MAKE UP ANYTHING.
+- Imagine you are running the project locally so provide commands that you would run to execute the commands.
+- Look at the directory structure below to determine the appropriate directories where commands should be run, and set each command's workingDir to it (e.g. "frontend" for npm install in a frontend/ folder) instead of prefixing the command with cd.
+- Check the additional documentation for setup steps the README leaves out, such as development or contributor setup.
+- Use the Makefile targets if a Makefile is present to determine the correct build/run commands.
+- Use the detected stack to choose the right package manager when the documentation is sparse.
+- Only use package.json scripts that are listed below; never invent script names.
+- When a Taskfile or justfile defines a task for a step, run it with "task <name>" or "just <name>" instead of the commands it wraps; never invent task names.
+- The CI commands are the exact commands the project's own pipelines use to install, build and test it; prefer them over commands guessed from prose, keeping their working directories, but leave out CI-only steps such as deploying, publishing, uploading artifacts or configuring caches.
+- Write the description and prerequisite descriptions in %s, even if the README is in another language.
+- Keep commands, install commands, check commands and prerequisite names exactly as they would be typed; never translate them.
+
+Repository Information:
+%s
+
+Detected Stack:
+%s
+
+package.json scripts:
+%s
+
+Task runners (Taskfile / justfile):
+%s
+
+CI commands (GitHub Actions / GitLab CI):
+%s
+
+Directory Structure:
+%s
+
+Repository README content:
+%s
+
+Additional documentation (CONTRIBUTING, DEVELOPMENT and docs/):
+%s
+
+Makefile content:
+%s`, opts.language(), repoInfo, stackInfo, scriptsInfo, taskRunnersInfo, ciInfo, sections.tree, sections.readme, sections.docs, sections.makefile)
+
+	// Custom instructions go last, followed by the output contract so they can steer the content but not the format
+	if instructions := strings.TrimSpace(opts.Instructions); instructions != "" {
+		prompt += fmt.Sprintf(`
+
+Additional instructions from the user:
+%s
+
+Whatever the additional instructions say, respond with ONLY the JSON object in the format described at the top, with the same fields and no other text.`, instructions)
+	}
+
+	return prompt, warnings
+}
+
+// maxListedUnreadablePaths is how many skipped paths an unreadable-paths warning names before summarizing
+const maxListedUnreadablePaths = 5
+
+// unreadablePathsWarning describes the paths skipped while scanning the repository, or returns "" if there are none.
+// The tree and documentation scans can both skip the same directory, so each path is named once.
+func unreadablePathsWarning(skipped []string) string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, path := range skipped {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, filepath.ToSlash(path))
+		}
+	}
+	if len(paths) == 0 {
+		return ""
+	}
+
+	listed := paths
+	if len(listed) > maxListedUnreadablePaths {
+		listed = listed[:maxListedUnreadablePaths]
+	}
+	warning := fmt.Sprintf("%d path(s) could not be read and were left out of the analysis: %s", len(paths), strings.Join(listed, ", "))
+	if extra := len(paths) - len(listed); extra > 0 {
+		warning += fmt.Sprintf(" and %d more", extra)
+	}
+	return warning
+}
+
+// formatDetectedStack renders the detected stack as a bullet list for the prompt
+func formatDetectedStack(stack []git.DetectedTech) string {
+	lines := make([]string, 0, len(stack))
+	for _, tech := range stack {
+		line := fmt.Sprintf("- %s (%s)", tech.Language, tech.PackageManager)
+		if tech.Warning != "" {
+			line += fmt.Sprintf(": conflicting lockfiles %s, so use %s for installing", strings.Join(tech.Lockfiles, ", "), tech.PackageManager)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatPackageScripts renders package.json scripts as a sorted bullet list for the prompt
+func formatPackageScripts(scripts map[string]string) string {
+	names := make([]string, 0, len(scripts))
+	for name := range scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("- %s: %s", name, scripts[name]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatTaskRunners renders each task runner and its tasks as a bullet for the prompt
+func formatTaskRunners(runners []git.TaskRunner) string {
+	lines := make([]string, 0, len(runners))
+	for _, runner := range runners {
+		tasks := "no public tasks"
+		if len(runner.Tasks) > 0 {
+			tasks = strings.Join(runner.Tasks, ", ")
+		}
+		lines = append(lines, fmt.Sprintf("- %s (%s): %s", runner.Name, runner.File, tasks))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatCICommands renders CI commands grouped under their file and job, indenting multi-line scripts
+func formatCICommands(commands []git.CICommand) string {
+	var lines []string
+	lastJob := ""
+	for _, command := range commands {
+		if job := command.File + ": " + command.Job; job != lastJob {
+			lines = append(lines, "- "+job)
+			lastJob = job
+		}
+
+		prefix := "  - "
+		if command.WorkingDir != "" {
+			prefix += "(in " + command.WorkingDir + ") "
+		}
+		lines = append(lines, prefix+strings.ReplaceAll(command.Run, "\n", "\n    "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// applyRepositoryFacts corrects a model's analysis with what can be read from the repository directly:
+// real package.json scripts and task runner tasks, and runtime versions pinned by version files
+func applyRepositoryFacts(repo *git.Repository, analysis RepositoryAnalysis) RepositoryAnalysis {
+	return applyCheckCommands(applyRuntimeVersions(repo, applyTaskRunners(repo, applyPackageScripts(repo, analysis))))
+}
+
+// applyTaskRunners drops "task <name>" and "just <name>" commands for tasks the repository doesn't define
+func applyTaskRunners(repo *git.Repository, analysis RepositoryAnalysis) RepositoryAnalysis {
+	runners, err := repo.DetectTaskRunners()
+	if err != nil {
+		log.Printf("Ignoring unreadable task runner files: %v", err)
+	}
+
+	tasks := make(map[string]map[string]bool)
+	for _, runner := range runners {
+		tasks[runner.Name] = make(map[string]bool)
+		for _, task := range runner.Tasks {
+			tasks[runner.Name][task] = true
+		}
+	}
+
+	commands := make([]Command, 0, len(analysis.CommandsToRun))
+	for _, command := range analysis.CommandsToRun {
+		// Task runners are only read from the repository root, so commands run elsewhere can't be checked
+		fields := strings.Fields(command.Cmd)
+		if command.WorkingDir == "" && len(fields) >= 2 && (fields[0] == git.TaskRunnerTask || fields[0] == git.TaskRunnerJust) && !strings.HasPrefix(fields[1], "-") {
+			// Only check runners we could read; an unparseable file shouldn't cost the model's commands
+			if defined, ok := tasks[fields[0]]; ok && !defined[fields[1]] {
+				log.Printf("Dropping command for unknown %s task: %s", fields[0], command.Cmd)
+				continue
+			}
+		}
+		commands = append(commands, command)
+	}
+
+	analysis.CommandsToRun = commands
+	analysis.Setup = commandStrings(commands)
+	return analysis
+}
+
+// preferredScripts are the package.json scripts always surfaced as commands when present
+var preferredScripts = []string{"build", "dev", "start"}
+
+// applyPackageScripts replaces guessed script commands with the repository's real package.json scripts.
+// Commands that run a script which does not exist are dropped, and common scripts the model missed are added.
+func applyPackageScripts(repo *git.Repository, analysis RepositoryAnalysis) RepositoryAnalysis {
+	scripts, err := repo.GetPackageScripts()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Ignoring package.json scripts: %v", err)
+		}
+		return analysis
+	}
+
+	runner := packageScriptRunner(repo)
+	commands := make([]Command, 0, len(analysis.CommandsToRun))
+	present := make(map[string]bool)
+	for _, command := range analysis.CommandsToRun {
+		// Only the root package.json is read, so scripts run in other directories are left alone
+		if script, ok := scriptFromCommand(command.Cmd); ok && command.WorkingDir == "" {
+			if _, exists := scripts[script]; !exists {
+				log.Printf("Dropping command for unknown package.json script: %s", command.Cmd)
+				continue
+			}
+			present[script] = true
+		}
+		commands = append(commands, command)
+	}
+
+	for _, script := range preferredScripts {
+		if _, exists := scripts[script]; exists && !present[script] {
+			commands = append(commands, Command{Cmd: runner + " " + script})
+		}
+	}
+
+	analysis.CommandsToRun = commands
+	analysis.Setup = commandStrings(commands)
+	return analysis
+}
+
+// runtimeAliases lists the names a model may use for each runtime reported by DetectRuntimeVersions
+var runtimeAliases = map[string][]string{
+	"Node.js": {"node", "nodejs", "node.js"},
+	"Python":  {"python", "python3"},
+	"Go":      {"go", "golang"},
+}
+
+// applyRuntimeVersions sets the version of each prerequisite whose runtime is pinned by a version file,
+// adding a prerequisite for pinned runtimes the model did not mention
+func applyRuntimeVersions(repo *git.Repository, analysis RepositoryAnalysis) RepositoryAnalysis {
+	versions, err := repo.DetectRuntimeVersions()
+	if err != nil {
+		log.Printf("Ignoring runtime versions: %v", err)
+		return analysis
+	}
+	if len(versions) == 0 {
+		return analysis
+	}
+
+	prerequisites := append([]Prerequisite(nil), analysis.Prerequisites...)
+	for _, version := range versions {
+		matched := false
+		for i := range prerequisites {
+			if isRuntimePrerequisite(prerequisites[i].Name, version.Name) {
+				prerequisites[i].Version = version.Version
+				matched = true
+			}
+		}
+		if !matched {
+			prerequisites = append(prerequisites, Prerequisite{
+				Name:        version.Name,
+				Description: "Version pinned in " + version.Source,
+				Version:     version.Version,
+			})
+		}
+	}
+
+	analysis.Prerequisites = prerequisites
+	return analysis
+}
+
+// isRuntimePrerequisite reports whether a prerequisite name such as "Node.js 18" refers to the given runtime
+func isRuntimePrerequisite(prerequisite, runtime string) bool {
+	fields := strings.Fields(strings.ToLower(prerequisite))
+	if len(fields) == 0 {
+		return false
+	}
+	if fields[0] == strings.ToLower(runtime) {
+		return true
+	}
+	for _, alias := range runtimeAliases[runtime] {
+		if fields[0] == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// packageScriptRunner returns the "run" prefix for the repository's JavaScript package manager
+func packageScriptRunner(repo *git.Repository) string {
+	stack, _ := repo.DetectStack()
+	for _, tech := range stack {
+		switch tech.PackageManager {
+		case "yarn", "pnpm", "bun":
+			return tech.PackageManager + " run"
+		}
+	}
+	return "npm run"
+}
+
+// scriptFromCommand extracts the script name from commands like "npm run dev" or "yarn run build"
+func scriptFromCommand(command string) (string, bool) {
+	fields := strings.Fields(command)
+	if len(fields) < 3 || fields[1] != "run" {
+		return "", false
+	}
+	switch fields[0] {
+	case "npm", "yarn", "pnpm", "bun":
+		return fields[2], true
+	}
+	return "", false
+}
+
+// buildTroubleshootPrompt builds the troubleshooting prompt shared by all providers
+func buildTroubleshootPrompt(errorMessage, contextStr string) string {
+	return fmt.Sprintf("I encountered this error while working with a repository:\n\n%s\n\nContext: %s\n\nPlease provide troubleshooting steps and a potential solution.", errorMessage, contextStr)
+}
+
+// codeFencePattern matches a markdown code block, with or without a language tag
+var codeFencePattern = regexp.MustCompile("```[A-Za-z]*\\s*([\\s\\S]*?)```")
+
+// extractJSONObject pulls a JSON object out of a model response that wraps it in a markdown code block
+// or surrounds it with prose, which smaller and local models often do despite instructions
+func extractJSONObject(content string) (string, bool) {
+	if match := codeFencePattern.FindStringSubmatch(content); len(match) > 1 {
+		content = match[1]
+	}
+
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end <= start {
+		return "", false
+	}
+	return content[start : end+1], true
+}
+
+// parseAnalysisResponse converts a model response into a RepositoryAnalysis
+func parseAnalysisResponse(content string) (RepositoryAnalysis, error) {
+	// Parse the response into structured data
+	var jsonResponse struct {
+		Description   string        `json:"description"`
+		Commands      []Command      `json:"commands"`
+		Prerequisites []Prerequisite `json:"prerequisites"`
+	}
+
+	// Try to parse the content as JSON
+	err := json.Unmarshal([]byte(content), &jsonResponse)
+	if err != nil {
+		// If we failed to parse the JSON, the response might be wrapped in a code block or surrounded by prose
+		if jsonContent, found := extractJSONObject(content); found {
+			err = json.Unmarshal([]byte(jsonContent), &jsonResponse)
+		}
+
+		// If we still failed, return an error
+		if err != nil {
+			return RepositoryAnalysis{}, fmt.Errorf("failed to parse AI response as JSON: %w", err)
+		}
+	}
+
+	// Convert the parsed JSON to our RepositoryAnalysis struct
+	commands := normalizeCommands(jsonResponse.Commands)
+	analysis := RepositoryAnalysis{
+		Description:   jsonResponse.Description,
+		CommandsToRun: commands,
+		Prerequisites: jsonResponse.Prerequisites,
+		Setup:         commandStrings(commands), // The bare command lines, kept for compatibility
+	}
+
+	log.Printf("Extracted Setup Instructions: %v", analysis.Setup)
+	log.Printf("Extracted Commands: %v", analysis.CommandsToRun)
+	log.Printf("Extracted Prerequisites: %v", analysis.Prerequisites)
+
+	return analysis, nil
+}
+
+// normalizeCommands makes suggested commands directly executable: it strips markdown backticks and
+// shell prompt prefixes, collapses runs of whitespace outside quotes, cleans up working directories,
+// and drops empty and duplicate commands
+func normalizeCommands(commands []Command) []Command {
+	normalized := make([]Command, 0, len(commands))
+	seen := make(map[Command]bool)
+	for _, command := range commands {
+		command = Command{Cmd: normalizeCommand(command.Cmd), WorkingDir: normalizeWorkingDir(command.WorkingDir)}
+		if command.Cmd == "" || seen[command] {
+			continue
+		}
+		seen[command] = true
+		normalized = append(normalized, command)
+	}
+	return normalized
+}
+
+// normalizeWorkingDir turns a suggested working directory into a clean path relative to the repository
+// root, with "" for the root. Directories outside the repository fall back to the root.
+func normalizeWorkingDir(dir string) string {
+	dir = strings.TrimSpace(strings.ReplaceAll(dir, "\\", "/"))
+	if dir == "" {
+		return ""
+	}
+
+	cleaned := path.Clean(dir)
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		log.Printf("Ignoring working directory outside the repository: %s", dir)
+		return ""
+	}
+	if cleaned == "." {
+		return ""
+	}
+	return cleaned
+}
+
+// codeFenceLanguages are the language tags a fenced command may start with, as in "```bash\nnpm install```"
+var codeFenceLanguages = map[string]bool{"bash": true, "sh": true, "shell": true, "console": true, "zsh": true, "powershell": true, "cmd": true}
+
+// normalizeCommand cleans up a single suggested command such as "`$ npm  install`"
+func normalizeCommand(command string) string {
+	command = strings.TrimSpace(strings.Trim(strings.TrimSpace(command), "`"))
+	if tag, rest, found := strings.Cut(command, "\n"); found && codeFenceLanguages[strings.TrimSpace(tag)] {
+		command = strings.TrimSpace(rest)
+	}
+
+	// "$ npm install" and "# apt-get install" are copied from shell prompts; "$HOME/bin/tool" is not
+	for len(command) > 1 && (command[0] == '$' || command[0] == '#') && (command[1] == ' ' || command[1] == '\t') {
+		command = strings.TrimSpace(command[1:])
+	}
+
+	return collapseWhitespace(command)
+}
+
+// collapseWhitespace replaces each run of whitespace with a single space, leaving quoted text untouched
+func collapseWhitespace(command string) string {
+	var builder strings.Builder
+	var quote rune
+	pendingSpace := false
+	for _, r := range command {
+		if quote == 0 && unicode.IsSpace(r) {
+			pendingSpace = true
+			continue
+		}
+		if pendingSpace {
+			builder.WriteByte(' ')
+			pendingSpace = false
+		}
+		switch {
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case r == quote:
+			quote = 0
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
@@ -0,0 +1,153 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prathyushnallamothu/startit/backend/internal/git"
+)
+
+// AIProvider is implemented by every AI backend that can analyze repositories
+type AIProvider interface {
+	// AnalyzeRepository extracts a description, prerequisites and setup commands from a repository
+	AnalyzeRepository(ctx context.Context, repo *git.Repository, opts AnalysisOptions) (RepositoryAnalysis, error)
+	// TroubleshootError generates troubleshooting instructions for an error, reporting token usage when known.
+	// history holds the prior turns of a conversation, oldest first, and may be empty. The request is
+	// abandoned when ctx is cancelled or its deadline passes.
+	TroubleshootError(ctx context.Context, errorMessage, contextStr string, history []ConversationTurn) (string, *TokenUsage, error)
+}
+
+// TroubleshootTimeout bounds how long a troubleshooting request may wait for the provider, retries included
+var TroubleshootTimeout = 2 * time.Minute
+
+// DefaultAnalysisLanguage is the language used for analysis output when none is requested
+const DefaultAnalysisLanguage = "English"
+
+// AnalysisOptions tunes how a repository analysis is generated
+type AnalysisOptions struct {
+	// Language is the human language for the description and prerequisite descriptions;
+	// commands are always returned verbatim. Empty means DefaultAnalysisLanguage.
+	Language string
+	// Instructions is optional extra guidance from the user, such as "focus on the Docker setup".
+	// It is appended to the prompt before the output format is restated, so it cannot change the JSON contract.
+	Instructions string
+	// Model overrides the provider's configured model for this analysis only. Empty uses the default;
+	// other values must be listed in AI_ALLOWED_MODELS, see IsAllowedModel.
+	Model string
+	// OnProgress, when set, is called as each stage of the analysis starts or completes, with one of the
+	// Progress stages and a human-readable message. It is called on the analyzing goroutine.
+	OnProgress func(stage, message string)
+}
+
+// Analysis stages reported to AnalysisOptions.OnProgress
+const (
+	ProgressCached          = "cached"           // A cached analysis of the same commit was found
+	ProgressReadingFiles    = "reading_files"    // Reading the README, Makefile and setup documentation
+	ProgressHeuristics      = "heuristics"       // No documentation, so commands are inferred from manifest files
+	ProgressScanningTree    = "scanning_tree"    // Walking the directory structure
+	ProgressDetectedStack   = "detected_stack"   // Languages and package managers were detected
+	ProgressCallingModel    = "calling_model"    // Waiting for the model, usually the slowest stage
+	ProgressParsingResponse = "parsing_response" // Extracting the commands from the model's answer
+)
+
+// progress reports an analysis stage to OnProgress, if set
+func (o AnalysisOptions) progress(stage, format string, args ...interface{}) {
+	if o.OnProgress != nil {
+		o.OnProgress(stage, fmt.Sprintf(format, args...))
+	}
+}
+
+// modelOr returns the requested model override, or defaultModel when there is none
+func (o AnalysisOptions) modelOr(defaultModel string) string {
+	if model := strings.TrimSpace(o.Model); model != "" {
+		return model
+	}
+	return defaultModel
+}
+
+// language returns the requested output language, falling back to DefaultAnalysisLanguage
+func (o AnalysisOptions) language() string {
+	if language := strings.TrimSpace(o.Language); language != "" {
+		return language
+	}
+	return DefaultAnalysisLanguage
+}
+
+// TroubleshootStreamer is implemented by providers that can stream troubleshooting advice as it is generated
+type TroubleshootStreamer interface {
+	// TroubleshootErrorStream passes each chunk of advice to onChunk and returns the assembled text
+	TroubleshootErrorStream(ctx context.Context, errorMessage, contextStr string, history []ConversationTurn, onChunk func(string)) (string, error)
+}
+
+// providerKeyEnv maps each supported provider to the environment variable holding its API key;
+// an empty name means the provider needs no key
+var providerKeyEnv = map[string]string{
+	"openai":    "OPENAI_API_KEY",
+	"anthropic": "ANTHROPIC_API_KEY",
+	"ollama":    "",
+}
+
+// IsAllowedModel reports whether model may be requested as a per-analysis override. Overrides are
+// limited to the comma-separated AI_ALLOWED_MODELS so clients can't run up costs on arbitrary models;
+// when it is unset, no overrides are allowed.
+func IsAllowedModel(model string) bool {
+	for _, allowed := range strings.Split(os.Getenv("AI_ALLOWED_MODELS"), ",") {
+		if allowed = strings.TrimSpace(allowed); allowed != "" && allowed == model {
+			return true
+		}
+	}
+	return false
+}
+
+// providerName returns the normalized AI_PROVIDER value, defaulting to openai
+func providerName() string {
+	provider := strings.ToLower(strings.TrimSpace(os.Getenv("AI_PROVIDER")))
+	if provider == "" {
+		return "openai"
+	}
+	return provider
+}
+
+// CheckProviderConfig verifies that the configured AI provider is supported and has its API key set,
+// without creating a client
+func CheckProviderConfig() error {
+	provider := providerName()
+	keyEnv, ok := providerKeyEnv[provider]
+	if !ok {
+		return fmt.Errorf("unsupported AI_PROVIDER: %s", provider)
+	}
+	if keyEnv != "" && os.Getenv(keyEnv) == "" {
+		return fmt.Errorf("%s environment variable is not set", keyEnv)
+	}
+	return nil
+}
+
+// NewAIProvider creates the provider selected by the AI_PROVIDER environment variable.
+// Supported values are "openai" (the default), "anthropic" and "ollama".
+func NewAIProvider() (AIProvider, error) {
+	switch provider := providerName(); provider {
+	case "openai":
+		service, err := NewOpenAIService()
+		if err != nil {
+			return nil, err
+		}
+		return service, nil
+	case "anthropic":
+		service, err := NewAnthropicService()
+		if err != nil {
+			return nil, err
+		}
+		return service, nil
+	case "ollama":
+		service, err := NewOllamaService()
+		if err != nil {
+			return nil, err
+		}
+		return service, nil
+	default:
+		return nil, fmt.Errorf("unsupported AI_PROVIDER: %s", provider)
+	}
+}
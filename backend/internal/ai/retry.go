@@ -0,0 +1,80 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+const (
+	// defaultMaxAttempts is how many times a transient OpenAI failure is attempted in total
+	defaultMaxAttempts = 3
+	// retryBaseDelay is the backoff before the second attempt; it doubles on each retry
+	retryBaseDelay = 500 * time.Millisecond
+	// retryMaxDelay caps the backoff between attempts
+	retryMaxDelay = 10 * time.Second
+)
+
+// maxAttemptsFromEnv reads OPENAI_MAX_ATTEMPTS, falling back to defaultMaxAttempts
+func maxAttemptsFromEnv() int {
+	value := os.Getenv("OPENAI_MAX_ATTEMPTS")
+	if value == "" {
+		return defaultMaxAttempts
+	}
+	attempts, err := strconv.Atoi(value)
+	if err != nil || attempts < 1 {
+		log.Printf("Warning: Invalid OPENAI_MAX_ATTEMPTS %q, using default of %d", value, defaultMaxAttempts)
+		return defaultMaxAttempts
+	}
+	return attempts
+}
+
+// withRetry runs call up to maxAttempts times, backing off exponentially with jitter while the
+// error is a rate limit or server error. It stops early when ctx is cancelled.
+func withRetry(ctx context.Context, maxAttempts int, call func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = call()
+		if err == nil || attempt >= maxAttempts || !isRetryableError(err) {
+			return err
+		}
+
+		delay := retryDelay(attempt)
+		log.Printf("OpenAI request failed (attempt %d/%d), retrying in %s: %v", attempt, maxAttempts, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// isRetryableError reports whether an OpenAI error is worth retrying (429 or 5xx)
+func isRetryableError(err error) bool {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+}
+
+// retryDelay returns the exponential backoff for the given attempt, randomized by ±25% so
+// concurrent clients don't retry in lockstep
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << (attempt - 1)
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay)/2 + 1))
+	return delay*3/4 + jitter
+}
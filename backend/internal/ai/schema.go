@@ -0,0 +1,82 @@
+package ai
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+// analysisSchemaName identifies the analysis schema in structured-output requests
+const analysisSchemaName = "repository_analysis"
+
+// analysisSchema is the JSON schema for the analysis response, matching what parseAnalysisResponse reads.
+// Strict structured outputs require every property to be listed as required and no extra properties.
+var analysisSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"description": map[string]interface{}{
+			"type":        "string",
+			"description": "A concise description of what this repository/project is",
+		},
+		"prerequisites": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name":           map[string]interface{}{"type": "string"},
+					"description":    map[string]interface{}{"type": "string"},
+					"installCommand": map[string]interface{}{"type": "string"},
+					"checkCommand": map[string]interface{}{
+						"type":        "string",
+						"description": "Command that prints the installed version, such as node --version; empty if there is none",
+					},
+				},
+				"required":             []string{"name", "description", "installCommand", "checkCommand"},
+				"additionalProperties": false,
+			},
+		},
+		"commands": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"cmd": map[string]interface{}{"type": "string"},
+					"workingDir": map[string]interface{}{
+						"type":        "string",
+						"description": "Directory to run the command in, relative to the repository root; empty for the root",
+					},
+				},
+				"required":             []string{"cmd", "workingDir"},
+				"additionalProperties": false,
+			},
+		},
+	},
+	"required":             []string{"description", "prerequisites", "commands"},
+	"additionalProperties": false,
+}
+
+// analysisResponseFormat asks the model to return JSON that follows analysisSchema
+func analysisResponseFormat() openai.ChatCompletionNewParamsResponseFormatUnion {
+	return openai.ResponseFormatJSONSchemaParam{
+		Type: openai.F(openai.ResponseFormatJSONSchemaTypeJSONSchema),
+		JSONSchema: openai.F(openai.ResponseFormatJSONSchemaJSONSchemaParam{
+			Name:        openai.F(analysisSchemaName),
+			Description: openai.F("Repository description, prerequisites and setup commands"),
+			Schema:      openai.F[interface{}](analysisSchema),
+			Strict:      openai.Bool(true),
+		}),
+	}
+}
+
+// isResponseFormatUnsupported reports whether OpenAI rejected the request because the model
+// does not support structured outputs
+func isResponseFormatUnsupported(err error) bool {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+	// This SDK version doesn't always decode the nested error body, but Error() includes it verbatim
+	return apiErr.Param == "response_format" || strings.Contains(apiErr.Error(), "response_format")
+}
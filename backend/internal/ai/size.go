@@ -0,0 +1,52 @@
+package ai
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/prathyushnallamothu/startit/backend/internal/git"
+)
+
+const (
+	// defaultMaxAnalysisFiles is how many tracked files a repository may have before the analysis
+	// stops walking its directory tree in depth
+	defaultMaxAnalysisFiles = 50000
+	// defaultTreeDepth and largeRepositoryTreeDepth are how many directory levels the prompt shows
+	defaultTreeDepth         = 3
+	largeRepositoryTreeDepth = 1
+)
+
+// maxAnalysisFilesFromEnv reads ANALYSIS_MAX_FILES, falling back to defaultMaxAnalysisFiles
+func maxAnalysisFilesFromEnv() int {
+	value := os.Getenv("ANALYSIS_MAX_FILES")
+	if value == "" {
+		return defaultMaxAnalysisFiles
+	}
+	files, err := strconv.Atoi(value)
+	if err != nil || files < 1 {
+		log.Printf("Warning: Invalid ANALYSIS_MAX_FILES %q, using default of %d", value, defaultMaxAnalysisFiles)
+		return defaultMaxAnalysisFiles
+	}
+	return files
+}
+
+// directoryScanDepth decides how deep to walk the repository for the prompt's directory tree. Repositories
+// tracking more than ANALYSIS_MAX_FILES files, such as ones with committed binaries or vendored trees,
+// only get their top level scanned; the returned warning explains why the tree is shallow.
+func directoryScanDepth(repo *git.Repository) (int, string) {
+	count, err := repo.CountTrackedFiles()
+	if err != nil {
+		// Without a file count there is nothing to guard against; keep the usual depth
+		return defaultTreeDepth, ""
+	}
+
+	limit := maxAnalysisFilesFromEnv()
+	if count <= limit {
+		return defaultTreeDepth, ""
+	}
+
+	log.Printf("Repository %s tracks %d files (limit %d), scanning only its top-level directory", repo.LocalDir, count, limit)
+	return largeRepositoryTreeDepth, fmt.Sprintf("The repository tracks %d files, more than the limit of %d, so only its top-level directory was scanned.", count, limit)
+}
@@ -0,0 +1,89 @@
+package ai
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// defaultContentTokenBudget is how many tokens of repository content go into the analysis prompt.
+	// It leaves room for the instructions and the response in a 32k context window.
+	defaultContentTokenBudget = 12000
+	// charsPerToken is a rough average used to turn token budgets into character limits
+	charsPerToken = 4
+	// makefileBudgetShare, treeBudgetShare and docsBudgetShare are the fractions of the budget reserved for the
+	// Makefile, directory tree and other setup documentation; the README gets the rest, including anything they leave unused
+	makefileBudgetShare = 0.15
+	treeBudgetShare     = 0.20
+	docsBudgetShare     = 0.25
+)
+
+// promptSections is the repository content that goes into the analysis prompt
+type promptSections struct {
+	readme   string
+	makefile string
+	tree     string
+	docs     string
+}
+
+// contentTokenBudgetFromEnv reads ANALYSIS_MAX_CONTENT_TOKENS, falling back to defaultContentTokenBudget
+func contentTokenBudgetFromEnv() int {
+	value := os.Getenv("ANALYSIS_MAX_CONTENT_TOKENS")
+	if value == "" {
+		return defaultContentTokenBudget
+	}
+	tokens, err := strconv.Atoi(value)
+	if err != nil || tokens < 1 {
+		log.Printf("Warning: Invalid ANALYSIS_MAX_CONTENT_TOKENS %q, using default of %d", value, defaultContentTokenBudget)
+		return defaultContentTokenBudget
+	}
+	return tokens
+}
+
+// fitToBudget truncates the sections so together they stay within roughly tokenBudget tokens.
+// The Makefile, tree and docs are capped at their shares first so the README keeps as much as possible.
+func (s promptSections) fitToBudget(tokenBudget int) promptSections {
+	budget := tokenBudget * charsPerToken
+
+	s.makefile = truncateSection("Makefile", s.makefile, int(float64(budget)*makefileBudgetShare))
+	s.tree = truncateSection("directory structure", s.tree, int(float64(budget)*treeBudgetShare))
+	s.docs = truncateSection("documentation", s.docs, int(float64(budget)*docsBudgetShare))
+	s.readme = truncateSection("README", s.readme, budget-len(s.makefile)-len(s.tree)-len(s.docs))
+
+	return s
+}
+
+// truncateSection cuts content to at most limit bytes, ending on a line boundary when possible
+// and appending a marker so the model knows the section is incomplete
+func truncateSection(name, content string, limit int) string {
+	if len(content) <= limit {
+		return content
+	}
+
+	// Leave room for the marker; it is never longer than when showing the full length
+	keep := limit - len(truncationMarker(name, len(content), len(content)))
+	if keep <= 0 {
+		return ""
+	}
+	// Don't split a multi-byte character
+	for keep > 0 && !utf8.RuneStart(content[keep]) {
+		keep--
+	}
+
+	cut := content[:keep]
+	if newline := strings.LastIndex(cut, "\n"); newline > keep/2 {
+		cut = cut[:newline]
+	}
+
+	log.Printf("Truncated %s from %d to %d bytes to fit the prompt budget", name, len(content), len(cut))
+	return cut + truncationMarker(name, len(cut), len(content))
+}
+
+// truncationMarker tells the model how much of a section was left out
+func truncationMarker(name string, shown, total int) string {
+	return fmt.Sprintf("\n... [%s truncated: showing %d of %d bytes]", name, shown, total)
+}
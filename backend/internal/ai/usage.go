@@ -0,0 +1,71 @@
+package ai
+
+import (
+	"strings"
+)
+
+// TokenUsage reports the tokens consumed by a model call and its estimated cost
+type TokenUsage struct {
+	Model            string   `json:"model"`
+	PromptTokens     int64    `json:"promptTokens"`
+	CompletionTokens int64    `json:"completionTokens"`
+	EstimatedCostUSD *float64 `json:"estimatedCostUsd,omitempty"` // Omitted for models missing from the price table
+}
+
+// modelPrice is the USD price per million prompt and completion tokens
+type modelPrice struct {
+	prompt     float64
+	completion float64
+}
+
+// modelPrices maps model name prefixes to their list prices; the longest matching prefix wins,
+// so dated snapshots such as gpt-4o-2024-08-06 use their family's price
+var modelPrices = map[string]modelPrice{
+	"gpt-4o-mini":       {0.15, 0.60},
+	"gpt-4o":            {2.50, 10.00},
+	"gpt-4.1-nano":      {0.10, 0.40},
+	"gpt-4.1-mini":      {0.40, 1.60},
+	"gpt-4.1":           {2.00, 8.00},
+	"gpt-4-turbo":       {10.00, 30.00},
+	"gpt-3.5-turbo":     {0.50, 1.50},
+	"o3-mini":           {1.10, 4.40},
+	"o1-mini":           {1.10, 4.40},
+	"o1":                {15.00, 60.00},
+	"claude-3-5-haiku":  {0.80, 4.00},
+	"claude-3-5-sonnet": {3.00, 15.00},
+	"claude-3-7-sonnet": {3.00, 15.00},
+	"claude-3-haiku":    {0.25, 1.25},
+	"claude-3-opus":     {15.00, 75.00},
+}
+
+// newTokenUsage builds a usage report for model, estimating the cost when the model's price is known
+func newTokenUsage(model string, promptTokens, completionTokens int64) *TokenUsage {
+	usage := &TokenUsage{
+		Model:            model,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+	}
+
+	if price, ok := lookupModelPrice(model); ok {
+		cost := (float64(promptTokens)*price.prompt + float64(completionTokens)*price.completion) / 1_000_000
+		usage.EstimatedCostUSD = &cost
+	}
+
+	return usage
+}
+
+// lookupModelPrice finds the price for the longest model prefix matching the given model name
+func lookupModelPrice(model string) (modelPrice, bool) {
+	model = strings.ToLower(model)
+
+	var best string
+	for prefix := range modelPrices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return modelPrice{}, false
+	}
+	return modelPrices[best], true
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuthMiddleware guards admin endpoints with the ADMIN_TOKEN environment variable, which clients
+// send as "Authorization: Bearer <token>". Admin endpoints are disabled while ADMIN_TOKEN is unset.
+func AdminAuthMiddleware() gin.HandlerFunc {
+	token := strings.TrimSpace(os.Getenv("ADMIN_TOKEN"))
+
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, Response{
+				Success: false,
+				Error:   "Admin endpoints are disabled; set ADMIN_TOKEN to enable them",
+			})
+			return
+		}
+
+		provided, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, Response{
+				Success: false,
+				Error:   "Missing or invalid admin token",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -1,20 +1,78 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 
+	"github.com/prathyushnallamothu/startit/backend/internal/ai"
 	"github.com/prathyushnallamothu/startit/backend/internal/executor"
+	"github.com/prathyushnallamothu/startit/backend/internal/metrics"
 )
 
 // BackgroundCommandRequest represents a request to execute a command in the background
 type BackgroundCommandRequest struct {
-	Command  string `json:"command" binding:"required"`
-	RepoPath string `json:"repoPath" binding:"required"`
+	Command        string `json:"command" binding:"required"`
+	RepoPath       string `json:"repoPath" binding:"required"`
+	TimeoutSeconds int    `json:"timeoutSeconds"`
+	UseRepoEnv     bool   `json:"useRepoEnv"`  // Load the repository's .env into the command's environment
+	CaptureLogs    bool   `json:"captureLogs"` // Also write combined output to a log file for /command-status/:id/logs
+	CallbackURL    string `json:"callbackUrl"` // Receives a POST with the final result once the command finishes
+	KeepANSI       bool   `json:"keepAnsi"`    // Keep ANSI color and cursor sequences in the output instead of stripping them
+	ResourceLimitsRequest
 }
 
+// BackgroundCommandResponse identifies a command started in the background
+type BackgroundCommandResponse struct {
+	CommandID string `json:"commandId"`
+	URL       string `json:"url,omitempty"`       // Background clones only
+	LocalPath string `json:"localPath,omitempty"` // Background clones only
+}
+
+// CommandListResponse is a page of background commands, newest first
+type CommandListResponse struct {
+	Commands []executor.CommandSummary `json:"commands"`
+	Total    int                       `json:"total"` // Commands matching the filters, across all pages
+	Limit    int                       `json:"limit"`
+	Offset   int                       `json:"offset"`
+	Counts   executor.CommandCounts    `json:"counts"`
+}
+
+// CancelAllResponse reports how many commands were cancelled and removed
+type CancelAllResponse struct {
+	Cancelled int `json:"cancelled"`
+	Removed   int `json:"removed"`
+}
+
+// CancelCommandResponse confirms that a background command was cancelled
+type CancelCommandResponse struct {
+	CommandID string                 `json:"commandId"`
+	Status    executor.CommandStatus `json:"status"`
+}
+
+// Long-poll limits for HandleWaitForCommand
+const (
+	defaultCommandWaitTimeout = 30 * time.Second
+	maxCommandWaitTimeout     = 5 * time.Minute
+)
+
+// Page size limits for HandleListCommands
+const (
+	defaultCommandListLimit = 50
+	maxCommandListLimit     = 500
+)
+
+// commandLogsDirName is the directory under the repository base where background command logs are written
+const commandLogsDirName = "command-logs"
+
 // HandleExecuteBackgroundCommand handles a request to execute a command in the background
 func HandleExecuteBackgroundCommand(c *gin.Context) {
 	var req BackgroundCommandRequest
@@ -35,29 +93,341 @@ func HandleExecuteBackgroundCommand(c *gin.Context) {
 		return
 	}
 
+	if req.CallbackURL != "" {
+		if err := executor.ValidateCallbackURL(req.CallbackURL); err != nil {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	env, ok := loadRepoEnv(c, req.RepoPath, req.UseRepoEnv)
+	if !ok {
+		return
+	}
+	limits, ok := resolveResourceLimits(c, req.ResourceLimitsRequest)
+	if !ok {
+		return
+	}
+	runAs, ok := resolveRunAs(c, req.RunAs)
+	if !ok {
+		return
+	}
+
 	// Get the background command manager
 	bgManager := executor.GetBackgroundManager()
 
+	opts := executor.BackgroundOptions{Env: env, Limits: limits, RunAs: runAs, KeepANSI: req.KeepANSI, CallbackURL: req.CallbackURL}
+	if req.CaptureLogs {
+		opts.LogPath = filepath.Join(reposBaseDir(), commandLogsDirName, uuid.New().String()+".log")
+	}
+
 	// Execute the command in the background
-	commandID := bgManager.ExecuteCommandInBackground(req.Command, req.RepoPath)
+	timeout := resolveCommandTimeout(req.TimeoutSeconds, executor.DefaultBackgroundTimeout)
+	commandID, err := bgManager.ExecuteCommandInBackground(req.Command, req.RepoPath, timeout, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   "Failed to start command: " + err.Error(),
+		})
+		return
+	}
 
 	// Return the command ID to the client
 	c.JSON(http.StatusOK, Response{
 		Success: true,
-		Data: map[string]interface{}{
-			"commandId": commandID,
+		Data:    BackgroundCommandResponse{CommandID: commandID},
+	})
+}
+
+// HandleBackgroundClone handles a request to clone a repository in the background. The returned
+// command ID works with the command status, stream and cancel endpoints; git's progress is reported as output.
+func HandleBackgroundClone(c *gin.Context) {
+	var req CloneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	// Refreshing is quick and synchronous, so it is only offered by the regular clone endpoint
+	if req.Refresh {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Refresh is not supported for background clones",
+		})
+		return
+	}
+
+	// Work out where the repository goes
+	destPath, ok := resolveCloneDestination(c, req)
+	if !ok {
+		return
+	}
+
+	// An existing workspace or destination holding the same repository is reused by the clone itself,
+	// so retrying a background clone is safe
+	repo := newCloneRepository(req, destPath)
+
+	commandID := executor.GetBackgroundManager().RunInBackground("git clone "+req.URL, destPath, repo.Timeout,
+		func(ctx context.Context, onStdout, onStderr func(string)) (*executor.CommandResult, error) {
+			startTime := time.Now()
+			repo.SetProgressCallback(func(line string) {
+				onStdout(line + "\n")
+			})
+
+			if err := repo.CloneContext(ctx); err != nil {
+				metrics.Clones.Inc(metrics.ResultFailure)
+				return nil, err
+			}
+			metrics.Clones.Inc(metrics.ResultSuccess)
+
+			output := "Cloned into " + destPath
+			if repo.Reused() {
+				output = "Reused the existing clone in " + destPath
+			}
+
+			endTime := time.Now()
+			return &executor.CommandResult{
+				Command:   "git clone",
+				Args:      req.URL,
+				Output:    output,
+				StartTime: startTime,
+				EndTime:   endTime,
+				Duration:  endTime.Sub(startTime).String(),
+			}, nil
+		})
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data: BackgroundCommandResponse{
+			CommandID: commandID,
+			URL:       req.URL,
+			LocalPath: destPath,
+		},
+	})
+}
+
+// HandleListCommands handles a request to list background commands, newest first. ?status= and ?since=
+// (an RFC 3339 start time) filter the list, and ?limit= and ?offset= page through it.
+func HandleListCommands(c *gin.Context) {
+	statusFilter := c.Query("status")
+
+	var since time.Time
+	if value := c.Query("since"); value != "" {
+		var err error
+		if since, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "since must be an RFC 3339 timestamp, e.g. 2024-01-02T15:04:05Z",
+			})
+			return
+		}
+	}
+
+	limit := defaultCommandListLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxCommandListLimit {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   fmt.Sprintf("limit must be between 1 and %d", maxCommandListLimit),
+			})
+			return
+		}
+		limit = n
+	}
+	offset, ok := queryOffset(c, "offset")
+	if !ok {
+		return
+	}
+
+	manager := executor.GetBackgroundManager()
+	commands := manager.ListCommands()
+	filtered := make([]executor.CommandSummary, 0, len(commands))
+	for _, cmd := range commands {
+		if statusFilter != "" && string(cmd.Status) != statusFilter {
+			continue
+		}
+		if cmd.StartTime.Before(since) {
+			continue
+		}
+		filtered = append(filtered, cmd)
+	}
+
+	// Page through the matches; total counts all of them
+	total := len(filtered)
+	start := min(offset, total)
+	page := filtered[start:min(start+limit, total)]
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data: CommandListResponse{
+			Commands: page,
+			Total:    total,
+			Limit:    limit,
+			Offset:   offset,
+			Counts:   manager.CountCommands(),
 		},
 	})
 }
 
+// HandleCancelAllCommands cancels every pending and running background command. With
+// ?clearCompleted=true, commands that had already finished are removed along with their logs too.
+func HandleCancelAllCommands(c *gin.Context) {
+	manager := executor.GetBackgroundManager()
+	cancelled := manager.CancelAll()
+
+	// Commands cancelled just now are still winding down, so only earlier ones are removed
+	removed := 0
+	if c.Query("clearCompleted") == "true" {
+		removed = manager.CleanupCompletedCommands(0)
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    CancelAllResponse{Cancelled: cancelled, Removed: removed},
+	})
+}
+
+// HandleCancelCommand handles a request to cancel a running background command
+func HandleCancelCommand(c *gin.Context) {
+	commandID := c.Param("id")
+
+	err := executor.GetBackgroundManager().CancelCommand(commandID)
+	if errors.Is(err, executor.ErrCommandNotFound) {
+		c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Error:   "Command not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, Response{
+			Success: false,
+			Error:   "Failed to cancel command: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    CancelCommandResponse{CommandID: commandID, Status: executor.StatusCancelled},
+	})
+}
+
+// HandleStreamCommandOutput streams a background command's output as server-sent events.
+// Clients receive "stdout" and "stderr" events followed by a final "complete" event.
+func HandleStreamCommandOutput(c *gin.Context) {
+	bgCmd, exists := executor.GetBackgroundManager().GetCommandStatus(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Error:   "Command not found",
+		})
+		return
+	}
+
+	events, unsubscribe := bgCmd.Subscribe()
+	defer unsubscribe()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				// The channel closes once the command finishes
+				if completion, done := bgCmd.CompletionEvent(); done {
+					c.SSEvent(executor.EventComplete, completion)
+				}
+				return false
+			}
+			c.SSEvent(event.Type, event)
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// HandleWaitForCommand blocks until a background command finishes or ?timeout= seconds pass (default 30,
+// at most 300), then responds like the command status endpoint, including its tail and offset options.
+// isCompleted is false when the wait timed out first.
+func HandleWaitForCommand(c *gin.Context) {
+	bgCmd, exists := executor.GetBackgroundManager().GetCommandStatus(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Error:   "Command not found",
+		})
+		return
+	}
+
+	timeout := defaultCommandWaitTimeout
+	if value := c.Query("timeout"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 || time.Duration(seconds)*time.Second > maxCommandWaitTimeout {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   fmt.Sprintf("timeout must be between 0 and %d seconds", int(maxCommandWaitTimeout.Seconds())),
+			})
+			return
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-bgCmd.Done():
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+		// The client went away, so there is nobody to answer
+		return
+	}
+
+	HandleGetCommandStatus(c)
+}
+
+// HandleDownloadCommandLogs sends a background command's log file as an attachment. Only commands
+// started with captureLogs have one; while the command runs, the log written so far is sent.
+func HandleDownloadCommandLogs(c *gin.Context) {
+	bgCmd, exists := executor.GetBackgroundManager().GetCommandStatus(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Error:   "Command not found",
+		})
+		return
+	}
+
+	logPath := bgCmd.LogPath()
+	if logPath == "" || !pathExists(logPath) {
+		c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Error:   "Command has no log file; start it with captureLogs to keep one",
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.FileAttachment(logPath, "command-"+bgCmd.ID+".log")
+}
+
 // Do not redefine HandleGetCommandStatus here, it is already defined in handlers.go
 
-// StartBackgroundCleanupTask starts a background task to clean up completed commands
+// StartBackgroundCleanupTask starts a background task to clean up completed commands and idle conversations
 func StartBackgroundCleanupTask() {
 	go func() {
 		for {
 			// Clean up commands that completed more than 1 hour ago
 			executor.GetBackgroundManager().CleanupCompletedCommands(1 * time.Hour)
+
+			// Forget troubleshooting conversations idle for more than 1 hour
+			ai.CleanupConversations(1 * time.Hour)
 			
 			// Sleep for 10 minutes
 			time.Sleep(10 * time.Minute)
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// branchCacheTTL is how long a remote's branch list is reused before asking the remote again
+const branchCacheTTL = 30 * time.Second
+
+// RepositoryBranchesRequest represents a request to list the branches of a remote repository
+type RepositoryBranchesRequest struct {
+	URL        string `json:"url" binding:"required"`
+	Token      string `json:"token"`
+	SSHKeyPath string `json:"sshKeyPath"`
+}
+
+// RepositoryBranchesResponse lists the branches of a remote repository
+type RepositoryBranchesResponse struct {
+	URL      string   `json:"url"`
+	Branches []string `json:"branches"`
+	Cached   bool     `json:"cached"` // Whether the list was served from the short-lived cache
+}
+
+// branchCacheEntry is a branch list and when it was fetched
+type branchCacheEntry struct {
+	branches  []string
+	fetchedAt time.Time
+}
+
+// branchCache holds recent branch lists keyed by URL and credentials, so a branch selector
+// being opened repeatedly doesn't run git ls-remote every time
+var branchCache = struct {
+	sync.Mutex
+	entries map[string]branchCacheEntry
+}{entries: make(map[string]branchCacheEntry)}
+
+// HandleRepositoryBranches lists the branches of a remote repository without cloning it
+func HandleRepositoryBranches(c *gin.Context) {
+	var req RepositoryBranchesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	if !isValidGitURL(req.URL) {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Invalid git repository URL",
+		})
+		return
+	}
+
+	repo := newRemoteRepository(req.URL, req.Token, req.SSHKeyPath)
+
+	// Key on the credentials too, so branches of a private repository are never served to a caller without access
+	credentialsHash := sha256.Sum256([]byte(repo.Token + "\x00" + repo.SSHKeyPath))
+	key := fmt.Sprintf("%s|%x", req.URL, credentialsHash[:8])
+
+	if branches, found := cachedBranches(key); found {
+		c.JSON(http.StatusOK, Response{
+			Success: true,
+			Data:    RepositoryBranchesResponse{URL: req.URL, Branches: branches, Cached: true},
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), validateTimeout)
+	defer cancel()
+
+	branches, err := repo.ListRemoteBranches(ctx)
+	if err != nil {
+		respondWithRemoteError(c, err)
+		return
+	}
+	cacheBranches(key, branches)
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    RepositoryBranchesResponse{URL: req.URL, Branches: branches},
+	})
+}
+
+// cachedBranches returns the branch list cached under key if it has not expired
+func cachedBranches(key string) ([]string, bool) {
+	branchCache.Lock()
+	defer branchCache.Unlock()
+
+	entry, found := branchCache.entries[key]
+	if !found || time.Since(entry.fetchedAt) > branchCacheTTL {
+		return nil, false
+	}
+	return entry.branches, true
+}
+
+// cacheBranches stores a branch list under key, dropping expired entries so the cache stays small
+func cacheBranches(key string, branches []string) {
+	branchCache.Lock()
+	defer branchCache.Unlock()
+
+	now := time.Now()
+	for k, entry := range branchCache.entries {
+		if now.Sub(entry.fetchedAt) > branchCacheTTL {
+			delete(branchCache.entries, k)
+		}
+	}
+	branchCache.entries[key] = branchCacheEntry{branches: branches, fetchedAt: now}
+}
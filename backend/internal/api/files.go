@@ -0,0 +1,254 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/prathyushnallamothu/startit/backend/internal/git"
+)
+
+const (
+	// maxFileContentBytes caps the size of a file returned by the file endpoint
+	maxFileContentBytes = 1 << 20
+	// defaultTreeDepth and maxTreeDepth bound how deep the tree endpoint walks
+	defaultTreeDepth = 3
+	maxTreeDepth     = 10
+	// defaultSearchResults and maxSearchResults bound how many matching lines a search returns
+	defaultSearchResults = 100
+	maxSearchResults     = 1000
+	// searchTimeout stops searches of huge repositories from tying up the server
+	searchTimeout = 30 * time.Second
+)
+
+// FileResponse is a file from a cloned repository
+type FileResponse struct {
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType"`
+	Binary      bool   `json:"binary"`
+	Content     string `json:"content,omitempty"` // Only for text files
+}
+
+// SearchRequest represents a request to search the contents of a cloned repository's files
+type SearchRequest struct {
+	RepoPath      string `json:"repoPath" binding:"required"`
+	Query         string `json:"query" binding:"required"`
+	Regex         bool   `json:"regex"`         // Treat query as a regular expression (RE2 syntax)
+	CaseSensitive bool   `json:"caseSensitive"` // Searches ignore case by default
+	Path          string `json:"path"`          // Only search below this directory, relative to the repository root
+	MaxResults    int    `json:"maxResults"`    // Defaults to 100, at most 1000
+}
+
+// HandleRepositoryFile handles a request for the content of a single file in a cloned repository.
+// Text files are returned as a string; binary files only report their size and content type.
+func HandleRepositoryFile(c *gin.Context) {
+	repoPath := c.Query("repoPath")
+	relPath := c.Query("path")
+	if repoPath == "" || relPath == "" {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "repoPath and path query parameters are required",
+		})
+		return
+	}
+
+	repo, ok := openRepositoryForRequest(c, repoPath)
+	if !ok {
+		return
+	}
+
+	// Make sure the requested file stays inside the repository
+	fullPath, err := repo.ResolvePath(relPath)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, git.ErrPathOutsideRepository) || errors.Is(err, git.ErrPathInVCSMetadata) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, Response{
+			Success: false,
+			Error:   "Invalid file path: " + err.Error(),
+		})
+		return
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil || info.IsDir() {
+		c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Error:   "File not found: " + relPath,
+		})
+		return
+	}
+
+	if info.Size() > maxFileContentBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, Response{
+			Success: false,
+			Error:   fmt.Sprintf("File is larger than the %d byte limit", maxFileContentBytes),
+		})
+		return
+	}
+
+	content, err := repo.GetFileContent(relPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   "Failed to read file: " + err.Error(),
+		})
+		return
+	}
+
+	// Prefer the extension's type and fall back to sniffing the content
+	contentType := mime.TypeByExtension(filepath.Ext(fullPath))
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+
+	data := FileResponse{
+		Path:        relPath,
+		Size:        info.Size(),
+		ContentType: contentType,
+		Binary:      !utf8.Valid(content),
+	}
+	if !data.Binary {
+		data.Content = string(content)
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    data,
+	})
+}
+
+// HandleRepositoryTree handles a request for a repository's directory tree as nested JSON nodes.
+// The optional depth query parameter limits how many levels are walked.
+func HandleRepositoryTree(c *gin.Context) {
+	repoPath := c.Query("repoPath")
+	if repoPath == "" {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "repoPath query parameter is required",
+		})
+		return
+	}
+
+	depth := defaultTreeDepth
+	if value := c.Query("depth"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxTreeDepth {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   fmt.Sprintf("depth must be between 1 and %d", maxTreeDepth),
+			})
+			return
+		}
+		depth = n
+	}
+
+	repo, ok := openRepositoryForRequest(c, repoPath)
+	if !ok {
+		return
+	}
+
+	tree, err := repo.GetDirectoryTree(depth)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   "Failed to read directory tree: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    tree,
+	})
+}
+
+// HandleRepositorySearch handles a request to search a cloned repository's files for text or a regular
+// expression, returning the matching lines with their paths and line numbers
+func HandleRepositorySearch(c *gin.Context) {
+	var req SearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	maxResults := defaultSearchResults
+	if req.MaxResults != 0 {
+		if req.MaxResults < 1 || req.MaxResults > maxSearchResults {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   fmt.Sprintf("maxResults must be between 1 and %d", maxSearchResults),
+			})
+			return
+		}
+		maxResults = req.MaxResults
+	}
+
+	repo, ok := openRepositoryForRequest(c, req.RepoPath)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), searchTimeout)
+	defer cancel()
+
+	result, err := repo.SearchContent(ctx, req.Query, git.SearchOptions{
+		Regex:         req.Regex,
+		CaseSensitive: req.CaseSensitive,
+		Path:          req.Path,
+		MaxResults:    maxResults,
+	})
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		c.JSON(status, Response{
+			Success: false,
+			Error:   "Search failed: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// openRepositoryForRequest opens the repository at repoPath, writing an error response and returning
+// false if it does not exist or is not a git repository
+func openRepositoryForRequest(c *gin.Context, repoPath string) (*git.Repository, bool) {
+	if !pathExists(repoPath) {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Repository path does not exist",
+		})
+		return nil, false
+	}
+
+	repo, err := git.OpenRepository(repoPath)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Failed to open repository: " + err.Error(),
+		})
+		return nil, false
+	}
+
+	return repo, true
+}
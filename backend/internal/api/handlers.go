@@ -2,21 +2,50 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/prathyushnallamothu/startit/backend/internal/ai"
 	"github.com/prathyushnallamothu/startit/backend/internal/executor"
 	"github.com/prathyushnallamothu/startit/backend/internal/git"
+	"github.com/prathyushnallamothu/startit/backend/internal/logging"
+	"github.com/prathyushnallamothu/startit/backend/internal/metrics"
 )
 
+const (
+	// defaultCommandTimeout applies to foreground commands when the request sets no timeout
+	defaultCommandTimeout = 5 * time.Minute
+	// maxCommandTimeout caps any client-requested timeout
+	maxCommandTimeout = 60 * time.Minute
+	// maxLanguageLength bounds the analysis language name accepted from clients
+	maxLanguageLength = 40
+	// maxInstructionsLength bounds the custom analysis instructions accepted from clients
+	maxInstructionsLength = 4000
+	// maxBatchCommands caps how many commands a single batch request may run
+	maxBatchCommands = 50
+	// troubleshootOutputLines and troubleshootOutputBytes bound how much of a failed command's
+	// stderr and stdout is sent to the model
+	troubleshootOutputLines = 50
+	troubleshootOutputBytes = 8 * 1024
+	// workspacesDirName is the directory under the repository base directory holding named workspaces
+	workspacesDirName = "workspaces"
+)
+
+// workspaceNamePattern restricts workspace names to a single safe path component
+var workspaceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
 // Response represents a standardized API response
 type Response struct {
 	Success bool        `json:"success"`
@@ -24,50 +53,216 @@ type Response struct {
 	Error   string      `json:"error,omitempty"`
 }
 
+// ErrorDetails is the data sent with a failure response that has a machine-readable cause
+type ErrorDetails struct {
+	ErrorCode string `json:"errorCode"` // A git.CloneErrorKind, e.g. repository_not_found
+}
+
 // CloneRequest represents a request to clone a repository
 type CloneRequest struct {
-	URL      string `json:"url" binding:"required"`
-	Branch   string `json:"branch"`
-	DestPath string `json:"destPath"`
+	URL            string `json:"url" binding:"required"`
+	Branch         string `json:"branch"`
+	DestPath       string `json:"destPath"`
+	Depth          int    `json:"depth"`
+	Token          string `json:"token"`
+	Ref            string `json:"ref"`     // Tag or commit SHA; takes precedence over Branch
+	Refresh        bool   `json:"refresh"` // Update an existing clone at DestPath instead of failing
+	Submodules     bool   `json:"submodules"`
+	TimeoutSeconds int    `json:"timeoutSeconds"` // Kill the clone after this long; defaults to git.DefaultCloneTimeout
+	Workspace      string `json:"workspace"`      // Stable name for a persistent clone location; excludes DestPath
+	SSHKeyPath     string `json:"sshKeyPath"`     // Private key file for cloning over SSH instead of HTTPS
+	SingleBranch   bool   `json:"singleBranch"`   // Fetch only the requested branch's refs
+	VCS            string `json:"vcs"`            // "git" or "hg"; detected from the URL when empty
+	Archive        bool   `json:"archive"`        // Download a GitHub source archive instead of cloning; falls back to a clone
+	Proxy          string `json:"proxy"`          // HTTP(S) or SOCKS proxy for the clone; defaults to GIT_PROXY
+	FastForward    bool   `json:"fastForward"`    // Fast-forward an existing clone of the same repository that is reused
+}
+
+// CloneResponse describes a cloned, reused or refreshed repository
+type CloneResponse struct {
+	URL       string `json:"url"`
+	Branch    string `json:"branch"`
+	Ref       string `json:"ref,omitempty"`
+	Workspace string `json:"workspace"`
+	LocalPath string `json:"localPath"`
+	Archive   bool   `json:"archive"`           // Downloaded as a source archive rather than cloned
+	Existing  bool   `json:"existing"`          // An existing clone was reused instead of cloning again
+	Updated   bool   `json:"updated,omitempty"` // An existing clone was refreshed with the latest changes
 }
 
 // AnalyzeRepositoryRequest represents a request to analyze a repository
 type AnalyzeRepositoryRequest struct {
-	RepoPath string `json:"repoPath" binding:"required"`
+	RepoPath     string `json:"repoPath" binding:"required"`
+	Language     string `json:"language"`     // Language for the description and prerequisites; defaults to English
+	Instructions string `json:"instructions"` // Extra guidance for the analysis, e.g. "prefer the Docker setup"
+	Model        string `json:"model"`        // Model to use instead of the provider's default; must be in AI_ALLOWED_MODELS
+	AllowNonGit  bool   `json:"allowNonGit"`  // Analyze a plain directory that is not a git or Mercurial repository
 }
 
 // AnalyzeRepositoryResponse contains the results of repository analysis
 type AnalyzeRepositoryResponse struct {
-	Description   string              `json:"description"`
-	SetupSteps    []string            `json:"setupSteps"`
-	Commands      []string            `json:"commands"`
-	Prerequisites []ai.Prerequisite   `json:"prerequisites"`
+	Commit          string               `json:"commit,omitempty"` // Revision the analysis was produced for
+	Description     string               `json:"description"`
+	SetupSteps      []string             `json:"setupSteps"`
+	Commands        []ai.Command         `json:"commands"` // Each with the directory to run it in, relative to the repository root
+	Prerequisites   []ai.Prerequisite    `json:"prerequisites"`
+	Warnings        []string             `json:"warnings,omitempty"` // Why the analysis may be incomplete, e.g. missing documentation
+	Stack           []git.DetectedTech   `json:"stack"`
+	Services        []git.ComposeService `json:"services,omitempty"`
+	ComposeCommand  string               `json:"composeCommand,omitempty"`
+	TaskRunners     []git.TaskRunner     `json:"taskRunners,omitempty"`     // Taskfile and justfile tasks, for labeling task and just commands
+	CICommands      []git.CICommand      `json:"ciCommands,omitempty"`      // Commands run by GitHub Actions and GitLab CI jobs
+	RequiredEnvVars []string             `json:"requiredEnvVars,omitempty"` // Variables declared in .env.example
+	Cached          bool                 `json:"cached"`
+	Usage           *ai.TokenUsage       `json:"usage,omitempty"` // Only set when the model was actually called
 }
 
 // ExecuteRequest represents a request to execute a command
 type ExecuteRequest struct {
-	Command   string   `json:"command" binding:"required"`
-	Args      []string `json:"args"`
-	Directory string   `json:"directory"`
+	Command        string   `json:"command" binding:"required"`
+	Args           []string `json:"args"`
+	Directory      string   `json:"directory"`
+	RepoPath       string   `json:"repoPath"` // When set, Directory is relative to this repository and may not leave it
+	TimeoutSeconds int      `json:"timeoutSeconds"`
+	DryRun         bool     `json:"dryRun"`
+	UseRepoEnv     bool     `json:"useRepoEnv"` // Load the repository's .env into the command's environment; requires RepoPath
+	KeepANSI       bool     `json:"keepAnsi"`   // Keep ANSI color and cursor sequences in the output instead of stripping them
+	ResourceLimitsRequest
 }
 
 // ExecuteCommandRequest represents a request to execute a command
 type ExecuteCommandRequest struct {
-	Command  string `json:"command" binding:"required"`
-	RepoPath string `json:"repoPath" binding:"required"`
+	Command        string `json:"command" binding:"required"`
+	RepoPath       string `json:"repoPath" binding:"required"`
+	Directory      string `json:"directory"` // Subdirectory of the repository to run in
+	TimeoutSeconds int    `json:"timeoutSeconds"`
+	DryRun         bool   `json:"dryRun"`
+	UseRepoEnv     bool   `json:"useRepoEnv"` // Load the repository's .env into the command's environment
+	KeepANSI       bool   `json:"keepAnsi"`   // Keep ANSI color and cursor sequences in the output instead of stripping them
+	ResourceLimitsRequest
+}
+
+// ExecuteBatchRequest represents a request to run several commands in sequence
+type ExecuteBatchRequest struct {
+	Commands       []string `json:"commands" binding:"required"`
+	RepoPath       string   `json:"repoPath" binding:"required"`
+	StopOnError    bool     `json:"stopOnError"`
+	TimeoutSeconds int      `json:"timeoutSeconds"` // Applies to the whole batch
+	UseRepoEnv     bool     `json:"useRepoEnv"`     // Load the repository's .env into every command's environment
+	KeepANSI       bool     `json:"keepAnsi"`       // Keep ANSI color and cursor sequences in the output instead of stripping them
+	ResourceLimitsRequest
+}
+
+// ResourceLimitsRequest holds the optional memory and CPU limits, and the user to run as, accepted by the
+// command execution requests
+type ResourceLimitsRequest struct {
+	MemoryLimitMB   int    `json:"memoryLimitMB"`   // Maximum memory in megabytes
+	CPULimitPercent int    `json:"cpuLimitPercent"` // CPU quota as a percentage of one core, e.g. 50 or 200
+	RunAs           string `json:"runAs"`           // "user" or "user:group", by name or ID; defaults to RUN_AS_USER
+}
+
+// ExecuteBatchResponse contains the results of a batch, one per command that ran
+type ExecuteBatchResponse struct {
+	Results       []*executor.CommandResult `json:"results"`
+	FailedIndex   int                       `json:"failedIndex"`             // Index into Results of the first failure, or -1
+	FailedCommand string                    `json:"failedCommand,omitempty"` // Command string that failed first
+	Stopped       bool                      `json:"stopped"`                 // Execution halted at the failure because of stopOnError
+	Skipped       int                       `json:"skipped"`                 // Commands never run because of the stop
 }
 
 // ExecuteCommandResponse contains the results of command execution
 type ExecuteCommandResponse struct {
-	Output    string `json:"output"`
+	Command   string    `json:"command"` // Fully resolved command line that was executed
+	Output    string    `json:"output"`
+	ExitCode  int       `json:"exitCode"`
+	Signal    string    `json:"signal,omitempty"` // Set when the command was killed by a signal
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Duration  string    `json:"duration"`
+	Truncated bool      `json:"truncated,omitempty"`
+}
+
+// ExecuteResponse contains the result of /api/execute, with times at second precision
+type ExecuteResponse struct {
+	Command   string `json:"command"`
+	Args      string `json:"args"`
 	ExitCode  int    `json:"exitCode"`
+	Signal    string `json:"signal"`
+	Output    string `json:"output"`
+	Error     string `json:"error"`
+	StartTime string `json:"startTime"` // RFC 3339
+	EndTime   string `json:"endTime"`   // RFC 3339
+	Duration  string `json:"duration"`
+	Truncated bool   `json:"truncated"`
+}
+
+// ExecutionPlanResponse describes how a dry-run command would be executed
+type ExecutionPlanResponse struct {
+	DryRun bool                    `json:"dryRun"`
+	Plan   *executor.ExecutionPlan `json:"plan"`
+}
+
+// CommandStatusResponse contains a background command's status and output
+type CommandStatusResponse struct {
+	CommandID     string                 `json:"commandId"`
+	Status        executor.CommandStatus `json:"status"`
+	StartTime     time.Time              `json:"startTime"`
+	EndTime       *time.Time             `json:"endTime,omitempty"`
+	IsCompleted   bool                   `json:"isCompleted"`
+	HasLogs       bool                   `json:"hasLogs"`
+	CurrentOutput string                 `json:"currentOutput,omitempty"`
+	CurrentError  string                 `json:"currentError,omitempty"`
+	OutputOffset  *int                   `json:"outputOffset,omitempty"` // Only with ?offset= or ?errorOffset=
+	ErrorOffset   *int                   `json:"errorOffset,omitempty"`
+	Result        *CommandStatusResult   `json:"result,omitempty"` // Set once the command finished or timed out
+	Error         string                 `json:"error,omitempty"`
+}
+
+// CommandStatusResult is a background command's final result, with its output limited by the tail
+// and offset options like the current output
+type CommandStatusResult struct {
+	Command   string    `json:"command"`
+	Args      string    `json:"args"`
+	Output    string    `json:"output"`
+	Error     string    `json:"error"`
+	ExitCode  int       `json:"exitCode"`
+	Signal    string    `json:"signal"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Duration  string    `json:"duration"`
+	Truncated bool      `json:"truncated"`
+	TimedOut  bool      `json:"timedOut"`
+}
+
+// TroubleshootResponse contains troubleshooting advice and the conversation to continue it in
+type TroubleshootResponse struct {
+	Solution       string         `json:"solution"`
+	Usage          *ai.TokenUsage `json:"usage,omitempty"` // Not reported by the streaming endpoint
+	ConversationID string         `json:"conversationId"`
+}
+
+// AnalysisProgressEvent is the "progress" event streamed while an analysis runs
+type AnalysisProgressEvent struct {
+	Stage   string `json:"stage"` // One of the ai.Progress* stages
+	Message string `json:"message"`
+}
+
+// TroubleshootChunkEvent is a "chunk" event carrying the next piece of streamed troubleshooting advice
+type TroubleshootChunkEvent struct {
+	Text string `json:"text"`
+}
+
+// StreamErrorEvent is the "error" event that ends a stream which failed
+type StreamErrorEvent struct {
+	Error string `json:"error"`
 }
 
 // TroubleshootRequest represents a request for troubleshooting help
 type TroubleshootRequest struct {
-	Error    string `json:"error" binding:"required"`
-	RepoPath string `json:"repoPath" binding:"required"`
-	Context  string `json:"context"`
+	Error          string `json:"error" binding:"required"`
+	RepoPath       string `json:"repoPath" binding:"required"`
+	Context        string `json:"context"`
+	ConversationID string `json:"conversationId"` // Continue an earlier troubleshooting conversation
 }
 
 
@@ -82,26 +277,146 @@ func HandleRepositoryClone(c *gin.Context) {
 		return
 	}
 
-	// Validate the URL
-	if req.URL == "" || !isValidGitURL(req.URL) {
+	// Work out where the repository goes
+	destPath, ok := resolveCloneDestination(c, req)
+	if !ok {
+		return
+	}
+
+	// Refresh an existing checkout of the same repository instead of re-cloning
+	if req.Refresh && pathExists(destPath) {
+		handleRepositoryRefresh(c, req, destPath)
+		return
+	}
+
+	// A named workspace that already exists is reused as-is
+	if req.Workspace != "" && pathExists(destPath) {
+		handleExistingWorkspace(c, req, destPath)
+		return
+	}
+
+	// Create a new repository instance
+	repo := newCloneRepository(req, destPath)
+
+	// Clone the repository
+	if err := repo.Clone(); err != nil {
+		metrics.Clones.Inc(metrics.ResultFailure)
+		respondWithCloneError(c, err)
+		return
+	}
+	metrics.Clones.Inc(metrics.ResultSuccess)
+
+	// Return the repository details
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data: CloneResponse{
+			URL:       req.URL,
+			Branch:    repo.Branch,
+			Ref:       repo.Ref,
+			Workspace: req.Workspace,
+			LocalPath: destPath,
+			Archive:   repo.IsArchive(),
+			Existing:  repo.Reused(),
+		},
+	})
+}
+
+// resolveCloneDestination validates the clone URL and works out the local path to clone into.
+// It writes an error response and returns false when the request is invalid.
+func resolveCloneDestination(c *gin.Context, req CloneRequest) (string, bool) {
+	// Validate the URL for the version control system it will be cloned with
+	switch cloneVCS(req) {
+	case git.VCSGit:
+		if req.URL == "" || !isValidGitURL(req.URL) {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid git repository URL",
+			})
+			return "", false
+		}
+	case git.VCSMercurial:
+		if _, err := git.NormalizeMercurialURL(req.URL); err != nil {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid Mercurial repository URL",
+			})
+			return "", false
+		}
+	default:
 		c.JSON(http.StatusBadRequest, Response{
 			Success: false,
-			Error:   "Invalid git repository URL",
+			Error:   "vcs must be \"git\" or \"hg\"",
 		})
-		return
+		return "", false
+	}
+
+	// SSH clones authenticate with the key, so a token makes no sense alongside it
+	if req.SSHKeyPath != "" {
+		if req.Token != "" {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "token and sshKeyPath cannot both be set",
+			})
+			return "", false
+		}
+		if info, err := os.Stat(req.SSHKeyPath); err != nil || !info.Mode().IsRegular() {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "SSH key file not found: " + req.SSHKeyPath,
+			})
+			return "", false
+		}
+	}
+
+	if req.Proxy != "" {
+		if err := git.ValidateProxyURL(req.Proxy); err != nil {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return "", false
+		}
 	}
 
 	// Determine destination path
 	destPath := req.DestPath
-	if destPath == "" {
+	if req.Workspace != "" {
+		if destPath != "" {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "workspace and destPath cannot both be set",
+			})
+			return "", false
+		}
+		if !workspaceNamePattern.MatchString(req.Workspace) {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid workspace name: use up to 64 letters, digits, '.', '_' or '-'",
+			})
+			return "", false
+		}
+		// Workspaces map to a fixed directory so the same name always finds the same clone
+		destPath = workspacePath(req.Workspace)
+	} else if destPath != "" {
+		// Client-supplied paths must stay inside the repository base directory
+		resolved, err := resolveDestPath(destPath)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Invalid destination path: " + err.Error(),
+			})
+			return "", false
+		}
+		destPath = resolved
+	} else {
 		// Use a temporary directory
-		tempBaseDir := filepath.Join(os.TempDir(), "startit-repos")
+		tempBaseDir := reposBaseDir()
 		if err := os.MkdirAll(tempBaseDir, 0755); err != nil {
 			c.JSON(http.StatusInternalServerError, Response{
 				Success: false,
 				Error:   "Failed to create temp directory: " + err.Error(),
 			})
-			return
+			return "", false
 		}
 
 		// Create a unique directory name based on the repo name and a UUID
@@ -111,11 +426,40 @@ func HandleRepositoryClone(c *gin.Context) {
 		destPath = filepath.Join(tempBaseDir, repoName+"-"+uniqueID)
 	}
 
-	// Create a new repository instance
+	return destPath, true
+}
+
+// newCloneRepository creates the repository described by a clone request, ready to clone into destPath
+func newCloneRepository(req CloneRequest, destPath string) *git.Repository {
 	repo := git.NewRepository(req.URL, req.Branch, destPath)
+	repo.SetDepth(req.Depth)
+	repo.SetRef(req.Ref)
+	repo.SetSubmodules(req.Submodules)
+	repo.SetTimeout(resolveCommandTimeout(req.TimeoutSeconds, git.DefaultCloneTimeout))
+	repo.SetSSHKeyPath(req.SSHKeyPath)
+	repo.SetSingleBranch(req.SingleBranch)
+	repo.SetVCS(cloneVCS(req))
+	repo.SetArchive(req.Archive)
+	repo.SetProxy(cloneProxy(req.Proxy))
+	repo.SetFastForward(req.FastForward)
+	repo.SetToken(req.Token)
 
-	// Clone the repository
-	if err := repo.Clone(); err != nil {
+	return repo
+}
+
+// cloneProxy returns the proxy for talking to a remote: the requested one, else GIT_PROXY. When both are
+// empty, git and hg fall back to the server's own HTTPS_PROXY/HTTP_PROXY variables and git configuration.
+func cloneProxy(requested string) string {
+	if requested != "" {
+		return requested
+	}
+	return os.Getenv("GIT_PROXY")
+}
+
+// respondWithCloneError maps a clone failure to an HTTP status and a machine-readable error code
+func respondWithCloneError(c *gin.Context, err error) {
+	var cloneErr *git.CloneError
+	if !errors.As(err, &cloneErr) {
 		c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
 			Error:   "Failed to clone repository: " + err.Error(),
@@ -123,26 +467,177 @@ func HandleRepositoryClone(c *gin.Context) {
 		return
 	}
 
-	// Return the repository details
+	c.JSON(cloneErrorStatus(cloneErr.Kind), Response{
+		Success: false,
+		Error:   "Failed to clone repository: " + err.Error(),
+		Data:    ErrorDetails{ErrorCode: string(cloneErr.Kind)},
+	})
+}
+
+// executionErrorStatus returns the HTTP status reported when a command could not be executed:
+// 400 for commands that were rejected, 504 for timeouts and 500 when the process failed to run
+func executionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, executor.ErrUnsafeCommand),
+		errors.Is(err, executor.ErrEmptyCommand),
+		errors.Is(err, executor.ErrWorkDirNotFound),
+		errors.Is(err, executor.ErrResourceLimitsUnsupported):
+		return http.StatusBadRequest
+	case errors.Is(err, executor.ErrTimeout):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// cloneVCS returns the version control system to clone with: the requested one, or Mercurial
+// for hg-style URLs and git otherwise
+func cloneVCS(req CloneRequest) string {
+	if req.VCS != "" {
+		return req.VCS
+	}
+	if git.IsMercurialURL(req.URL) {
+		return git.VCSMercurial
+	}
+	return git.VCSGit
+}
+
+// cloneErrorStatus returns the HTTP status reported for a kind of git remote failure
+func cloneErrorStatus(kind git.CloneErrorKind) int {
+	switch kind {
+	case git.CloneErrorNotFound, git.CloneErrorBranchNotFound:
+		return http.StatusNotFound
+	case git.CloneErrorAuthRequired:
+		return http.StatusUnauthorized
+	case git.CloneErrorNetwork:
+		return http.StatusBadGateway
+	case git.CloneErrorTimeout:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// handleExistingWorkspace returns the path of a workspace that already holds a clone of the requested repository
+func handleExistingWorkspace(c *gin.Context, req CloneRequest, destPath string) {
+	repo, err := git.OpenRepository(destPath)
+	if err != nil || !repo.IsCloneOf(req.URL) {
+		c.JSON(http.StatusConflict, Response{
+			Success: false,
+			Error:   "Workspace " + req.Workspace + " already exists and is not a clone of " + req.URL,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data: CloneResponse{
+			URL:       req.URL,
+			Branch:    repo.Branch,
+			Workspace: req.Workspace,
+			LocalPath: destPath,
+			Archive:   repo.IsArchive(),
+			Existing:  true,
+		},
+	})
+}
+
+// handleRepositoryRefresh updates an already-cloned repository at destPath
+func handleRepositoryRefresh(c *gin.Context, req CloneRequest, destPath string) {
+	repo, err := git.OpenRepository(destPath)
+	if err != nil || !repo.IsCloneOf(req.URL) {
+		c.JSON(http.StatusConflict, Response{
+			Success: false,
+			Error:   "Destination already exists and is not a clone of " + req.URL,
+		})
+		return
+	}
+
+	repo.URL = req.URL
+	repo.Branch = req.Branch
+	repo.SetDepth(req.Depth)
+	repo.SetSSHKeyPath(req.SSHKeyPath)
+	repo.SetProxy(cloneProxy(req.Proxy))
+	// Clones don't keep the token, so private repositories need it again to fetch
+	repo.SetToken(req.Token)
+	if err := repo.Update(); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   "Failed to update repository: " + err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, Response{
 		Success: true,
-		Data: map[string]interface{}{
-			"url":       req.URL,
-			"branch":    repo.Branch,
-			"localPath": destPath,
+		Data: CloneResponse{
+			URL:       req.URL,
+			Branch:    repo.Branch,
+			Workspace: req.Workspace,
+			LocalPath: destPath,
+			Archive:   repo.IsArchive(),
+			Existing:  true,
+			Updated:   true,
 		},
 	})
 }
 
 // HandleRepositoryAnalyze handles a request to analyze a repository
 func HandleRepositoryAnalyze(c *gin.Context) {
+	repo, opts, ok := prepareAnalyzeRequest(c)
+	if !ok {
+		return
+	}
+
+	// Run the analysis
+	response, ok := analyzeRepositoryForRequest(c, repo, opts)
+	if !ok {
+		return
+	}
+
+	// Respond with the analysis results
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    response,
+	})
+}
+
+// HandleRepositoryAnalyzeStream handles the same request as HandleRepositoryAnalyze, but streams progress
+// events as Server-Sent Events while the analysis runs. Each stage sends a "progress" event; the analysis
+// arrives in a final "complete" event, or an "error" event if it fails.
+func HandleRepositoryAnalyzeStream(c *gin.Context) {
+	repo, opts, ok := prepareAnalyzeRequest(c)
+	if !ok {
+		return
+	}
+
+	// Create the provider before streaming starts, so configuration errors still get a JSON response
+	aiProvider, ok := newAnalysisProvider(c)
+	if !ok {
+		return
+	}
+
+	opts.OnProgress = func(stage, message string) {
+		c.SSEvent("progress", AnalysisProgressEvent{Stage: stage, Message: message})
+		c.Writer.Flush()
+	}
+
+	response, err := runRepositoryAnalysis(c, aiProvider, repo, opts)
+	if err != nil {
+		c.SSEvent("error", StreamErrorEvent{Error: "Failed to analyze repository: " + err.Error()})
+		return
+	}
+	c.SSEvent("complete", response)
+}
+
+// prepareAnalyzeRequest validates an analysis request and opens the repository it names. It writes an
+// error response and returns false when the request is invalid.
+func prepareAnalyzeRequest(c *gin.Context) (*git.Repository, ai.AnalysisOptions, bool) {
 	var req AnalyzeRepositoryRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, Response{
 			Success: false,
 			Error:   "Invalid request: " + err.Error(),
 		})
-		return
+		return nil, ai.AnalysisOptions{}, false
 	}
 
 	// Validate the repository path
@@ -152,52 +647,157 @@ func HandleRepositoryAnalyze(c *gin.Context) {
 			Success: false,
 			Error:   "Repository path does not exist",
 		})
-		return
+		return nil, ai.AnalysisOptions{}, false
+	}
+
+	opts, ok := analysisOptionsForRequest(c, req.Language, req.Instructions, req.Model)
+	if !ok {
+		return nil, ai.AnalysisOptions{}, false
 	}
 
-	// Get repository information
-	repo, err := git.OpenRepository(repoPath)
+	// Get repository information; plain directories are only accepted when asked for
+	openRepository := git.OpenRepository
+	if req.AllowNonGit {
+		openRepository = git.OpenDirectory
+	}
+	repo, err := openRepository(repoPath)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
 			Error:   "Failed to open repository: " + err.Error(),
 		})
-		return
+		return nil, ai.AnalysisOptions{}, false
+	}
+
+	return repo, opts, true
+}
+
+// analyzeRepositoryForRequest runs the AI analysis of repo and gathers the stack, services and environment
+// variables for the response. It writes an error response and returns false when the analysis fails.
+func analyzeRepositoryForRequest(c *gin.Context, repo *git.Repository, opts ai.AnalysisOptions) (*AnalyzeRepositoryResponse, bool) {
+	aiProvider, ok := newAnalysisProvider(c)
+	if !ok {
+		return nil, false
+	}
+
+	response, err := runRepositoryAnalysis(c, aiProvider, repo, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   "Failed to analyze repository: " + err.Error(),
+		})
+		return nil, false
 	}
+	return response, true
+}
 
-	// Create OpenAI service
-	openAIService, err := ai.NewOpenAIService()
+// newAnalysisProvider creates the configured AI provider, writing an error response and returning false
+// when it is not configured correctly
+func newAnalysisProvider(c *gin.Context) (ai.AIProvider, bool) {
+	aiProvider, err := ai.NewAIProvider()
 	if err != nil {
 		log.Printf("ERROR: Failed to initialize AI service: %v", err)
 		c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
 			Error:   "Failed to initialize AI service: " + err.Error(),
 		})
-		return
+		return nil, false
 	}
+	return aiProvider, true
+}
 
-	// Analyze the repository
+// runRepositoryAnalysis analyzes repo with aiProvider, reusing a cached result unless ?force=true is
+// given, and gathers the rest of the response
+func runRepositoryAnalysis(c *gin.Context, aiProvider ai.AIProvider, repo *git.Repository, opts ai.AnalysisOptions) (*AnalyzeRepositoryResponse, error) {
+	repoPath := repo.LocalDir
+
+	force := c.Query("force") == "true"
 	log.Printf("Analyzing repository: %s", repoPath)
-	analysis, err := openAIService.AnalyzeRepository(c.Request.Context(), repo)
+	analysis, cached, err := ai.AnalyzeRepositoryCached(c.Request.Context(), aiProvider, repo, opts, force)
 	if err != nil {
+		metrics.Analyses.Inc(metrics.ResultFailure)
 		log.Printf("ERROR: Failed to analyze repository: %v", err)
-		c.JSON(http.StatusInternalServerError, Response{
-			Success: false,
-			Error:   "Failed to analyze repository: " + err.Error(),
-		})
-		return
+		return nil, err
 	}
 
-	// Respond with the analysis results
-	c.JSON(http.StatusOK, Response{
-		Success: true,
-		Data: AnalyzeRepositoryResponse{
-			Description:   analysis.Description,
-			SetupSteps:    analysis.Setup,
-			Commands:      analysis.CommandsToRun,
-			Prerequisites: analysis.Prerequisites,
-		},
-	})
+	if cached {
+		metrics.Analyses.Inc(metrics.ResultCached)
+	} else {
+		metrics.Analyses.Inc(metrics.ResultSuccess)
+	}
+
+	// Cached results cost nothing, so only report usage for fresh analyses
+	var usage *ai.TokenUsage
+	if !cached {
+		usage = analysis.Usage
+		if usage != nil {
+			log.Printf("Analysis of %s used %d prompt and %d completion tokens", repoPath, usage.PromptTokens, usage.CompletionTokens)
+		}
+	}
+
+	// Detect the stack for the response; this is cheap so it is never cached
+	stack, err := repo.DetectStack()
+	if err != nil {
+		log.Printf("Failed to detect repository stack: %v", err)
+	}
+
+	// Warn about conflicting lockfiles; copy the warnings first since a cached analysis shares its slice
+	warnings := append([]string(nil), analysis.Warnings...)
+	for _, tech := range stack {
+		if tech.Warning != "" && !slices.Contains(warnings, tech.Warning) {
+			warnings = append(warnings, tech.Warning)
+		}
+	}
+
+	// Surface Docker Compose services so the frontend can suggest bringing them up
+	var composeCommand string
+	services, err := repo.GetComposeServices()
+	if err == nil && len(services) > 0 {
+		composeCommand = "docker compose up"
+	}
+
+	// Report Taskfile and justfile tasks so the frontend can label "task" and "just" commands
+	taskRunners, err := repo.DetectTaskRunners()
+	if err != nil {
+		log.Printf("Failed to read task runner files: %v", err)
+	}
+
+	// Show the commands the project's CI runs, which are the most reliable build and test commands
+	ciCommands, err := repo.DetectCICommands()
+	if err != nil {
+		log.Printf("Failed to read CI configuration: %v", err)
+	}
+
+	// List the environment variables the project expects so users can configure them before running it
+	requiredEnvVars, err := repo.GetRequiredEnvVars()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to read required environment variables: %v", err)
+	}
+
+	// Tie the result to the analyzed revision; repositories that were just cloned weren't opened, so ask git
+	commit := repo.Commit
+	if commit == "" {
+		if commit, err = repo.CurrentCommit(); err != nil {
+			log.Printf("Failed to resolve analyzed commit: %v", err)
+		}
+	}
+
+	return &AnalyzeRepositoryResponse{
+		Commit:          commit,
+		Description:     analysis.Description,
+		SetupSteps:      analysis.Setup,
+		Commands:        analysis.CommandsToRun,
+		Prerequisites:   analysis.Prerequisites,
+		Warnings:        warnings,
+		Stack:           stack,
+		Services:        services,
+		ComposeCommand:  composeCommand,
+		TaskRunners:     taskRunners,
+		CICommands:      ciCommands,
+		RequiredEnvVars: requiredEnvVars,
+		Cached:          cached,
+		Usage:           usage,
+	}, nil
 }
 
 // HandleCommandExecution handles a request to execute a command
@@ -221,13 +821,60 @@ func HandleCommandExecution(c *gin.Context) {
 		return
 	}
 
+	// Keep the directory inside the repository when one is given
+	directory := req.Directory
+	if req.RepoPath != "" {
+		if !pathExists(req.RepoPath) {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   "Repository path does not exist",
+			})
+			return
+		}
+		var ok bool
+		if directory, ok = resolveCommandDirectory(c, req.RepoPath, req.Directory); !ok {
+			return
+		}
+	} else if req.UseRepoEnv {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "useRepoEnv requires repoPath",
+		})
+		return
+	}
+
+	env, ok := loadRepoEnv(c, req.RepoPath, req.UseRepoEnv)
+	if !ok {
+		return
+	}
+	limits, ok := resolveResourceLimits(c, req.ResourceLimitsRequest)
+	if !ok {
+		return
+	}
+	runAs, ok := resolveRunAs(c, req.RunAs)
+	if !ok {
+		return
+	}
+
 	// Initialize the command executor
+	timeout := resolveCommandTimeout(req.TimeoutSeconds, defaultCommandTimeout)
 	cmdExecutor := executor.NewCommandExecutor()
+	cmdExecutor.SetTimeout(timeout)
+	cmdExecutor.SetEnv(env)
+	cmdExecutor.SetResourceLimits(limits)
+	cmdExecutor.SetRunAs(runAs)
+	cmdExecutor.SetKeepANSI(req.KeepANSI)
+
+	// Preview what would run without executing anything
+	if req.DryRun {
+		respondWithExecutionPlan(c, cmdExecutor, command, directory)
+		return
+	}
 
 	// Execute the command
-	log.Printf("API: Executing command: '%s' with args: %v in directory: %s", command, req.Args, req.Directory)
+	logging.Infof("API: Executing command: '%s' with args: %v in directory: %s", logging.RedactSecrets(command), logging.RedactSecrets(strings.Join(req.Args, " ")), directory)
 	
-	ctx := context.Background()
+	ctx := executor.WithKeepANSI(executor.WithRunAs(executor.WithResourceLimits(executor.WithEnv(context.Background(), env), limits), runAs), req.KeepANSI)
 	var result *executor.CommandResult
 	var err error
 	
@@ -238,16 +885,17 @@ func HandleCommandExecution(c *gin.Context) {
 	   strings.Contains(command, "&&") ||
 	   strings.Contains(command, ";") {
 		// For complex commands, use the shell executor
-		result, err = executor.ExecuteShellCommand(ctx, command, req.Directory, 5*time.Minute)
+		result, err = executor.ExecuteShellCommand(ctx, command, directory, timeout)
 	} else {
 		// For simple commands, use the regular executor
-		result, err = cmdExecutor.Execute(command, req.Args, req.Directory)
+		result, err = cmdExecutor.Execute(command, req.Args, directory)
 	}
+	recordCommandExecution(result, err)
 	
 	// Handle errors that prevent command execution (not just non-zero exit codes)
 	if err != nil {
-		log.Printf("API: Command execution error: %v", err)
-		c.JSON(http.StatusInternalServerError, Response{
+		logging.Warnf("API: Command execution error: %s", logging.RedactSecrets(err.Error()))
+		c.JSON(executionErrorStatus(err), Response{
 			Success: false,
 			Error:   "Command execution error: " + err.Error(),
 		})
@@ -256,50 +904,42 @@ func HandleCommandExecution(c *gin.Context) {
 
 	// Check exit code - non-zero means command ran but failed
 	if result.ExitCode != 0 {
-		log.Printf("API: Command executed with non-zero exit code: %d", result.ExitCode)
-		
-		// Format the result for JSON marshaling
-		jsonResult := map[string]interface{}{
-			"command":   result.Command,
-			"args":      result.Args,
-			"exitCode":  result.ExitCode,
-			"output":    result.Output,
-			"error":     result.Error,
-			"startTime": result.StartTime.Format(time.RFC3339),
-			"endTime":   result.EndTime.Format(time.RFC3339),
-			"duration":  result.Duration,
-		}
+		logging.Infof("API: Command executed with non-zero exit code: %d", result.ExitCode)
 		
 		// Return a 200 status but with success=false to indicate command ran but failed
 		c.JSON(http.StatusOK, Response{
 			Success: false, // Command ran but failed with non-zero exit code
 			Error:   fmt.Sprintf("Command exited with code %d: %s", result.ExitCode, result.Error),
-			Data:    jsonResult,
+			Data:    newExecuteResponse(result),
 		})
 		return
 	}
 
-	log.Printf("API: Command executed successfully with exit code: %d", result.ExitCode)
-
-	// Format the result for JSON marshaling
-	jsonResult := map[string]interface{}{
-		"command":   result.Command,
-		"args":      result.Args,
-		"exitCode":  result.ExitCode,
-		"output":    result.Output,
-		"error":     result.Error,
-		"startTime": result.StartTime.Format(time.RFC3339),
-		"endTime":   result.EndTime.Format(time.RFC3339),
-		"duration":  result.Duration,
-	}
+	logging.Infof("API: Command executed successfully with exit code: %d", result.ExitCode)
 
 	// Return the execution results
 	c.JSON(http.StatusOK, Response{
 		Success: true,
-		Data:    jsonResult,
+		Data:    newExecuteResponse(result),
 	})
 }
 
+// Helper function to convert a command result into the /api/execute response
+func newExecuteResponse(result *executor.CommandResult) ExecuteResponse {
+	return ExecuteResponse{
+		Command:   result.Command,
+		Args:      result.Args,
+		ExitCode:  result.ExitCode,
+		Signal:    result.Signal,
+		Output:    result.Output,
+		Error:     result.Error,
+		StartTime: result.StartTime.Format(time.RFC3339),
+		EndTime:   result.EndTime.Format(time.RFC3339),
+		Duration:  result.Duration,
+		Truncated: result.Truncated,
+	}
+}
+
 // HandleExecuteCommand handles a request to execute a command in a repository
 func HandleExecuteCommand(c *gin.Context) {
 	var req ExecuteCommandRequest
@@ -320,13 +960,44 @@ func HandleExecuteCommand(c *gin.Context) {
 		return
 	}
 
+	// Run in the requested subdirectory, which must stay inside the repository
+	directory, ok := resolveCommandDirectory(c, req.RepoPath, req.Directory)
+	if !ok {
+		return
+	}
+
+	env, ok := loadRepoEnv(c, req.RepoPath, req.UseRepoEnv)
+	if !ok {
+		return
+	}
+	limits, ok := resolveResourceLimits(c, req.ResourceLimitsRequest)
+	if !ok {
+		return
+	}
+	runAs, ok := resolveRunAs(c, req.RunAs)
+	if !ok {
+		return
+	}
+
 	// Create and configure the executor
+	timeout := resolveCommandTimeout(req.TimeoutSeconds, defaultCommandTimeout)
 	cmdExecutor := executor.NewCommandExecutor()
+	cmdExecutor.SetTimeout(timeout)
+	cmdExecutor.SetEnv(env)
+	cmdExecutor.SetResourceLimits(limits)
+	cmdExecutor.SetRunAs(runAs)
+	cmdExecutor.SetKeepANSI(req.KeepANSI)
+
+	// Preview what would run without executing anything
+	if req.DryRun {
+		respondWithExecutionPlan(c, cmdExecutor, req.Command, directory)
+		return
+	}
 	
-	log.Printf("API: Executing command in repository: '%s' in path: %s", req.Command, req.RepoPath)
+	logging.Infof("API: Executing command in repository: '%s' in path: %s", logging.RedactSecrets(req.Command), directory)
 	
 	// Handle more complex commands with pipes, redirects, etc.
-	ctx := context.Background()
+	ctx := executor.WithKeepANSI(executor.WithRunAs(executor.WithResourceLimits(executor.WithEnv(context.Background(), env), limits), runAs), req.KeepANSI)
 	var result *executor.CommandResult
 	var err error
 	
@@ -336,21 +1007,25 @@ func HandleExecuteCommand(c *gin.Context) {
 	   strings.Contains(req.Command, "&&") ||
 	   strings.Contains(req.Command, ";") {
 		// For complex commands, use the shell executor
-		result, err = executor.ExecuteShellCommand(ctx, req.Command, req.RepoPath, 5*time.Minute)
+		result, err = executor.ExecuteShellCommand(ctx, req.Command, directory, timeout)
 	} else {
 		// For simple commands, use the regular executor with the provided command, args, and directory
-		result, err = cmdExecutor.Execute(req.Command, nil, req.RepoPath)
+		result, err = cmdExecutor.Execute(req.Command, nil, directory)
 	}
+	recordCommandExecution(result, err)
 	
 	if err != nil {
-		log.Printf("API: Repository command execution failed: %v", err)
+		logging.Warnf("API: Repository command execution failed: %s", logging.RedactSecrets(err.Error()))
+		status := executionErrorStatus(err)
 		
-		// If there's an error, we'll try to provide helpful troubleshooting
-		openAIService, serviceErr := ai.NewOpenAIService()
-		if serviceErr == nil {
-			troubleshootingAdvice, adviceErr := openAIService.TroubleshootError(err.Error(), req.Command)
+		// If the command couldn't run, we'll try to provide helpful troubleshooting; rejected requests need none
+		aiProvider, serviceErr := ai.NewAIProvider()
+		if serviceErr == nil && status >= http.StatusInternalServerError {
+			troubleshootCtx, cancel := troubleshootContext(c)
+			troubleshootingAdvice, _, adviceErr := aiProvider.TroubleshootError(troubleshootCtx, err.Error(), commandFailureContext(req.Command, directory), nil)
+			cancel()
 			if adviceErr == nil {
-				c.JSON(http.StatusInternalServerError, Response{
+				c.JSON(status, Response{
 					Success: false,
 					Error:   fmt.Sprintf("Command execution failed: %v\n\nTroubleshooting Advice:\n%s", err, troubleshootingAdvice),
 				})
@@ -359,7 +1034,7 @@ func HandleExecuteCommand(c *gin.Context) {
 		}
 
 		// If we couldn't get AI troubleshooting, just return the error
-		c.JSON(http.StatusInternalServerError, Response{
+		c.JSON(status, Response{
 			Success: false,
 			Error:   fmt.Sprintf("Command execution failed: %v", err),
 		})
@@ -368,7 +1043,7 @@ func HandleExecuteCommand(c *gin.Context) {
 
 	// Even if the command ran, it might have had a non-zero exit code
 	if result.ExitCode != 0 {
-		log.Printf("API: Repository command executed with non-zero exit code: %d", result.ExitCode)
+		logging.Infof("API: Repository command executed with non-zero exit code: %d", result.ExitCode)
 		
 		// Try to get troubleshooting advice for the error
 		errorMessage := fmt.Sprintf("Command exited with code %d", result.ExitCode)
@@ -376,17 +1051,17 @@ func HandleExecuteCommand(c *gin.Context) {
 			errorMessage += ": " + result.Error
 		}
 		
-		openAIService, serviceErr := ai.NewOpenAIService()
+		aiProvider, serviceErr := ai.NewAIProvider()
 		if serviceErr == nil {
-			troubleshootingAdvice, adviceErr := openAIService.TroubleshootError(errorMessage, req.Command)
+			troubleshootCtx, cancel := troubleshootContext(c)
+			// Give the model the real stderr and stdout, not just the exit code
+			troubleshootingAdvice, _, adviceErr := aiProvider.TroubleshootError(troubleshootCtx, commandFailureReport(result), commandFailureContext(req.Command, directory), nil)
+			cancel()
 			if adviceErr == nil {
 				c.JSON(http.StatusOK, Response{
 					Success: false,
 					Error:   fmt.Sprintf("%s\n\nTroubleshooting Advice:\n%s", errorMessage, troubleshootingAdvice),
-					Data: ExecuteCommandResponse{
-						Output: result.Output,
-						ExitCode: result.ExitCode,
-					},
+					Data:    newExecuteCommandResponse(result),
 				})
 				return
 			}
@@ -396,22 +1071,141 @@ func HandleExecuteCommand(c *gin.Context) {
 		c.JSON(http.StatusOK, Response{
 			Success: false,
 			Error:   errorMessage,
-			Data: ExecuteCommandResponse{
-				Output: result.Output,
-				ExitCode: result.ExitCode,
-			},
+			Data:    newExecuteCommandResponse(result),
 		})
 		return
 	}
 
-	log.Printf("API: Repository command executed successfully with exit code 0")
+	logging.Infof("API: Repository command executed successfully with exit code 0")
 	
 	c.JSON(http.StatusOK, Response{
 		Success: true,
-		Data: ExecuteCommandResponse{
-			Output: result.Output,
-			ExitCode: result.ExitCode,
-		},
+		Data:    newExecuteCommandResponse(result),
+	})
+}
+
+// HandleExecuteBatch handles a request to run a list of commands sequentially in a repository
+func HandleExecuteBatch(c *gin.Context) {
+	var req ExecuteBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	if len(req.Commands) == 0 || len(req.Commands) > maxBatchCommands {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   fmt.Sprintf("A batch must contain between 1 and %d commands", maxBatchCommands),
+		})
+		return
+	}
+
+	// Validate the repository path
+	if !pathExists(req.RepoPath) {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Repository path does not exist",
+		})
+		return
+	}
+
+	env, ok := loadRepoEnv(c, req.RepoPath, req.UseRepoEnv)
+	if !ok {
+		return
+	}
+	limits, ok := resolveResourceLimits(c, req.ResourceLimitsRequest)
+	if !ok {
+		return
+	}
+	runAs, ok := resolveRunAs(c, req.RunAs)
+	if !ok {
+		return
+	}
+
+	// The timeout covers the whole batch rather than each command
+	timeout := resolveCommandTimeout(req.TimeoutSeconds, defaultCommandTimeout)
+	ctx := executor.WithKeepANSI(executor.WithRunAs(executor.WithResourceLimits(executor.WithEnv(c.Request.Context(), env), limits), runAs), req.KeepANSI)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	logging.Infof("API: Executing batch of %d commands in repository: %s", len(req.Commands), req.RepoPath)
+	results, err := executor.ExecuteCommands(ctx, req.Commands, req.RepoPath, req.StopOnError)
+	if err != nil {
+		logging.Warnf("API: Batch stopped after error: %s", logging.RedactSecrets(err.Error()))
+	}
+	for _, result := range results {
+		recordCommandExecution(result, nil)
+	}
+
+	// Commands without anything to run are skipped by the executor, so results line up with the runnable ones
+	var ran []string
+	for _, command := range req.Commands {
+		if executor.IsRunnableCommand(command) {
+			ran = append(ran, command)
+		}
+	}
+
+	response := ExecuteBatchResponse{Results: results, FailedIndex: -1}
+	for i, result := range results {
+		if result.ExitCode != 0 {
+			response.FailedIndex = i
+			response.FailedCommand = ran[i]
+			break
+		}
+	}
+
+	// Work out how many commands were skipped because the batch stopped early
+	if req.StopOnError && response.FailedIndex >= 0 {
+		response.Stopped = true
+		response.Skipped = len(ran) - len(results)
+	}
+
+	if response.FailedIndex >= 0 {
+		c.JSON(http.StatusOK, Response{
+			Success: false,
+			Error:   "Command failed: " + response.FailedCommand,
+			Data:    response,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    response,
+	})
+}
+
+// newExecuteCommandResponse builds the API response for a finished command
+func newExecuteCommandResponse(result *executor.CommandResult) ExecuteCommandResponse {
+	return ExecuteCommandResponse{
+		Command:   strings.TrimSpace(result.Command + " " + result.Args),
+		Output:    result.Output,
+		ExitCode:  result.ExitCode,
+		Signal:    result.Signal,
+		StartTime: result.StartTime,
+		EndTime:   result.EndTime,
+		Duration:  result.Duration,
+		Truncated: result.Truncated,
+	}
+}
+
+// respondWithExecutionPlan responds with how a command would be executed, without running it
+func respondWithExecutionPlan(c *gin.Context, cmdExecutor *executor.CommandExecutor, command, directory string) {
+	plan, err := cmdExecutor.Plan(command, directory)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Failed to plan command: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    ExecutionPlanResponse{DryRun: true, Plan: plan},
 	})
 }
 
@@ -426,8 +1220,8 @@ func HandleTroubleshooting(c *gin.Context) {
 		return
 	}
 
-	// Initialize OpenAI service
-	openAIService, err := ai.NewOpenAIService()
+	// Initialize the configured AI provider
+	aiProvider, err := ai.NewAIProvider()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, Response{
 			Success: false,
@@ -436,25 +1230,119 @@ func HandleTroubleshooting(c *gin.Context) {
 		return
 	}
 
+	// Continue the requested conversation or start a new one
+	conversationID, history, ok := resolveConversation(c, req.ConversationID)
+	if !ok {
+		return
+	}
+
 	// Get troubleshooting advice
-	solution, err := openAIService.TroubleshootError(req.Error, req.RepoPath)
+	ctx, cancel := troubleshootContext(c)
+	defer cancel()
+	solution, usage, err := aiProvider.TroubleshootError(ctx, req.Error, req.RepoPath, history)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, Response{
+		status := http.StatusInternalServerError
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		c.JSON(status, Response{
 			Success: false,
 			Error:   "Failed to get troubleshooting advice: " + err.Error(),
 		})
 		return
 	}
+	ai.RecordTroubleshootTurn(conversationID, req.Error, req.RepoPath, solution)
 
 	// Return the troubleshooting results
 	c.JSON(http.StatusOK, Response{
 		Success: true,
-		Data: map[string]interface{}{
-			"solution": solution,
+		Data: TroubleshootResponse{
+			Solution:       solution,
+			Usage:          usage,
+			ConversationID: conversationID,
 		},
 	})
 }
 
+// troubleshootContext bounds a troubleshooting call by ai.TroubleshootTimeout and cancels it when the client disconnects
+func troubleshootContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c.Request.Context(), ai.TroubleshootTimeout)
+}
+
+// resolveConversation returns the ID and prior turns of the requested troubleshooting conversation,
+// starting a new one when no ID is given. It writes an error response and returns false for unknown IDs.
+func resolveConversation(c *gin.Context, conversationID string) (string, []ai.ConversationTurn, bool) {
+	if conversationID == "" {
+		return ai.NewConversation(), nil, true
+	}
+
+	history, exists := ai.GetConversation(conversationID)
+	if !exists {
+		c.JSON(http.StatusNotFound, Response{
+			Success: false,
+			Error:   "Conversation not found or expired",
+		})
+		return "", nil, false
+	}
+	return conversationID, history, true
+}
+
+// HandleTroubleshootingStream streams troubleshooting advice as server-sent events.
+// Clients receive "chunk" events as text is generated, then a "complete" event with the full solution,
+// or an "error" event if generation fails. Providers without streaming send the whole answer as one chunk.
+func HandleTroubleshootingStream(c *gin.Context) {
+	var req TroubleshootRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	// Initialize the configured AI provider
+	aiProvider, err := ai.NewAIProvider()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Success: false,
+			Error:   "Failed to initialize AI service: " + err.Error(),
+		})
+		return
+	}
+
+	// Continue the requested conversation or start a new one
+	conversationID, history, ok := resolveConversation(c, req.ConversationID)
+	if !ok {
+		return
+	}
+
+	sendChunk := func(text string) {
+		c.SSEvent("chunk", TroubleshootChunkEvent{Text: text})
+		c.Writer.Flush()
+	}
+
+	ctx, cancel := troubleshootContext(c)
+	defer cancel()
+
+	var solution string
+	if streamer, ok := aiProvider.(ai.TroubleshootStreamer); ok {
+		solution, err = streamer.TroubleshootErrorStream(ctx, req.Error, req.RepoPath, history, sendChunk)
+	} else {
+		solution, _, err = aiProvider.TroubleshootError(ctx, req.Error, req.RepoPath, history)
+		if err == nil {
+			sendChunk(solution)
+		}
+	}
+
+	if err != nil {
+		c.SSEvent("error", StreamErrorEvent{Error: "Failed to get troubleshooting advice: " + err.Error()})
+		return
+	}
+
+	ai.RecordTroubleshootTurn(conversationID, req.Error, req.RepoPath, solution)
+	c.SSEvent("complete", TroubleshootResponse{Solution: solution, ConversationID: conversationID})
+}
+
 // HandleGetCommandStatus handles a request to get the status of a background command
 func HandleGetCommandStatus(c *gin.Context) {
 	commandID := c.Param("id")
@@ -469,8 +1357,8 @@ func HandleGetCommandStatus(c *gin.Context) {
 	// Get the background command manager
 	bgManager := executor.GetBackgroundManager()
 
-	// Get the command status
-	bgCmd, exists := bgManager.GetCommandStatus(commandID)
+	// Get the command status; its fields are read from a snapshot since the command may still be running
+	bgCmd, snapshot, exists := bgManager.GetCommandSnapshot(commandID)
 	if !exists {
 		c.JSON(http.StatusNotFound, Response{
 			Success: false,
@@ -480,60 +1368,424 @@ func HandleGetCommandStatus(c *gin.Context) {
 	}
 
 	// Check if the command is completed
-	isCompleted := bgCmd.Status == executor.StatusCompleted || 
-				bgCmd.Status == executor.StatusFailed || 
-				bgCmd.Status == executor.StatusTimeout
+	isCompleted := snapshot.Status == executor.StatusCompleted ||
+		snapshot.Status == executor.StatusFailed ||
+		snapshot.Status == executor.StatusTimeout ||
+		snapshot.Status == executor.StatusCancelled
 
 	// Build a proper response with result and error handling
-	responseData := map[string]interface{}{
-		"commandId":   bgCmd.ID,
-		"status":      string(bgCmd.Status),
-		"startTime":   bgCmd.StartTime,
-		"isCompleted": isCompleted,
+	response := CommandStatusResponse{
+		CommandID:   snapshot.ID,
+		Status:      snapshot.Status,
+		StartTime:   snapshot.StartTime,
+		EndTime:     snapshot.EndTime,
+		IsCompleted: isCompleted,
+		HasLogs:     bgCmd.LogPath() != "",
+	}
+
+	// ?tail=N limits the output to the last N lines so frequent polls stay cheap
+	tail := 0
+	if value := c.Query("tail"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > executor.MaxRecentOutputLines {
+			c.JSON(http.StatusBadRequest, Response{
+				Success: false,
+				Error:   fmt.Sprintf("tail must be between 1 and %d", executor.MaxRecentOutputLines),
+			})
+			return
+		}
+		tail = n
 	}
 
-	// Add the end time if it's set
-	if bgCmd.EndTime != nil {
-		responseData["endTime"] = bgCmd.EndTime
+	// ?offset=N&errorOffset=M return only what was written after earlier polls
+	outputOffset, ok := queryOffset(c, "offset")
+	if !ok {
+		return
+	}
+	errorOffset, ok := queryOffset(c, "errorOffset")
+	if !ok {
+		return
+	}
+	useOffsets := c.Query("offset") != "" || c.Query("errorOffset") != ""
+	if useOffsets && tail > 0 {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "tail cannot be combined with offset or errorOffset",
+		})
+		return
 	}
 
 	// Add current output and error, even if command is still running
-	output := bgCmd.GetCurrentOutput()
-	if output != "" {
-		responseData["currentOutput"] = output
+	var output, errorOut string
+	switch {
+	case tail > 0:
+		output = bgCmd.GetRecentOutput(tail)
+		errorOut = bgCmd.GetRecentError(tail)
+	case useOffsets:
+		var nextOutputOffset, nextErrorOffset int
+		output, nextOutputOffset = bgCmd.GetOutputSince(outputOffset)
+		errorOut, nextErrorOffset = bgCmd.GetErrorSince(errorOffset)
+		response.OutputOffset = &nextOutputOffset
+		response.ErrorOffset = &nextErrorOffset
+	default:
+		output = bgCmd.GetCurrentOutput()
+		errorOut = bgCmd.GetCurrentError()
 	}
 
-	errorOut := bgCmd.GetCurrentError()
-	if errorOut != "" {
-		responseData["currentError"] = errorOut
-	}
+	response.CurrentOutput = output
+	response.CurrentError = errorOut
 
 	// Handle the command result (final result when completed)
-	if bgCmd.Result != nil {
-		// Convert the CommandResult to a map to avoid JSON serialization issues
-		responseData["result"] = map[string]interface{}{
-			"command":   bgCmd.Result.Command,
-			"args":      bgCmd.Result.Args,
-			"output":    bgCmd.Result.Output,
-			"error":     bgCmd.Result.Error,
-			"exitCode":  bgCmd.Result.ExitCode,
-			"startTime": bgCmd.Result.StartTime,
-			"endTime":   bgCmd.Result.EndTime,
-			"duration":  bgCmd.Result.Duration,
+	if snapshot.Result != nil {
+		resultOutput, resultError := snapshot.Result.Output, snapshot.Result.Error
+		if tail > 0 {
+			resultOutput, resultError = lastLines(resultOutput, tail), lastLines(resultError, tail)
+		} else if useOffsets {
+			resultOutput, resultError = textAfter(resultOutput, outputOffset), textAfter(resultError, errorOffset)
 		}
-	}
 
-	// Handle the error message
-	if bgCmd.Error != "" {
-		responseData["error"] = bgCmd.Error
+		response.Result = &CommandStatusResult{
+			Command:   snapshot.Result.Command,
+			Args:      snapshot.Result.Args,
+			Output:    resultOutput,
+			Error:     resultError,
+			ExitCode:  snapshot.Result.ExitCode,
+			Signal:    snapshot.Result.Signal,
+			StartTime: snapshot.Result.StartTime,
+			EndTime:   snapshot.Result.EndTime,
+			Duration:  snapshot.Result.Duration,
+			Truncated: snapshot.Result.Truncated,
+			TimedOut:  snapshot.Result.TimedOut,
+		}
 	}
+	response.Error = snapshot.Error
 
 	c.JSON(http.StatusOK, Response{
 		Success: true,
-		Data:    responseData,
+		Data:    response,
 	})
 }
 
+// Helper function to count a foreground command execution in the metrics
+func recordCommandExecution(result *executor.CommandResult, err error) {
+	if errors.Is(err, executor.ErrTimeout) {
+		metrics.CommandExecutions.Inc(metrics.ExitTimeout)
+		return
+	}
+	exitCode := -1
+	if result != nil {
+		exitCode = result.ExitCode
+	}
+	metrics.CommandExecutions.Inc(metrics.ExitClass(exitCode, err))
+}
+
+// Helper function to parse an optional non-negative byte offset query parameter. It writes an error
+// response and returns false when the value is invalid.
+func queryOffset(c *gin.Context, name string) (int, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   name + " must be a non-negative integer",
+		})
+		return 0, false
+	}
+	return n, true
+}
+
+// Helper function describing a failed command for troubleshooting: its exit status plus the end of its
+// stderr and stdout, capped so a noisy build log doesn't crowd out the prompt
+func commandFailureReport(result *executor.CommandResult) string {
+	report := fmt.Sprintf("Command exited with code %d", result.ExitCode)
+	if result.Signal != "" {
+		report += fmt.Sprintf(" (killed by %s)", result.Signal)
+	}
+
+	for _, stream := range []struct{ name, text string }{
+		{"stderr", result.Error},
+		{"stdout", result.Output},
+	} {
+		if text := strings.TrimSpace(stream.text); text != "" {
+			report += fmt.Sprintf("\n\n%s:\n%s", stream.name, lastBytes(lastLines(text, troubleshootOutputLines), troubleshootOutputBytes))
+		}
+	}
+	return report
+}
+
+// Helper function describing where a failed command ran, for the troubleshooting context
+func commandFailureContext(command, directory string) string {
+	return fmt.Sprintf("Command: %s\nWorking directory: %s", command, directory)
+}
+
+// Helper function returning at most the last n bytes of text, starting on a whole UTF-8 character
+func lastBytes(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	start := len(text) - n
+	for start < len(text) && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	return text[start:]
+}
+
+// Helper function returning the part of text after offset bytes
+func textAfter(text string, offset int) string {
+	if offset >= len(text) {
+		return ""
+	}
+	return text[offset:]
+}
+
+// Helper function returning the last n lines of text
+func lastLines(text string, n int) string {
+	end := len(text)
+	if strings.HasSuffix(text, "\n") {
+		end--
+	}
+	for i := 0; i < n; i++ {
+		idx := strings.LastIndexByte(text[:end], '\n')
+		if idx < 0 {
+			return text
+		}
+		end = idx
+	}
+	return text[end+1:]
+}
+
+// resolveCommandDirectory resolves directory relative to repoPath, rejecting paths that escape the
+// repository. It writes an error response and returns false when the directory is invalid.
+func resolveCommandDirectory(c *gin.Context, repoPath, directory string) (string, bool) {
+	if directory == "" {
+		return repoPath, true
+	}
+
+	repo := git.NewRepository("", "", repoPath)
+	fullPath, err := repo.ResolvePath(directory)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, git.ErrPathOutsideRepository) || errors.Is(err, git.ErrPathInVCSMetadata) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, Response{
+			Success: false,
+			Error:   "Invalid directory: " + err.Error(),
+		})
+		return "", false
+	}
+
+	if info, err := os.Stat(fullPath); err != nil || !info.IsDir() {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Directory does not exist in the repository: " + directory,
+		})
+		return "", false
+	}
+
+	return fullPath, true
+}
+
+// loadRepoEnv reads the repository's .env file when useRepoEnv is set, returning its KEY=VALUE entries.
+// It writes an error response and returns false when the file can't be parsed.
+func loadRepoEnv(c *gin.Context, repoPath string, useRepoEnv bool) ([]string, bool) {
+	if !useRepoEnv {
+		return nil, true
+	}
+
+	env, err := executor.LoadRepoEnv(repoPath)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Invalid repository .env file: " + err.Error(),
+		})
+		return nil, false
+	}
+	return env, true
+}
+
+// resolveResourceLimits converts the requested limits, writing an error response and returning false
+// when they are negative or can't be enforced on this host
+func resolveResourceLimits(c *gin.Context, req ResourceLimitsRequest) (executor.ResourceLimits, bool) {
+	limits := executor.ResourceLimits{MemoryMB: req.MemoryLimitMB, CPUPercent: req.CPULimitPercent}
+	if err := executor.ValidateResourceLimits(limits); err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Invalid resource limits: " + err.Error(),
+		})
+		return executor.ResourceLimits{}, false
+	}
+	return limits, true
+}
+
+// resolveRunAs looks up the user a request asked to run as, writing an error response and returning false
+// when it doesn't exist or can't be used. While RUN_AS_USER is set, requests can't switch back to root.
+func resolveRunAs(c *gin.Context, spec string) (*executor.RunAs, bool) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, true
+	}
+	runAs, err := executor.LookupRunAs(spec)
+	// While RUN_AS_USER sandboxes commands, requests may only pick users the operator allowed
+	if err == nil && executor.DefaultRunAs != nil {
+		switch {
+		case runAs.UID == 0 || runAs.GID == 0:
+			err = errors.New("commands can't run as root or with the root group while RUN_AS_USER is set")
+		case !executor.RunAsAllowed(runAs):
+			err = fmt.Errorf("%s is neither RUN_AS_USER nor listed in RUN_AS_ALLOWED_USERS", runAs)
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Invalid runAs: " + err.Error(),
+		})
+		return nil, false
+	}
+	return runAs, true
+}
+
+// Helper function to turn a requested timeout in seconds into a capped duration
+func resolveCommandTimeout(seconds int, fallback time.Duration) time.Duration {
+	if seconds <= 0 {
+		return fallback
+	}
+	timeout := time.Duration(seconds) * time.Second
+	if timeout > maxCommandTimeout {
+		return maxCommandTimeout
+	}
+	return timeout
+}
+
+// analysisOptionsForRequest validates the analysis language, custom instructions and model override from
+// a request. It writes an error response and returns false when any of them is invalid.
+func analysisOptionsForRequest(c *gin.Context, language, instructions, model string) (ai.AnalysisOptions, bool) {
+	if !isValidAnalysisLanguage(language) {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Invalid language",
+		})
+		return ai.AnalysisOptions{}, false
+	}
+
+	if len(instructions) > maxInstructionsLength {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   fmt.Sprintf("instructions must be at most %d characters", maxInstructionsLength),
+		})
+		return ai.AnalysisOptions{}, false
+	}
+
+	if model != "" && !ai.IsAllowedModel(model) {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Model " + model + " is not allowed; allowed models are configured with AI_ALLOWED_MODELS",
+		})
+		return ai.AnalysisOptions{}, false
+	}
+
+	return ai.AnalysisOptions{Language: language, Instructions: instructions, Model: model}, true
+}
+
+// Helper function to check an analysis language; it ends up in the prompt, so it must be a short single-line name
+func isValidAnalysisLanguage(language string) bool {
+	return len(language) <= maxLanguageLength && !strings.ContainsAny(language, "\r\n")
+}
+
+// reposBase is the base directory that cloned repositories live under; STARTIT_WORKDIR overrides it
+var reposBase = filepath.Join(os.TempDir(), "startit-repos")
+
+// SetWorkDir makes dir the base directory for all clones, so they can live on a large dedicated volume
+// instead of the system temp directory. dir must be an existing, writable directory.
+func SetWorkDir(dir string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve work directory: %w", err)
+	}
+
+	info, err := os.Stat(absDir)
+	if err != nil {
+		return fmt.Errorf("work directory is not accessible: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("work directory %s is not a directory", absDir)
+	}
+
+	if err := checkWritable(absDir); err != nil {
+		return err
+	}
+
+	reposBase = absDir
+	return nil
+}
+
+// Helper function to check that files can be created in dir
+func checkWritable(dir string) error {
+	// The only reliable writability check is to write something
+	probe, err := os.CreateTemp(dir, ".startit-write-check-*")
+	if err != nil {
+		return fmt.Errorf("work directory %s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
+
+// Helper function returning the base directory that cloned repositories live under
+func reposBaseDir() string {
+	return reposBase
+}
+
+// Helper function to check if path is strictly inside the repository base directory
+func isInsideReposBase(path string) bool {
+	baseDir, err := filepath.Abs(reposBaseDir())
+	if err != nil {
+		return false
+	}
+	resolved, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(baseDir, resolved)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Helper function to resolve a client-supplied destination path inside the repository base directory.
+// Relative paths are taken relative to the base; ".." components and paths outside the base are rejected.
+func resolveDestPath(destPath string) (string, error) {
+	for _, part := range strings.FieldsFunc(destPath, func(r rune) bool { return r == '/' || r == filepath.Separator }) {
+		if part == ".." {
+			return "", fmt.Errorf("path must not contain '..' components")
+		}
+	}
+
+	baseDir, err := filepath.Abs(reposBaseDir())
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve base directory: %w", err)
+	}
+
+	if !filepath.IsAbs(destPath) {
+		destPath = filepath.Join(baseDir, destPath)
+	}
+	resolved, err := filepath.Abs(filepath.Clean(destPath))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	if !isInsideReposBase(resolved) {
+		return "", fmt.Errorf("path must be inside %s", baseDir)
+	}
+
+	return resolved, nil
+}
+
+// Helper function returning the directory of a named workspace
+func workspacePath(name string) string {
+	return filepath.Join(reposBaseDir(), workspacesDirName, name)
+}
+
 // Helper function to check if a path exists
 func pathExists(path string) bool {
 	_, err := os.Stat(path)
@@ -542,21 +1794,6 @@ func pathExists(path string) bool {
 
 // Helper function to validate a Git URL
 func isValidGitURL(url string) bool {
-	// Check for standard formats
-	if strings.HasPrefix(url, "http://") ||
-		strings.HasPrefix(url, "https://") ||
-		strings.HasPrefix(url, "git@") {
-		return true
-	}
-
-	// Check for shorthand GitHub formats (user/repo or github.com/user/repo)
-	if strings.Count(url, "/") == 1 {
-		// Simple user/repo format
-		return true
-	} else if strings.HasPrefix(url, "github.com/") && strings.Count(url, "/") >= 2 {
-		// github.com/user/repo format
-		return true
-	}
-
-	return false
+	_, err := git.NormalizeGitURL(url)
+	return err == nil
 }
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"os/exec"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/prathyushnallamothu/startit/backend/internal/ai"
+)
+
+// Readiness check statuses
+const (
+	checkStatusOK     = "ok"
+	checkStatusFailed = "failed"
+)
+
+// ReadinessCheck is the outcome of a single dependency check
+type ReadinessCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthResponse is the body of the liveness and readiness probes
+type HealthResponse struct {
+	Status string           `json:"status"` // ok, ready or unavailable
+	Checks []ReadinessCheck `json:"checks,omitempty"`
+}
+
+// HandleHealth is the liveness probe: it always responds with 200 while the process can serve requests,
+// so an orchestrator only restarts the service when it is wedged rather than when a dependency is missing
+func HandleHealth(c *gin.Context) {
+	c.JSON(http.StatusOK, HealthResponse{Status: "ok"})
+}
+
+// HandleReady is the readiness probe. It checks that git is installed, the AI provider is configured
+// and the work directory is writable, and responds with 503 when any check fails.
+func HandleReady(c *gin.Context) {
+	checks := []ReadinessCheck{
+		// git is required for cloning repositories
+		readinessCheck("git", func() error {
+			_, err := exec.LookPath("git")
+			return err
+		}),
+		// The configured AI provider needs its API key for analysis
+		readinessCheck("aiProvider", ai.CheckProviderConfig),
+		// Clones are written under the work directory, which is created on first use
+		readinessCheck("workDir", func() error {
+			if err := os.MkdirAll(reposBaseDir(), 0755); err != nil {
+				return err
+			}
+			return checkWritable(reposBaseDir())
+		}),
+	}
+
+	for _, check := range checks {
+		if check.Status != checkStatusOK {
+			c.JSON(http.StatusServiceUnavailable, HealthResponse{Status: "unavailable", Checks: checks})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, HealthResponse{Status: "ready", Checks: checks})
+}
+
+// Helper function to run a named readiness check
+func readinessCheck(name string, check func() error) ReadinessCheck {
+	if err := check(); err != nil {
+		return ReadinessCheck{Name: name, Status: checkStatusFailed, Error: err.Error()}
+	}
+	return ReadinessCheck{Name: name, Status: checkStatusOK}
+}
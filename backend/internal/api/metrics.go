@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/prathyushnallamothu/startit/backend/internal/executor"
+	"github.com/prathyushnallamothu/startit/backend/internal/metrics"
+)
+
+// HandleMetrics exposes execution and analysis counters in the Prometheus text format
+func HandleMetrics(c *gin.Context) {
+	// Make sure the background manager has registered its gauges before scraping
+	executor.GetBackgroundManager()
+
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	metrics.WritePrometheus(c.Writer)
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prathyushnallamothu/startit/backend/internal/ai"
+	"github.com/prathyushnallamothu/startit/backend/internal/executor"
+	"github.com/prathyushnallamothu/startit/backend/internal/logging"
+)
+
+const (
+	// prerequisiteCheckTimeout bounds each check command; version commands return almost immediately
+	prerequisiteCheckTimeout = 15 * time.Second
+
+	// maxPrerequisiteChecks caps how many prerequisites a single check request may verify
+	maxPrerequisiteChecks = 50
+)
+
+// Prerequisite check statuses
+const (
+	PrerequisiteInstalled = "installed"
+	PrerequisiteMissing   = "missing"
+	PrerequisiteUnknown   = "unknown" // No check command, or the check couldn't run to completion
+)
+
+// versionPattern finds the first dotted version number in a check command's output, e.g. 20.11.1 in "v20.11.1"
+var versionPattern = regexp.MustCompile(`\d+(?:\.\d+)+`)
+
+// PrerequisiteCheckRequest lists the prerequisites to verify, usually as returned by the analysis
+type PrerequisiteCheckRequest struct {
+	Prerequisites []ai.Prerequisite `json:"prerequisites" binding:"required"`
+	RepoPath      string            `json:"repoPath"` // Optional; checks run here so version managers pick up the repository's pins
+}
+
+// PrerequisiteCheckResult reports whether one prerequisite is installed
+type PrerequisiteCheckResult struct {
+	Name            string `json:"name"`
+	CheckCommand    string `json:"checkCommand,omitempty"`
+	Status          string `json:"status"`                    // PrerequisiteInstalled, PrerequisiteMissing or PrerequisiteUnknown
+	Version         string `json:"version,omitempty"`         // Version detected in the check command's output
+	RequiredVersion string `json:"requiredVersion,omitempty"` // Version pinned by the repository, if any
+	Output          string `json:"output,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+// PrerequisiteCheckResponse contains one result per requested prerequisite, in request order
+type PrerequisiteCheckResponse struct {
+	Results []PrerequisiteCheckResult `json:"results"`
+	Ready   bool                      `json:"ready"` // Every prerequisite is installed
+}
+
+// HandlePrerequisiteCheck runs each prerequisite's check command and reports which are installed
+func HandlePrerequisiteCheck(c *gin.Context) {
+	var req PrerequisiteCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	if len(req.Prerequisites) == 0 || len(req.Prerequisites) > maxPrerequisiteChecks {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   fmt.Sprintf("A check must contain between 1 and %d prerequisites", maxPrerequisiteChecks),
+		})
+		return
+	}
+
+	if req.RepoPath != "" && !pathExists(req.RepoPath) {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Repository path does not exist",
+		})
+		return
+	}
+
+	logging.Infof("API: Checking %d prerequisites", len(req.Prerequisites))
+
+	// Checks are independent and mostly wait on process startup, so they run concurrently
+	results := make([]PrerequisiteCheckResult, len(req.Prerequisites))
+	var wg sync.WaitGroup
+	for i, prerequisite := range req.Prerequisites {
+		wg.Add(1)
+		go func(i int, prerequisite ai.Prerequisite) {
+			defer wg.Done()
+			results[i] = checkPrerequisite(c.Request.Context(), prerequisite, req.RepoPath)
+		}(i, prerequisite)
+	}
+	wg.Wait()
+
+	ready := true
+	for _, result := range results {
+		if result.Status != PrerequisiteInstalled {
+			ready = false
+		}
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data:    PrerequisiteCheckResponse{Results: results, Ready: ready},
+	})
+}
+
+// checkPrerequisite runs a prerequisite's check command. A command that exits successfully means the
+// prerequisite is installed; one that can't start or fails means it is missing.
+func checkPrerequisite(ctx context.Context, prerequisite ai.Prerequisite, dir string) PrerequisiteCheckResult {
+	result := PrerequisiteCheckResult{
+		Name:            prerequisite.Name,
+		CheckCommand:    strings.TrimSpace(prerequisite.CheckCommand),
+		Status:          PrerequisiteUnknown,
+		RequiredVersion: prerequisite.Version,
+	}
+	if result.CheckCommand == "" {
+		result.Error = "No check command"
+		return result
+	}
+
+	commandResult, err := executor.ExecuteShellCommand(ctx, result.CheckCommand, dir, prerequisiteCheckTimeout)
+	recordCommandExecution(commandResult, err)
+	if err != nil {
+		result.Error = err.Error()
+		if errors.Is(err, executor.ErrStartFailed) {
+			result.Status = PrerequisiteMissing
+		}
+		return result
+	}
+
+	// Some tools, such as java -version, print their version to stderr
+	result.Output = strings.TrimSpace(strings.Join([]string{commandResult.Output, commandResult.Error}, "\n"))
+	if commandResult.ExitCode != 0 {
+		result.Status = PrerequisiteMissing
+		result.Error = fmt.Sprintf("Check command exited with code %d", commandResult.ExitCode)
+		return result
+	}
+
+	result.Status = PrerequisiteInstalled
+	result.Version = versionPattern.FindString(result.Output)
+	return result
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/prathyushnallamothu/startit/backend/internal/metrics"
+)
+
+// ProcessRepositoryRequest represents a request to clone and analyze a repository in one call
+type ProcessRepositoryRequest struct {
+	URL            string `json:"url" binding:"required"`
+	Branch         string `json:"branch"`
+	Depth          int    `json:"depth"`
+	Token          string `json:"token"`
+	Ref            string `json:"ref"`
+	Submodules     bool   `json:"submodules"`
+	SingleBranch   bool   `json:"singleBranch"`
+	VCS            string `json:"vcs"`            // "git" or "hg"; detected from the URL when empty
+	Archive        bool   `json:"archive"`        // Download a GitHub source archive instead of cloning
+	Proxy          string `json:"proxy"`          // HTTP(S) or SOCKS proxy for the clone; defaults to GIT_PROXY
+	TimeoutSeconds int    `json:"timeoutSeconds"` // Clone time limit
+	Language       string `json:"language"`       // Language for the analysis; defaults to English
+	Instructions   string `json:"instructions"`   // Extra guidance for the analysis
+	Model          string `json:"model"`          // Model override for the analysis; must be in AI_ALLOWED_MODELS
+}
+
+// ProcessRepositoryResponse contains the clone location and the analysis of the cloned repository
+type ProcessRepositoryResponse struct {
+	URL       string                     `json:"url"`
+	Branch    string                     `json:"branch"`
+	Ref       string                     `json:"ref,omitempty"`
+	LocalPath string                     `json:"localPath"`
+	Archive   bool                       `json:"archive,omitempty"` // The repository was downloaded as a snapshot without history
+	Analysis  *AnalyzeRepositoryResponse `json:"analysis"`
+}
+
+// HandleRepositoryProcess handles a request to clone a repository into a temporary directory and analyze it.
+// The clone is removed again if any step fails, so failed requests leave nothing behind.
+func HandleRepositoryProcess(c *gin.Context) {
+	var req ProcessRepositoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	opts, ok := analysisOptionsForRequest(c, req.Language, req.Instructions, req.Model)
+	if !ok {
+		return
+	}
+
+	// Always clone into a fresh temporary directory
+	cloneReq := CloneRequest{
+		URL:            req.URL,
+		Branch:         req.Branch,
+		Depth:          req.Depth,
+		Token:          req.Token,
+		Ref:            req.Ref,
+		Submodules:     req.Submodules,
+		SingleBranch:   req.SingleBranch,
+		VCS:            req.VCS,
+		Archive:        req.Archive,
+		Proxy:          req.Proxy,
+		TimeoutSeconds: req.TimeoutSeconds,
+	}
+	destPath, ok := resolveCloneDestination(c, cloneReq)
+	if !ok {
+		return
+	}
+
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			removeClone(destPath)
+		}
+	}()
+
+	repo := newCloneRepository(cloneReq, destPath)
+	if err := repo.CloneContext(c.Request.Context()); err != nil {
+		metrics.Clones.Inc(metrics.ResultFailure)
+		respondWithCloneError(c, err)
+		return
+	}
+	metrics.Clones.Inc(metrics.ResultSuccess)
+
+	analysis, ok := analyzeRepositoryForRequest(c, repo, opts)
+	if !ok {
+		return
+	}
+	succeeded = true
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data: ProcessRepositoryResponse{
+			URL:       req.URL,
+			Branch:    repo.Branch,
+			Ref:       repo.Ref,
+			LocalPath: destPath,
+			Archive:   repo.IsArchive(),
+			Analysis:  analysis,
+		},
+	})
+}
+
+// Helper function to delete a partially cloned or unwanted repository directory. Only paths inside the
+// repository base directory are removed, so a misconfigured destination can never delete anything else.
+func removeClone(path string) {
+	if !isInsideReposBase(path) {
+		log.Printf("Refusing to remove %s: it is outside the repository base directory %s", path, reposBaseDir())
+		return
+	}
+	if err := os.RemoveAll(path); err != nil {
+		log.Printf("Failed to remove clone at %s: %v", path, err)
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultRateLimit is the sustained number of requests per second allowed per client
+	defaultRateLimit = 1.0
+	// defaultRateBurst is how many requests a client may make at once before being throttled
+	defaultRateBurst = 10
+	// bucketIdleTimeout is how long an unused client bucket is kept before being pruned
+	bucketIdleTimeout = 10 * time.Minute
+)
+
+// tokenBucket tracks the available tokens for a single client
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// rateLimiter is a token-bucket limiter keyed by client
+type rateLimiter struct {
+	mutex     sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+// newRateLimiter creates a limiter refilling rate tokens per second up to burst
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+		lastPrune: time.Now(),
+	}
+}
+
+// allow takes a token for the client, returning how long to wait when none is available
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.pruneIdle(now)
+
+	bucket, exists := l.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: l.burst, lastSeen: now}
+		l.buckets[key] = bucket
+	}
+
+	// Refill based on the time elapsed since the client was last seen
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.lastSeen).Seconds()*l.rate)
+	bucket.lastSeen = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+
+	bucket.tokens--
+	return true, 0
+}
+
+// pruneIdle drops buckets that have not been used recently; the caller must hold the mutex
+func (l *rateLimiter) pruneIdle(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.lastSeen) > bucketIdleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastPrune = now
+}
+
+// RateLimitMiddleware throttles requests per client using a token bucket.
+// Clients are identified by their IP address; headers they choose themselves, such as X-API-Key, are
+// ignored so a client can't get a fresh bucket by changing them. Forwarded IPs are only trusted from
+// TRUSTED_PROXIES. The rate and burst are read from RATE_LIMIT_PER_SECOND and RATE_LIMIT_BURST.
+func RateLimitMiddleware() gin.HandlerFunc {
+	rate := defaultRateLimit
+	if value, err := strconv.ParseFloat(os.Getenv("RATE_LIMIT_PER_SECOND"), 64); err == nil && value > 0 {
+		rate = value
+	}
+	burst := defaultRateBurst
+	if value, err := strconv.Atoi(os.Getenv("RATE_LIMIT_BURST")); err == nil && value > 0 {
+		burst = value
+	}
+
+	limiter := newRateLimiter(rate, burst)
+
+	return func(c *gin.Context) {
+		allowed, wait := limiter.allow(c.ClientIP())
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, Response{
+				Success: false,
+				Error:   "Rate limit exceeded, please retry later",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
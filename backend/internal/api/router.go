@@ -1,7 +1,9 @@
 package api
 
 import (
-	"net/http"
+	"log"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -14,20 +16,28 @@ import (
 func NewRouter() *gin.Engine {
 	r := gin.Default()
 
+	// Only take client IPs from X-Forwarded-For when the request comes through a trusted proxy, so
+	// clients can't pick the address the rate limiter keys on
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Printf("Warning: Invalid TRUSTED_PROXIES, using the connecting address as the client IP: %v", err)
+		r.SetTrustedProxies(nil)
+	}
+
 	// CORS configuration
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
-
-	// Health check endpoint
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
-	})
+	r.Use(cors.New(corsConfig()))
+
+	// Liveness and readiness probes
+	r.GET("/health", HandleHealth)
+	r.GET("/ready", HandleReady)
+
+	// Prometheus metrics endpoint
+	r.GET("/metrics", HandleMetrics)
+
+	// Expensive endpoints share a per-client rate limiter
+	rateLimit := RateLimitMiddleware()
+
+	// Operational endpoints require the admin token
+	adminAuth := AdminAuthMiddleware()
 
 	// API routes
 	api := r.Group("/api")
@@ -36,17 +46,35 @@ func NewRouter() *gin.Engine {
 		repo := api.Group("/repository")
 		{
 			repo.POST("/clone", HandleRepositoryClone)
-			repo.POST("/analyze", HandleRepositoryAnalyze)
+			repo.POST("/clone/background", HandleBackgroundClone)
+			repo.POST("/validate", HandleRepositoryValidate)
+			repo.POST("/branches", HandleRepositoryBranches)
+			repo.POST("/analyze", rateLimit, HandleRepositoryAnalyze)
+			repo.POST("/analyze/stream", rateLimit, HandleRepositoryAnalyzeStream)
+			repo.POST("/process", rateLimit, HandleRepositoryProcess)
+			repo.GET("/file", HandleRepositoryFile)
+			repo.GET("/tree", HandleRepositoryTree)
+			repo.POST("/search", rateLimit, HandleRepositorySearch)
 		}
 
 		// Command execution routes
-		api.POST("/execute-command", HandleExecuteCommand)
-		api.POST("/command", HandleExecuteCommand) // Keep old endpoint for backward compatibility
-		api.POST("/background-command", HandleExecuteBackgroundCommand)
+		api.POST("/execute-command", rateLimit, HandleExecuteCommand)
+		api.POST("/command", rateLimit, HandleExecuteCommand) // Keep old endpoint for backward compatibility
+		api.POST("/execute-batch", rateLimit, HandleExecuteBatch)
+		api.POST("/background-command", rateLimit, HandleExecuteBackgroundCommand)
 		api.GET("/command-status/:id", HandleGetCommandStatus)
+		api.POST("/command-status/:id/cancel", HandleCancelCommand)
+		api.GET("/command-status/:id/stream", HandleStreamCommandOutput)
+		api.POST("/command-status/:id/wait", HandleWaitForCommand)
+		api.GET("/command-status/:id/logs", HandleDownloadCommandLogs)
+		api.GET("/commands", HandleListCommands)
+		api.POST("/commands/cancel-all", adminAuth, HandleCancelAllCommands)
+		api.GET("/terminal", rateLimit, HandleTerminal)
+		api.POST("/prerequisites/check", rateLimit, HandlePrerequisiteCheck)
 
 		// LLM routes
 		api.POST("/troubleshoot", HandleTroubleshooting)
+		api.POST("/troubleshoot/stream", HandleTroubleshootingStream)
 	}
 
 	// Start background cleanup task
@@ -55,6 +83,54 @@ func NewRouter() *gin.Engine {
 	return r
 }
 
+// corsConfig builds the CORS policy from CORS_ALLOWED_ORIGINS (comma-separated). When it is unset any
+// origin is allowed, but without credentials since browsers reject credentials with a wildcard origin.
+func corsConfig() cors.Config {
+	config := cors.Config{
+		AllowMethods:  []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:  []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		ExposeHeaders: []string{"Content-Length"},
+		MaxAge:        12 * time.Hour,
+	}
+
+	origins := corsAllowedOrigins()
+	if len(origins) == 0 {
+		config.AllowAllOrigins = true
+		return config
+	}
+
+	log.Printf("CORS restricted to origins: %s", strings.Join(origins, ", "))
+	config.AllowOrigins = origins
+	config.AllowCredentials = true
+	return config
+}
+
+// corsAllowedOrigins parses CORS_ALLOWED_ORIGINS, returning nil when any origin is allowed
+func corsAllowedOrigins() []string {
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		origin = strings.TrimSpace(origin)
+		if origin == "*" {
+			return nil
+		}
+		if origin != "" {
+			origins = append(origins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	return origins
+}
+
+// trustedProxies returns the proxy IPs and CIDR ranges listed in TRUSTED_PROXIES; none are trusted by default
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
 // RespondWithSuccess sends a JSON success response
 func RespondWithSuccess(c *gin.Context, status int, data interface{}) {
 	c.JSON(status, Response{
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+
+	"github.com/prathyushnallamothu/startit/backend/internal/executor"
+)
+
+const (
+	// defaultTerminalCols and defaultTerminalRows are the terminal size used until the client sends a resize
+	defaultTerminalCols = 80
+	defaultTerminalRows = 24
+	// terminalReadBufferSize is how many bytes of terminal output are forwarded per message at most
+	terminalReadBufferSize = 32 * 1024
+)
+
+// TerminalMessage is a control message sent by the client as a text frame: "input" carries typed
+// data for the terminal and "resize" changes its size
+type TerminalMessage struct {
+	Type string `json:"type"`
+	Data string `json:"data,omitempty"`
+	Cols uint16 `json:"cols,omitempty"`
+	Rows uint16 `json:"rows,omitempty"`
+}
+
+// TerminalExitMessage is the last text frame sent to the client, after the shell exits
+type TerminalExitMessage struct {
+	Type     string `json:"type"`
+	ExitCode int    `json:"exitCode"`
+	Signal   string `json:"signal,omitempty"`
+}
+
+// TerminalErrorMessage is sent as a text frame instead of any output when the shell could not be started
+type TerminalErrorMessage struct {
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+// HandleTerminal upgrades the request to a WebSocket attached to a shell on a pseudo-terminal in the
+// repository. The query takes repoPath, an optional directory and command, and the initial cols and rows.
+// Terminal output is sent as binary frames; the client sends TerminalMessage text frames.
+func HandleTerminal(c *gin.Context) {
+	repoPath := c.Query("repoPath")
+	if !pathExists(repoPath) {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Repository path does not exist",
+		})
+		return
+	}
+
+	directory, ok := resolveCommandDirectory(c, repoPath, c.Query("directory"))
+	if !ok {
+		return
+	}
+
+	cols, ok := terminalDimension(c, "cols", defaultTerminalCols)
+	if !ok {
+		return
+	}
+	rows, ok := terminalDimension(c, "rows", defaultTerminalRows)
+	if !ok {
+		return
+	}
+
+	command := c.Query("command")
+	if err := executor.ValidateTerminal(command); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, executor.ErrTerminalUnsupported) {
+			status = http.StatusNotImplemented
+		}
+		c.JSON(status, Response{
+			Success: false,
+			Error:   "Failed to start terminal: " + err.Error(),
+		})
+		return
+	}
+
+	// The shell is only started once the handshake, including the origin check, has succeeded, so a
+	// plain or cross-origin GET can't run anything
+	server := websocket.Server{
+		Handshake: checkWebSocketOrigin,
+		Handler: func(ws *websocket.Conn) {
+			session, err := executor.StartTerminal(command, directory, cols, rows)
+			if err != nil {
+				errorMessage, _ := json.Marshal(TerminalErrorMessage{Type: "error", Error: "Failed to start terminal: " + err.Error()})
+				websocket.Message.Send(ws, string(errorMessage))
+				return
+			}
+			ws.PayloadType = websocket.BinaryFrame
+			runTerminalSession(ws, session)
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// runTerminalSession pipes the terminal to the WebSocket until the shell exits, the client disconnects,
+// or the session reaches the maximum command duration
+func runTerminalSession(ws *websocket.Conn, session *executor.TerminalSession) {
+	// Client input and resizes
+	go func() {
+		for {
+			var message TerminalMessage
+			if err := websocket.JSON.Receive(ws, &message); err != nil {
+				// The client went away; killing the shell also ends the output loop below
+				session.Close()
+				return
+			}
+			switch message.Type {
+			case "input":
+				session.Write([]byte(message.Data))
+			case "resize":
+				if err := session.Resize(message.Cols, message.Rows); err != nil {
+					log.Printf("Terminal resize failed: %v", err)
+				}
+			}
+		}
+	}()
+
+	timer := time.AfterFunc(maxCommandTimeout, session.Close)
+	defer timer.Stop()
+
+	// Terminal output; reading fails once the shell exits and the terminal is closed
+	buffer := make([]byte, terminalReadBufferSize)
+	for {
+		n, err := session.Read(buffer)
+		if n > 0 {
+			if sendErr := websocket.Message.Send(ws, buffer[:n]); sendErr != nil {
+				session.Close()
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	// Always reap the shell, including after Close killed it, so no zombie is left behind
+	exitCode, signal := session.Wait()
+	exitMessage, _ := json.Marshal(TerminalExitMessage{Type: "exit", ExitCode: exitCode, Signal: signal})
+	websocket.Message.Send(ws, string(exitMessage))
+}
+
+// terminalDimension reads a terminal size query parameter, writing an error response and returning
+// false when it is not a positive number
+func terminalDimension(c *gin.Context, name string, fallback uint16) (uint16, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return fallback, true
+	}
+	n, err := strconv.ParseUint(value, 10, 16)
+	if err != nil || n == 0 {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Invalid " + name + ": must be a positive number",
+		})
+		return 0, false
+	}
+	return uint16(n), true
+}
+
+// checkWebSocketOrigin rejects WebSocket handshakes from origins outside CORS_ALLOWED_ORIGINS, since
+// browsers don't apply CORS to WebSockets. Any origin is accepted when no origins are configured.
+func checkWebSocketOrigin(config *websocket.Config, req *http.Request) error {
+	origins := corsAllowedOrigins()
+	if len(origins) == 0 {
+		return nil
+	}
+
+	origin := req.Header.Get("Origin")
+	for _, allowedOrigin := range origins {
+		if origin == allowedOrigin {
+			return nil
+		}
+	}
+	return errors.New("origin not allowed: " + origin)
+}
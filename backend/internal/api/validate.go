@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/prathyushnallamothu/startit/backend/internal/git"
+)
+
+// validateTimeout bounds how long checking a remote may take, so the UI gets fast feedback
+const validateTimeout = 15 * time.Second
+
+// ValidateRepositoryRequest represents a request to check a git URL without cloning it
+type ValidateRepositoryRequest struct {
+	URL        string `json:"url" binding:"required"`
+	Token      string `json:"token"`
+	SSHKeyPath string `json:"sshKeyPath"`
+}
+
+// ValidateRepositoryResponse describes a reachable repository and the refs it advertises
+type ValidateRepositoryResponse struct {
+	URL           string   `json:"url"`
+	DefaultBranch string   `json:"defaultBranch,omitempty"`
+	Branches      []string `json:"branches"`
+	Tags          []string `json:"tags"`
+}
+
+// HandleRepositoryValidate checks that a URL points to a reachable git repository and lists its branches and tags
+func HandleRepositoryValidate(c *gin.Context) {
+	var req ValidateRepositoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	// Cheap syntactic check before talking to the remote
+	if !isValidGitURL(req.URL) {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Invalid git repository URL",
+		})
+		return
+	}
+
+	repo := newRemoteRepository(req.URL, req.Token, req.SSHKeyPath)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), validateTimeout)
+	defer cancel()
+
+	refs, err := repo.ListRemoteRefs(ctx)
+	if err != nil {
+		respondWithRemoteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Success: true,
+		Data: ValidateRepositoryResponse{
+			URL:           req.URL,
+			DefaultBranch: refs.DefaultBranch,
+			Branches:      refs.Branches,
+			Tags:          refs.Tags,
+		},
+	})
+}
+
+// newRemoteRepository prepares a repository for talking to a remote without a local clone,
+// authenticating only with the token the request gave and going through GIT_PROXY if it is set
+func newRemoteRepository(url, token, sshKeyPath string) *git.Repository {
+	repo := git.NewRepository(url, "", "")
+	repo.SetSSHKeyPath(sshKeyPath)
+	repo.SetProxy(cloneProxy(""))
+	repo.SetToken(token)
+	return repo
+}
+
+// respondWithRemoteError writes the error response for a failed ls-remote, using the clone error
+// classification so unreachable, missing and private repositories get distinct status codes
+func respondWithRemoteError(c *gin.Context, err error) {
+	var cloneErr *git.CloneError
+	if !errors.As(err, &cloneErr) {
+		c.JSON(http.StatusBadRequest, Response{
+			Success: false,
+			Error:   "Invalid git repository URL: " + err.Error(),
+		})
+		return
+	}
+	c.JSON(cloneErrorStatus(cloneErr.Kind), Response{
+		Success: false,
+		Error:   "Repository is not reachable: " + err.Error(),
+		Data:    ErrorDetails{ErrorCode: string(cloneErr.Kind)},
+	})
+}
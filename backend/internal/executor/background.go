@@ -2,10 +2,19 @@ package executor
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 	"sync"
 	"strings"
 	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/prathyushnallamothu/startit/backend/internal/logging"
+	"github.com/prathyushnallamothu/startit/backend/internal/metrics"
 )
 
 // CommandStatus represents the status of a background command
@@ -17,6 +26,27 @@ const (
 	StatusCompleted CommandStatus = "completed"
 	StatusFailed    CommandStatus = "failed"
 	StatusTimeout   CommandStatus = "timeout"
+	StatusCancelled CommandStatus = "cancelled"
+)
+
+// Event types delivered to output subscribers
+const (
+	EventStdout   = "stdout"
+	EventStderr   = "stderr"
+	EventComplete = "complete"
+)
+
+// subscriberBufferSize is how many events a slow subscriber may lag behind before events are dropped
+const subscriberBufferSize = 256
+
+// MaxRecentOutputLines is how many of the latest output lines are kept for GetRecentOutput
+const MaxRecentOutputLines = 1000
+
+var (
+	// ErrCommandNotFound is returned when no background command has the given ID
+	ErrCommandNotFound = errors.New("command not found")
+	// ErrCommandNotRunning is returned when cancelling a command that has already finished
+	ErrCommandNotRunning = errors.New("command is not running")
 )
 
 // BackgroundCommand represents a command running in the background
@@ -29,16 +59,40 @@ type BackgroundCommand struct {
 	EndTime      *time.Time     `json:"endTime,omitempty"`
 	Result       *CommandResult `json:"result,omitempty"`
 	Error        string         `json:"error,omitempty"`
-	currentOutput string         `json:"currentOutput,omitempty"`
-	currentError  string         `json:"currentError,omitempty"`
+	currentOutput string
+	currentError  string
+	recentOutput *lineRing
+	recentError  *lineRing
+	cancel       context.CancelFunc
+	subscribers  []chan OutputEvent
+	completion   *OutputEvent
+	done         chan struct{} // Closed once the command reaches a terminal status
+	logFile      *os.File // Combined stdout and stderr, when the command was started with a log file
+	logPath      string
+	callbackURL  string // Receives a CallbackPayload once the command finishes, when set
 	mutex        sync.Mutex     `json:"-"`
 }
 
+// OutputEvent is a single event streamed to subscribers of a background command
+type OutputEvent struct {
+	Type     string        `json:"type"`
+	Data     string        `json:"data,omitempty"`
+	Status   CommandStatus `json:"status,omitempty"`
+	ExitCode *int          `json:"exitCode,omitempty"`
+	Signal   string        `json:"signal,omitempty"`
+}
+
 // AppendOutput adds new output to the command's current output buffer
 func (cmd *BackgroundCommand) AppendOutput(output string) {
 	cmd.mutex.Lock()
 	defer cmd.mutex.Unlock()
 	cmd.currentOutput += output
+	if cmd.recentOutput == nil {
+		cmd.recentOutput = newLineRing(MaxRecentOutputLines)
+	}
+	cmd.recentOutput.write(output)
+	cmd.writeLog(output)
+	cmd.publish(OutputEvent{Type: EventStdout, Data: output})
 }
 
 // AppendError adds new error output to the command's current error buffer
@@ -46,6 +100,139 @@ func (cmd *BackgroundCommand) AppendError(errorText string) {
 	cmd.mutex.Lock()
 	defer cmd.mutex.Unlock()
 	cmd.currentError += errorText
+	if cmd.recentError == nil {
+		cmd.recentError = newLineRing(MaxRecentOutputLines)
+	}
+	cmd.recentError.write(errorText)
+	cmd.writeLog(errorText)
+	cmd.publish(OutputEvent{Type: EventStderr, Data: errorText})
+}
+
+// writeLog appends output to the command's log file, if it has one; the caller must hold the mutex.
+// The log is abandoned after a failed write rather than failing the command.
+func (cmd *BackgroundCommand) writeLog(text string) {
+	if cmd.logFile == nil {
+		return
+	}
+	if _, err := cmd.logFile.WriteString(text); err != nil {
+		logging.Warnf("Command [%s] log file write failed, no longer logging: %v", cmd.ID, err)
+		cmd.logFile.Close()
+		cmd.logFile = nil
+	}
+}
+
+// LogPath returns the path of the command's log file, or "" when it was started without one
+func (cmd *BackgroundCommand) LogPath() string {
+	cmd.mutex.Lock()
+	defer cmd.mutex.Unlock()
+	return cmd.logPath
+}
+
+// removeLog closes and deletes the command's log file
+func (cmd *BackgroundCommand) removeLog() {
+	cmd.mutex.Lock()
+	defer cmd.mutex.Unlock()
+	if cmd.logFile != nil {
+		cmd.logFile.Close()
+		cmd.logFile = nil
+	}
+	if cmd.logPath != "" {
+		if err := os.Remove(cmd.logPath); err != nil && !os.IsNotExist(err) {
+			logging.Warnf("Failed to remove log file of command [%s]: %v", cmd.ID, err)
+		}
+		cmd.logPath = ""
+	}
+}
+
+// Subscribe returns a channel of output events, starting with the output produced so far.
+// The channel is closed when the command finishes; call the returned func to stop early.
+func (cmd *BackgroundCommand) Subscribe() (<-chan OutputEvent, func()) {
+	cmd.mutex.Lock()
+	defer cmd.mutex.Unlock()
+
+	ch := make(chan OutputEvent, subscriberBufferSize)
+	if cmd.currentOutput != "" {
+		ch <- OutputEvent{Type: EventStdout, Data: cmd.currentOutput}
+	}
+	if cmd.currentError != "" {
+		ch <- OutputEvent{Type: EventStderr, Data: cmd.currentError}
+	}
+
+	// Finished commands only replay their output
+	if cmd.completion != nil {
+		close(ch)
+		return ch, func() {}
+	}
+
+	cmd.subscribers = append(cmd.subscribers, ch)
+	return ch, func() { cmd.unsubscribe(ch) }
+}
+
+// CompletionEvent returns the final event of a finished command, or false while it is still running
+func (cmd *BackgroundCommand) CompletionEvent() (OutputEvent, bool) {
+	cmd.mutex.Lock()
+	defer cmd.mutex.Unlock()
+	if cmd.completion == nil {
+		return OutputEvent{}, false
+	}
+	return *cmd.completion, true
+}
+
+// Done returns a channel that is closed once the command has completed, failed, timed out or been cancelled
+func (cmd *BackgroundCommand) Done() <-chan struct{} {
+	return cmd.done
+}
+
+// unsubscribe removes and closes a subscriber channel if it is still registered
+func (cmd *BackgroundCommand) unsubscribe(ch chan OutputEvent) {
+	cmd.mutex.Lock()
+	defer cmd.mutex.Unlock()
+	for i, sub := range cmd.subscribers {
+		if sub == ch {
+			cmd.subscribers = append(cmd.subscribers[:i], cmd.subscribers[i+1:]...)
+			close(ch)
+			return
+		}
+	}
+}
+
+// publish delivers an event to all subscribers without blocking; the caller must hold the mutex
+func (cmd *BackgroundCommand) publish(event OutputEvent) {
+	for _, ch := range cmd.subscribers {
+		select {
+		case ch <- event:
+		default:
+			logging.Debugf("Command [%s] subscriber is falling behind, dropping %s event", cmd.ID, event.Type)
+		}
+	}
+}
+
+// finish records the completion event and closes all subscriber channels
+func (cmd *BackgroundCommand) finish() {
+	event := OutputEvent{Type: EventComplete, Status: cmd.Status, Data: cmd.Error}
+	if cmd.Result != nil {
+		exitCode := cmd.Result.ExitCode
+		event.ExitCode = &exitCode
+		event.Signal = cmd.Result.Signal
+	}
+
+	cmd.mutex.Lock()
+	defer cmd.mutex.Unlock()
+	cmd.completion = &event
+	close(cmd.done)
+	if cmd.logFile != nil {
+		cmd.logFile.Close()
+		cmd.logFile = nil
+	}
+	for _, ch := range cmd.subscribers {
+		close(ch)
+	}
+	cmd.subscribers = nil
+
+	// Notify the callback without holding up anything waiting on the command
+	if cmd.callbackURL != "" {
+		go sendCallback(cmd.callbackURL, cmd.callbackPayload())
+	}
 }
 
 // GetCurrentOutput returns the current output buffer
@@ -62,19 +249,94 @@ func (cmd *BackgroundCommand) GetCurrentError() string {
 	return cmd.currentError
 }
 
+// GetOutputSince returns the output produced after the given byte offset along with the offset
+// to pass on the next call. Offsets past the end return no output.
+func (cmd *BackgroundCommand) GetOutputSince(offset int) (string, int) {
+	cmd.mutex.Lock()
+	defer cmd.mutex.Unlock()
+	return textSince(cmd.currentOutput, offset), len(cmd.currentOutput)
+}
+
+// GetErrorSince returns the error output produced after the given byte offset along with the
+// offset to pass on the next call
+func (cmd *BackgroundCommand) GetErrorSince(offset int) (string, int) {
+	cmd.mutex.Lock()
+	defer cmd.mutex.Unlock()
+	return textSince(cmd.currentError, offset), len(cmd.currentError)
+}
+
+// Helper function returning the part of text after offset bytes
+func textSince(text string, offset int) string {
+	if offset <= 0 {
+		return text
+	}
+	if offset >= len(text) {
+		return ""
+	}
+	return text[offset:]
+}
+
+// GetRecentOutput returns the last lines lines of output, up to MaxRecentOutputLines
+func (cmd *BackgroundCommand) GetRecentOutput(lines int) string {
+	cmd.mutex.Lock()
+	defer cmd.mutex.Unlock()
+	if cmd.recentOutput == nil {
+		return ""
+	}
+	return cmd.recentOutput.last(lines)
+}
+
+// GetRecentError returns the last lines lines of error output, up to MaxRecentOutputLines
+func (cmd *BackgroundCommand) GetRecentError(lines int) string {
+	cmd.mutex.Lock()
+	defer cmd.mutex.Unlock()
+	if cmd.recentError == nil {
+		return ""
+	}
+	return cmd.recentError.last(lines)
+}
+
+// CommandSummary is a lightweight view of a background command used for listings
+type CommandSummary struct {
+	ID        string        `json:"id"`
+	Command   string        `json:"command"`
+	Status    CommandStatus `json:"status"`
+	StartTime time.Time     `json:"startTime"`
+	EndTime   *time.Time    `json:"endTime,omitempty"`
+}
+
+// DefaultMaxConcurrentCommands is how many background commands may run at once; the rest wait as pending
+var DefaultMaxConcurrentCommands = 4
+
 // BackgroundCommandManager manages commands running in the background
 type BackgroundCommandManager struct {
-	mutex    sync.RWMutex
-	commands map[string]*BackgroundCommand
+	mutex        sync.RWMutex
+	commands     map[string]*BackgroundCommand
+	slots        chan struct{}
+	wg           sync.WaitGroup // Tracks command goroutines so shutdown can wait for them
+	shuttingDown bool
 }
 
 // NewBackgroundCommandManager creates a new background command manager
 func NewBackgroundCommandManager() *BackgroundCommandManager {
+	maxConcurrent := DefaultMaxConcurrentCommands
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+
 	return &BackgroundCommandManager{
 		commands: make(map[string]*BackgroundCommand),
+		slots:    make(chan struct{}, maxConcurrent),
 	}
 }
 
+// CommandCounts reports how many background commands are currently running and waiting for a slot
+type CommandCounts struct {
+	Running       int `json:"running"`
+	Pending       int `json:"pending"`
+	MaxConcurrent int `json:"maxConcurrent"`
+}
+
 // singleton instance of the background command manager
 var (
 	backgroundManager     *BackgroundCommandManager
@@ -85,65 +347,170 @@ var (
 func GetBackgroundManager() *BackgroundCommandManager {
 	backgroundManagerOnce.Do(func() {
 		backgroundManager = NewBackgroundCommandManager()
+
+		// Expose running and pending counts to the metrics endpoint
+		metrics.RegisterGaugeFunc("startit_background_commands", "Background commands by status.", "status", func() map[string]float64 {
+			counts := backgroundManager.CountCommands()
+			return map[string]float64{
+				string(StatusRunning): float64(counts.Running),
+				string(StatusPending): float64(counts.Pending),
+			}
+		})
 	})
 	return backgroundManager
 }
 
-// ExecuteCommandInBackground starts a command in the background and returns its ID
-func (m *BackgroundCommandManager) ExecuteCommandInBackground(command, repoPath string) string {
-	// Generate a unique ID for this command
-	id := time.Now().Format("20060102150405") + "-" + command[:min(10, len(command))]
+// DefaultBackgroundTimeout is used when a background command is started without a timeout
+const DefaultBackgroundTimeout = 10 * time.Minute
+
+// BackgroundTask is the work done by a background command. It reports output through the callbacks
+// as it runs and must stop when ctx is done.
+type BackgroundTask func(ctx context.Context, onStdout, onStderr func(string)) (*CommandResult, error)
+
+// BackgroundOptions are optional settings for a background command
+type BackgroundOptions struct {
+	Env     []string // Extra KEY=VALUE environment variables for the command
+	LogPath string   // When set, combined stdout and stderr are also written to this file
+	Limits  ResourceLimits
+	RunAs   *RunAs // User the command runs as; nil uses DefaultRunAs
+	// KeepANSI keeps ANSI escape sequences in the output instead of stripping them
+	KeepANSI bool
+	// CallbackURL, when set, receives a POST with the command's final result; see ValidateCallbackURL
+	CallbackURL string
+}
+
+// ExecuteCommandInBackground starts a command in the background and returns its ID.
+// A timeout of zero or less falls back to DefaultBackgroundTimeout.
+func (m *BackgroundCommandManager) ExecuteCommandInBackground(command, repoPath string, timeout time.Duration, opts BackgroundOptions) (string, error) {
+	if timeout <= 0 {
+		timeout = DefaultBackgroundTimeout
+	}
+
+	// Create the log file up front so a bad location is reported instead of silently losing the logs
+	var logFile *os.File
+	if opts.LogPath != "" {
+		if err := os.MkdirAll(filepath.Dir(opts.LogPath), 0755); err != nil {
+			return "", fmt.Errorf("failed to create log directory: %w", err)
+		}
+		var err error
+		if logFile, err = os.OpenFile(opts.LogPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600); err != nil {
+			return "", fmt.Errorf("failed to create log file: %w", err)
+		}
+	}
+
+	return m.runInBackground(command, repoPath, timeout, logFile, opts.CallbackURL, func(ctx context.Context, onStdout, onStderr func(string)) (*CommandResult, error) {
+		ctx = WithKeepANSI(WithRunAs(WithResourceLimits(WithEnv(ctx, opts.Env), opts.Limits), opts.RunAs), opts.KeepANSI)
+
+		// Handle more complex commands with pipes, redirects, etc.
+		if isComplexCommand(command) {
+			return ExecuteShellCommandWithStreaming(ctx, command, repoPath, timeout, onStdout, onStderr)
+		}
+
+		// For simple commands, parse and use the streaming executor
+		cmd, args, err := ParseCommandString(command)
+		if err != nil {
+			return nil, err
+		}
+		return ExecuteCommandWithStreaming(ctx, cmd, args, repoPath, timeout, onStdout, onStderr)
+	}), nil
+}
+
+// newCommandID generates a random ID that is not already in use. The caller must hold the mutex.
+func (m *BackgroundCommandManager) newCommandID() string {
+	for {
+		id := uuid.New().String()
+		if _, exists := m.commands[id]; !exists {
+			return id
+		}
+	}
+}
+
+// RunInBackground runs an arbitrary task as a background command and returns its ID. The task is
+// tracked, limited, cancelled and streamed exactly like a shell command; command describes it in listings.
+// A timeout of zero or less falls back to DefaultBackgroundTimeout.
+func (m *BackgroundCommandManager) RunInBackground(command, repoPath string, timeout time.Duration, task BackgroundTask) string {
+	return m.runInBackground(command, repoPath, timeout, nil, "", task)
+}
+
+// runInBackground starts a background task, writing its output to logFile as well when it is not nil
+// and posting the result to callbackURL when it is not empty
+func (m *BackgroundCommandManager) runInBackground(command, repoPath string, timeout time.Duration, logFile *os.File, callbackURL string, task BackgroundTask) string {
+	if timeout <= 0 {
+		timeout = DefaultBackgroundTimeout
+	}
+
+	// Create a cancellable context; the cancel func is kept so the command can be stopped while
+	// pending or running. The timeout only starts once the command gets a slot.
+	queueCtx, cancel := context.WithCancel(context.Background())
 
 	// Create the background command object
 	bgCmd := &BackgroundCommand{
-		ID:        id,
-		Command:   command,
-		RepoPath:  repoPath,
-		Status:    StatusPending,
-		StartTime: time.Now(),
+		Command:     command,
+		RepoPath:    repoPath,
+		Status:      StatusPending,
+		StartTime:   time.Now(),
+		cancel:      cancel,
+		done:        make(chan struct{}),
+		logFile:     logFile,
+		callbackURL: callbackURL,
+	}
+	if logFile != nil {
+		bgCmd.logPath = logFile.Name()
 	}
 
-	// Store the command in the manager
+	// Store the command in the manager. The wait group is joined under the same lock Shutdown takes, so
+	// Shutdown always waits for commands registered before it; later ones are cancelled right here since
+	// Shutdown may already be waiting.
 	m.mutex.Lock()
+	id := m.newCommandID()
+	bgCmd.ID = id
 	m.commands[id] = bgCmd
+	if m.shuttingDown {
+		cancel()
+		markCancelledBeforeStart(bgCmd)
+		m.mutex.Unlock()
+		return id
+	}
+	m.wg.Add(1)
 	m.mutex.Unlock()
 
 	// Start the command in a goroutine
 	go func() {
-		log.Printf("Starting background command [%s]: %s in %s", id, command, repoPath)
-		bgCmd.Status = StatusRunning
-
-		// Create context with timeout
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer m.wg.Done()
 		defer cancel()
 
-		// Execute the command
-		var result *CommandResult
-		var err error
+		// Wait for a free slot; the command stays pending until one is available
+		select {
+		case m.slots <- struct{}{}:
+			defer func() { <-m.slots }()
+		case <-queueCtx.Done():
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			markCancelledBeforeStart(bgCmd)
+			return
+		}
+
+		ctx, cancelTimeout := context.WithTimeout(queueCtx, timeout)
+		defer cancelTimeout()
+
+		logging.Infof("Starting background command [%s]: %s in %s", id, logging.RedactSecrets(command), repoPath)
+		m.mutex.Lock()
+		bgCmd.Status = StatusRunning
+		m.mutex.Unlock()
 
 		// Define output handlers that will update the real-time output buffers
 		onStdout := func(output string) {
 			bgCmd.AppendOutput(output)
-			log.Printf("Command [%s] stdout: %s", id, strings.TrimSpace(output))
+			logging.Debugf("Command [%s] stdout: %s", id, strings.TrimSpace(output))
 		}
 
 		onStderr := func(errText string) {
 			bgCmd.AppendError(errText)
-			log.Printf("Command [%s] stderr: %s", id, strings.TrimSpace(errText))
+			logging.Debugf("Command [%s] stderr: %s", id, strings.TrimSpace(errText))
 		}
 
-		// Handle more complex commands with pipes, redirects, etc.
-		if isComplexCommand(command) {
-			result, err = ExecuteShellCommandWithStreaming(ctx, command, repoPath, 10*time.Minute, onStdout, onStderr)
-		} else {
-			// For simple commands, parse and use the streaming executor
-			cmd, args, parseErr := ParseCommandString(command)
-			if parseErr != nil {
-				err = parseErr
-			} else {
-				result, err = ExecuteCommandWithStreaming(ctx, cmd, args, repoPath, 10*time.Minute, onStdout, onStderr)
-			}
-		}
+		// Execute the task
+		result, err := task(ctx, onStdout, onStderr)
 
 		// Update the command status based on the result
 		m.mutex.Lock()
@@ -152,21 +519,30 @@ func (m *BackgroundCommandManager) ExecuteCommandInBackground(command, repoPath
 		// Check if command still exists (it might have been removed)
 		bgCmd, exists := m.commands[id]
 		if !exists {
-			log.Printf("Background command [%s] no longer exists in manager, discarding results", id)
+			logging.Warnf("Background command [%s] no longer exists in manager, discarding results", id)
 			return
 		}
 
-		if err != nil {
+		if errors.Is(queueCtx.Err(), context.Canceled) {
+			endTime := time.Now()
+			bgCmd.EndTime = &endTime
+			bgCmd.Result = result
+			bgCmd.Status = StatusCancelled
+			bgCmd.Error = "command was cancelled"
+			logging.Infof("Background command [%s] was cancelled", id)
+		} else if err != nil {
 			endTime := time.Now()
 			bgCmd.EndTime = &endTime
 			bgCmd.Error = err.Error()
 			
-			if err == context.DeadlineExceeded {
+			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrTimeout) {
+				// Keep the partial result so users can see how far the command got
+				bgCmd.Result = result
 				bgCmd.Status = StatusTimeout
-				log.Printf("Background command [%s] timed out", id)
+				logging.Warnf("Background command [%s] timed out", id)
 			} else {
 				bgCmd.Status = StatusFailed
-				log.Printf("Background command [%s] failed: %v", id, err)
+				logging.Warnf("Background command [%s] failed: %s", id, logging.RedactSecrets(err.Error()))
 			}
 		} else {
 			endTime := time.Now()
@@ -175,17 +551,34 @@ func (m *BackgroundCommandManager) ExecuteCommandInBackground(command, repoPath
 			
 			if result.ExitCode != 0 {
 				bgCmd.Status = StatusFailed
-				log.Printf("Background command [%s] completed with non-zero exit code: %d", id, result.ExitCode)
+				logging.Infof("Background command [%s] completed with non-zero exit code: %d", id, result.ExitCode)
 			} else {
 				bgCmd.Status = StatusCompleted
-				log.Printf("Background command [%s] completed successfully", id)
+				logging.Infof("Background command [%s] completed successfully", id)
 			}
 		}
+
+		metrics.CommandExecutions.Inc(exitClass(bgCmd))
+
+		// Let any streaming subscribers know the command is done
+		bgCmd.finish()
 	}()
 
 	return id
 }
 
+// markCancelledBeforeStart records that a pending command was cancelled before it got a slot; the caller
+// must hold the manager's mutex
+func markCancelledBeforeStart(bgCmd *BackgroundCommand) {
+	endTime := time.Now()
+	bgCmd.EndTime = &endTime
+	bgCmd.Status = StatusCancelled
+	bgCmd.Error = "command was cancelled"
+	logging.Infof("Background command [%s] was cancelled before it started", bgCmd.ID)
+	metrics.CommandExecutions.Inc(metrics.ExitCancelled)
+	bgCmd.finish()
+}
+
 // GetCommandStatus returns the status of a background command
 func (m *BackgroundCommandManager) GetCommandStatus(id string) (*BackgroundCommand, bool) {
 	m.mutex.RLock()
@@ -195,20 +588,191 @@ func (m *BackgroundCommandManager) GetCommandStatus(id string) (*BackgroundComma
 	return bgCmd, exists
 }
 
-// CleanupCompletedCommands removes completed commands older than the specified duration
-func (m *BackgroundCommandManager) CleanupCompletedCommands(olderThan time.Duration) {
+// CommandSnapshot is a copy of a background command's status fields, which the goroutine running the
+// command updates under the manager's lock
+type CommandSnapshot struct {
+	ID        string
+	Status    CommandStatus
+	StartTime time.Time
+	EndTime   *time.Time
+	Result    *CommandResult
+	Error     string
+}
+
+// GetCommandSnapshot returns a background command along with a snapshot of its status fields taken under
+// the manager's lock. Read the status from the snapshot; the command itself is for its output and logs.
+func (m *BackgroundCommandManager) GetCommandSnapshot(id string) (*BackgroundCommand, CommandSnapshot, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	bgCmd, exists := m.commands[id]
+	if !exists {
+		return nil, CommandSnapshot{}, false
+	}
+
+	snapshot := CommandSnapshot{
+		ID:        bgCmd.ID,
+		Status:    bgCmd.Status,
+		StartTime: bgCmd.StartTime,
+		Error:     bgCmd.Error,
+	}
+	if bgCmd.EndTime != nil {
+		endTime := *bgCmd.EndTime
+		snapshot.EndTime = &endTime
+	}
+	if bgCmd.Result != nil {
+		result := *bgCmd.Result
+		snapshot.Result = &result
+	}
+	return bgCmd, snapshot, true
+}
+
+// CancelCommand stops a pending or running background command
+func (m *BackgroundCommandManager) CancelCommand(id string) error {
+	// Status is written under the manager's lock, so check it while holding the lock too
+	m.mutex.RLock()
+	bgCmd, exists := m.commands[id]
+	running := exists && (bgCmd.Status == StatusPending || bgCmd.Status == StatusRunning)
+	m.mutex.RUnlock()
+
+	if !exists {
+		return ErrCommandNotFound
+	}
+	if !running {
+		return ErrCommandNotRunning
+	}
+
+	logging.Infof("Cancelling background command [%s]", id)
+	bgCmd.cancel()
+	return nil
+}
+
+// CancelAll cancels every pending and running command and returns how many were cancelled. Unlike
+// Shutdown it doesn't wait for them to stop, and new commands can still be started.
+func (m *BackgroundCommandManager) CancelAll() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	cancelled := 0
+	for id, cmd := range m.commands {
+		if cmd.Status == StatusPending || cmd.Status == StatusRunning {
+			logging.Infof("Cancelling background command [%s]", id)
+			cmd.cancel()
+			cancelled++
+		}
+	}
+	return cancelled
+}
+
+// ListCommands returns summaries of all tracked commands, newest first
+func (m *BackgroundCommandManager) ListCommands() []CommandSummary {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	summaries := make([]CommandSummary, 0, len(m.commands))
+	for _, cmd := range m.commands {
+		summaries = append(summaries, CommandSummary{
+			ID:        cmd.ID,
+			Command:   cmd.Command,
+			Status:    cmd.Status,
+			StartTime: cmd.StartTime,
+			EndTime:   cmd.EndTime,
+		})
+	}
+
+	// Newest first; IDs break ties so pages stay stable between requests
+	sort.Slice(summaries, func(i, j int) bool {
+		if !summaries[i].StartTime.Equal(summaries[j].StartTime) {
+			return summaries[i].StartTime.After(summaries[j].StartTime)
+		}
+		return summaries[i].ID < summaries[j].ID
+	})
+
+	return summaries
+}
+
+// Shutdown cancels every pending and running command and waits for them to stop until ctx is done.
+// Commands started afterwards are cancelled immediately. It returns how many commands were interrupted.
+func (m *BackgroundCommandManager) Shutdown(ctx context.Context) (int, error) {
+	m.mutex.Lock()
+	m.shuttingDown = true
+	interrupted := 0
+	for _, cmd := range m.commands {
+		if cmd.Status == StatusPending || cmd.Status == StatusRunning {
+			cmd.cancel()
+			interrupted++
+		}
+	}
+	m.mutex.Unlock()
+
+	// Wait for the command goroutines to record their final status
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return interrupted, nil
+	case <-ctx.Done():
+		return interrupted, ctx.Err()
+	}
+}
+
+// CountCommands returns how many commands are running and how many are waiting for a slot
+func (m *BackgroundCommandManager) CountCommands() CommandCounts {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	counts := CommandCounts{MaxConcurrent: cap(m.slots)}
+	for _, cmd := range m.commands {
+		switch cmd.Status {
+		case StatusRunning:
+			counts.Running++
+		case StatusPending:
+			counts.Pending++
+		}
+	}
+	return counts
+}
+
+// CleanupCompletedCommands removes completed commands older than the specified duration and returns
+// how many were removed
+func (m *BackgroundCommandManager) CleanupCompletedCommands(olderThan time.Duration) int {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	removed := 0
 	now := time.Now()
 	for id, cmd := range m.commands {
 		// Only clean up completed or failed commands
-		if (cmd.Status == StatusCompleted || cmd.Status == StatusFailed || cmd.Status == StatusTimeout) && 
+		if (cmd.Status == StatusCompleted || cmd.Status == StatusFailed || cmd.Status == StatusTimeout || cmd.Status == StatusCancelled) && 
 		   cmd.EndTime != nil && now.Sub(*cmd.EndTime) > olderThan {
 			delete(m.commands, id)
-			log.Printf("Cleaned up background command [%s]", id)
+			cmd.removeLog()
+			removed++
+			logging.Debugf("Cleaned up background command [%s]", id)
 		}
 	}
+	return removed
+}
+
+// exitClass maps a finished command to its metrics exit-code class
+func exitClass(cmd *BackgroundCommand) string {
+	switch cmd.Status {
+	case StatusCompleted:
+		return metrics.ExitSuccess
+	case StatusTimeout:
+		return metrics.ExitTimeout
+	case StatusCancelled:
+		return metrics.ExitCancelled
+	}
+	// Failed commands without a result never got to run
+	if cmd.Result == nil {
+		return metrics.ExitError
+	}
+	return metrics.ExitFailure
 }
 
 // isComplexCommand checks if a command contains shell operators
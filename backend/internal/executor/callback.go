@@ -0,0 +1,121 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/prathyushnallamothu/startit/backend/internal/logging"
+)
+
+// Callback delivery settings: each attempt gets callbackTimeout, and the wait between attempts doubles
+// from callbackRetryDelay
+const (
+	callbackAttempts   = 3
+	callbackTimeout    = 10 * time.Second
+	callbackRetryDelay = 2 * time.Second
+)
+
+// callbackClient posts completion callbacks; redirects are not followed so a callback can't be bounced elsewhere
+var callbackClient = &http.Client{
+	Timeout: callbackTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// CallbackPayload is POSTed as JSON to a background command's callback URL once it reaches a terminal status
+type CallbackPayload struct {
+	ID          string        `json:"id"`
+	Command     string        `json:"command"`
+	RepoPath    string        `json:"repoPath"`
+	Status      CommandStatus `json:"status"`
+	ExitCode    *int          `json:"exitCode,omitempty"`
+	Signal      string        `json:"signal,omitempty"`
+	TimedOut    bool          `json:"timedOut,omitempty"`
+	Output      string        `json:"output"`
+	ErrorOutput string        `json:"errorOutput"`
+	Error       string        `json:"error,omitempty"`
+	StartTime   time.Time     `json:"startTime"`
+	EndTime     *time.Time    `json:"endTime,omitempty"`
+}
+
+// ValidateCallbackURL checks that callbackURL is an absolute http or https URL
+func ValidateCallbackURL(callbackURL string) error {
+	parsed, err := url.Parse(callbackURL)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return fmt.Errorf("invalid callback URL %q: use an http:// or https:// URL", callbackURL)
+	}
+	return nil
+}
+
+// callbackPayload describes the finished command; the caller must hold cmd.mutex
+func (cmd *BackgroundCommand) callbackPayload() CallbackPayload {
+	payload := CallbackPayload{
+		ID:          cmd.ID,
+		Command:     cmd.Command,
+		RepoPath:    cmd.RepoPath,
+		Status:      cmd.Status,
+		Output:      cmd.currentOutput,
+		ErrorOutput: cmd.currentError,
+		Error:       cmd.Error,
+		StartTime:   cmd.StartTime,
+		EndTime:     cmd.EndTime,
+	}
+	if cmd.Result != nil {
+		exitCode := cmd.Result.ExitCode
+		payload.ExitCode = &exitCode
+		payload.Signal = cmd.Result.Signal
+		payload.TimedOut = cmd.Result.TimedOut
+		payload.Output = cmd.Result.Output
+		payload.ErrorOutput = cmd.Result.Error
+	}
+	return payload
+}
+
+// sendCallback posts the payload to callbackURL, retrying with backoff when the request fails or the
+// receiver doesn't answer with a 2xx status. Delivery problems are only logged.
+func sendCallback(callbackURL string, payload CallbackPayload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logging.Warnf("Failed to encode callback for command [%s]: %v", payload.ID, err)
+		return
+	}
+
+	delay := callbackRetryDelay
+	for attempt := 1; attempt <= callbackAttempts; attempt++ {
+		if err = postCallback(callbackURL, body); err == nil {
+			logging.Infof("Delivered callback for command [%s]", payload.ID)
+			return
+		}
+		logging.Warnf("Callback for command [%s] failed (attempt %d of %d): %s", payload.ID, attempt, callbackAttempts, logging.RedactSecrets(err.Error()))
+		if attempt < callbackAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	logging.Errorf("Giving up on callback for command [%s] to %s", payload.ID, logging.RedactSecrets(callbackURL))
+}
+
+// Helper function to make a single callback request
+func postCallback(callbackURL string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "startit-callback")
+
+	resp, err := callbackClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+	return nil
+}
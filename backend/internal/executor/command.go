@@ -5,14 +5,31 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"bufio"
+
+	"github.com/prathyushnallamothu/startit/backend/internal/logging"
+)
+
+var (
+	// ErrTimeout is returned when a command runs past its timeout
+	ErrTimeout = errors.New("command timed out")
+	// ErrWorkDirNotFound is returned when the working directory does not exist
+	ErrWorkDirNotFound = errors.New("working directory does not exist")
+	// ErrEmptyCommand is returned when there is no command to run
+	ErrEmptyCommand = errors.New("empty command")
+	// ErrUnsafeCommand is returned when the safety check rejects a command
+	ErrUnsafeCommand = errors.New("command contains potentially unsafe operations")
+	// ErrStartFailed is returned when the process could not be started at all
+	ErrStartFailed = errors.New("failed to start command")
 )
 
 // CommandResult represents the result of a command execution
@@ -20,36 +37,33 @@ type CommandResult struct {
 	Command   string    `json:"command"`
 	Args      string    `json:"args"`
 	ExitCode  int       `json:"exitCode"`
+	Signal    string    `json:"signal,omitempty"` // Signal that killed the process, e.g. SIGKILL; ExitCode is -1 then
 	Output    string    `json:"output"`
 	Error     string    `json:"error,omitempty"`
 	StartTime time.Time `json:"startTime"`
 	EndTime   time.Time `json:"endTime"`
 	Duration  string    `json:"duration"`
+	Truncated bool      `json:"truncated,omitempty"` // Output or error exceeded the size limit
+	TimedOut  bool      `json:"timedOut,omitempty"`  // Killed at its timeout; the output is what it wrote until then
 }
 
 // CommandExecutor handles executing system commands
 type CommandExecutor struct {
-	ShellPath string        // Path to the shell executable
-	timeout   time.Duration // Default timeout for command execution
+	ShellPath      string        // Path to the shell executable
+	timeout        time.Duration // Default timeout for command execution
+	maxOutputBytes int           // Maximum bytes of stdout/stderr kept per command
+	env            []string      // Extra KEY=VALUE environment variables for commands
+	limits         ResourceLimits
+	runAs          *RunAs // User commands run as; nil uses DefaultRunAs
+	keepANSI       bool   // Keep ANSI escape sequences in the output instead of stripping them
 }
 
 // NewCommandExecutor creates a new CommandExecutor
 func NewCommandExecutor() *CommandExecutor {
-	// Default to bash on Unix-like systems, cmd on Windows
-	shellPath := "/bin/bash"
-	if _, err := os.Stat(shellPath); os.IsNotExist(err) {
-		// Try to find a suitable shell
-		for _, shell := range []string{"/bin/zsh", "/bin/sh"} {
-			if _, err := os.Stat(shell); err == nil {
-				shellPath = shell
-				break
-			}
-		}
-	}
-	
 	return &CommandExecutor{
-		ShellPath: shellPath,
-		timeout:   5 * time.Minute, // Default timeout of 5 minutes
+		ShellPath:      DefaultShell(),
+		timeout:        5 * time.Minute, // Default timeout of 5 minutes
+		maxOutputBytes: DefaultMaxOutputBytes,
 	}
 }
 
@@ -58,30 +72,69 @@ func (e *CommandExecutor) SetTimeout(timeout time.Duration) {
 	e.timeout = timeout
 }
 
+// SetMaxOutputBytes sets how much stdout/stderr is kept per command; zero or less means unlimited
+func (e *CommandExecutor) SetMaxOutputBytes(maxBytes int) {
+	e.maxOutputBytes = maxBytes
+}
+
+// SetEnv sets extra KEY=VALUE environment variables for commands, on top of the server's environment
+func (e *CommandExecutor) SetEnv(env []string) {
+	e.env = env
+}
+
+// SetResourceLimits sets the memory and CPU limits commands run under
+func (e *CommandExecutor) SetResourceLimits(limits ResourceLimits) {
+	e.limits = limits
+}
+
+// SetRunAs sets the user commands run as instead of DefaultRunAs
+func (e *CommandExecutor) SetRunAs(runAs *RunAs) {
+	e.runAs = runAs
+}
+
+// SetKeepANSI keeps ANSI escape sequences such as colors in command output instead of stripping them
+func (e *CommandExecutor) SetKeepANSI(keep bool) {
+	e.keepANSI = keep
+}
+
 // Execute runs a command and returns the result
 func (e *CommandExecutor) Execute(command string, args []string, workDir string) (*CommandResult, error) {
+	// Safety check for potentially unsafe commands
+	if containsUnsafeCommand(command) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsafeCommand, command)
+	}
+
 	startTime := time.Now()
 	
 	// Create a context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
 	defer cancel()
 
-	// Prepare the command
-	cmd := exec.CommandContext(ctx, e.ShellPath, "-c", command)
+	// Prepare the command, wrapped in the resource limits and run as the configured user if there are any
+	runAs := e.runAs
+	if runAs == nil {
+		runAs = DefaultRunAs
+	}
+	cmd, err := limitedCommand(ctx, e.ShellPath, shellArgs(e.ShellPath, command), e.limits, runAs)
+	if err != nil {
+		return nil, err
+	}
 	if workDir != "" {
-		if _, err := os.Stat(workDir); os.IsNotExist(err) {
-			return nil, fmt.Errorf("working directory does not exist: %s", workDir)
+		if err := checkWorkDir(workDir); err != nil {
+			return nil, err
 		}
 		cmd.Dir = workDir
 	}
+	cmd.Env = mergeEnv(append(runAs.env(), e.env...))
 
-	// Capture stdout and stderr
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	// Capture stdout and stderr, bounded so noisy commands can't exhaust memory
+	stdout := newLimitedBuffer(e.maxOutputBytes)
+	stderr := newLimitedBuffer(e.maxOutputBytes)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
 	// Execute the command
-	err := cmd.Run()
+	err = cmd.Run()
 	endTime := time.Now()
 	duration := endTime.Sub(startTime)
 
@@ -89,26 +142,30 @@ func (e *CommandExecutor) Execute(command string, args []string, workDir string)
 	result := &CommandResult{
 		Command:   command,
 		Args:      strings.Join(args, " "),
-		Output:    stdout.String(),
+		Output:    bufferedOutput(stdout, e.keepANSI),
 		StartTime: startTime,
 		EndTime:   endTime,
 		Duration:  duration.String(),
+		Truncated: stdout.Truncated() || stderr.Truncated(),
 	}
 
 	// Handle command execution errors
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			return result, fmt.Errorf("command timed out after %s", e.timeout)
+			result.TimedOut = true
+			result.Error = bufferedOutput(stderr, e.keepANSI)
+			return result, fmt.Errorf("%w after %s", ErrTimeout, e.timeout)
 		}
 
 		// Get the exit code if possible
 		if exitError, ok := err.(*exec.ExitError); ok {
 			result.ExitCode = exitError.ExitCode()
+			result.Signal = exitSignal(exitError)
 		} else {
 			result.ExitCode = -1
 		}
 		
-		result.Error = stderr.String()
+		result.Error = bufferedOutput(stderr, e.keepANSI)
 		return result, nil
 	}
 
@@ -121,13 +178,13 @@ func (e *CommandExecutor) Execute(command string, args []string, workDir string)
 func (e *CommandExecutor) ExecuteCommand(command, repoPath string) (string, error) {
 	// Safety check for potentially unsafe commands
 	if containsUnsafeCommand(command) {
-		return "", fmt.Errorf("command contains potentially unsafe operations: %s", command)
+		return "", fmt.Errorf("%w: %s", ErrUnsafeCommand, command)
 	}
 
 	// Split the command into command and arguments
 	parts := strings.Fields(command)
 	if len(parts) == 0 {
-		return "", errors.New("empty command")
+		return "", ErrEmptyCommand
 	}
 
 	cmd := parts[0]
@@ -163,24 +220,37 @@ func ExecuteCommand(ctx context.Context, command string, args []string, dir stri
 	}
 
 	// Log the command execution
-	log.Printf("Executing command: %s %s in directory: %s", command, strings.Join(args, " "), dir)
+	logging.Infof("Executing command: %s in directory: %s", commandForLog(command, args), dir)
+
+	// Safety check for potentially unsafe commands, including shell invocations
+	if fullCommand := strings.TrimSpace(command + " " + strings.Join(args, " ")); containsUnsafeCommand(fullCommand) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsafeCommand, fullCommand)
+	}
 
-	// Prepare the command
-	cmd := exec.CommandContext(ctx, command, args...)
+	// Prepare the command, wrapped in the resource limits and run as the configured user if there are any
+	cmd, err := limitedCommand(ctx, command, args, resourceLimits(ctx), runAsFor(ctx))
+	if err != nil {
+		return nil, err
+	}
 	if dir != "" {
+		if err := checkWorkDir(dir); err != nil {
+			return nil, err
+		}
 		cmd.Dir = dir
 	}
+	cmd.Env = commandEnv(ctx)
 
-	// Set up buffers for stdout and stderr
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	// Set up bounded buffers for stdout and stderr
+	stdout := newLimitedBuffer(DefaultMaxOutputBytes)
+	stderr := newLimitedBuffer(DefaultMaxOutputBytes)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
 	// Record start time
 	startTime := time.Now()
 
 	// Execute the command
-	err := cmd.Run()
+	err = cmd.Run()
 
 	// Record end time
 	endTime := time.Now()
@@ -190,42 +260,49 @@ func ExecuteCommand(ctx context.Context, command string, args []string, dir stri
 	result := &CommandResult{
 		Command:   command,
 		Args:      strings.Join(args, " "),
-		Output:    stdout.String(),
+		Output:    bufferedOutput(stdout, keepANSI(ctx)),
 		StartTime: startTime,
 		EndTime:   endTime,
 		Duration:  duration,
+		Truncated: stdout.Truncated() || stderr.Truncated(),
 	}
 
 	// Handle errors
 	if err != nil {
+		// A command killed at its deadline exits with a signal, so check the context before the exit status
 		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			logging.Warnf("Command timed out: %s", commandForLog(command, args))
+			if timeout <= 0 {
+				// The deadline came from the caller's context
+				return nil, ErrTimeout
+			}
+			return nil, fmt.Errorf("%w after %s", ErrTimeout, timeout.String())
+		} else if errors.As(err, &exitErr) {
 			result.ExitCode = exitErr.ExitCode()
-			log.Printf("Command exited with code %d: %s %s", result.ExitCode, command, strings.Join(args, " "))
-		} else if errors.Is(err, context.DeadlineExceeded) {
-			log.Printf("Command timed out after %s: %s %s", timeout.String(), command, strings.Join(args, " "))
-			return nil, fmt.Errorf("command timed out after %s", timeout.String())
+			result.Signal = exitSignal(exitErr)
+			logging.Infof("Command exited with code %d: %s", result.ExitCode, commandForLog(command, args))
 		} else {
-			log.Printf("Failed to execute command: %v", err)
-			return nil, fmt.Errorf("failed to execute command: %w", err)
+			logging.Errorf("Failed to execute command: %s", logging.RedactSecrets(err.Error()))
+			return nil, fmt.Errorf("%w: %w", ErrStartFailed, err)
 		}
-		result.Error = stderr.String()
+		result.Error = bufferedOutput(stderr, keepANSI(ctx))
 	} else {
 		result.ExitCode = 0
-		log.Printf("Command executed successfully: %s %s", command, strings.Join(args, " "))
+		logging.Infof("Command executed successfully: %s", commandForLog(command, args))
 	}
 
-	// Log command output summary
+	// Output can contain secrets, so it is only logged at debug level
 	if len(result.Output) > 0 {
 		outputPreview := result.Output
 		if len(outputPreview) > 100 {
 			outputPreview = outputPreview[:100] + "..."
 		}
-		log.Printf("Command output: %s", outputPreview)
+		logging.Debugf("Command output: %s", outputPreview)
 	}
-	
+
 	if len(result.Error) > 0 {
-		log.Printf("Command error: %s", result.Error)
+		logging.Debugf("Command error: %s", result.Error)
 	}
 
 	return result, nil
@@ -234,33 +311,25 @@ func ExecuteCommand(ctx context.Context, command string, args []string, dir stri
 // ExecuteCommands executes a list of commands sequentially
 // If stopOnError is true, execution will stop on the first error
 func ExecuteCommands(ctx context.Context, commands []string, dir string, stopOnError bool) ([]*CommandResult, error) {
-	log.Printf("Executing %d commands in directory: %s", len(commands), dir)
+	logging.Infof("Executing %d commands in directory: %s", len(commands), dir)
 	results := make([]*CommandResult, 0, len(commands))
 
 	for i, cmdStr := range commands {
-		log.Printf("Executing command %d/%d: %s", i+1, len(commands), cmdStr)
+		logging.Infof("Executing command %d/%d: %s", i+1, len(commands), logging.RedactSecrets(cmdStr))
 		
-		// Split the command string into command and args
-		parts := strings.Fields(cmdStr)
-		if len(parts) == 0 {
-			log.Printf("Skipping empty command")
+		if !IsRunnableCommand(cmdStr) {
+			logging.Debugf("Skipping empty command")
 			continue
 		}
 
-		command := parts[0]
-		var args []string
-		if len(parts) > 1 {
-			args = parts[1:]
-		}
+		// Split the command string into command and args, using the shell for pipes and chained commands
+		command, args, _ := ParseCommandString(cmdStr)
 
 		// Execute the command
 		result, err := ExecuteCommand(ctx, command, args, dir, 0)
 		if err != nil {
-			log.Printf("Command %d/%d failed: %v", i+1, len(commands), err)
-			if stopOnError {
-				return results, err
-			}
-			// Create a result for the failed command
+			logging.Warnf("Command %d/%d failed: %s", i+1, len(commands), logging.RedactSecrets(err.Error()))
+			// Create a result for the failed command so callers can see which one failed
 			results = append(results, &CommandResult{
 				Command:   command,
 				Args:      strings.Join(args, " "),
@@ -270,6 +339,9 @@ func ExecuteCommands(ctx context.Context, commands []string, dir string, stopOnE
 				EndTime:   time.Now(),
 				Duration:  "0s",
 			})
+			if stopOnError {
+				return results, err
+			}
 			continue
 		}
 
@@ -277,15 +349,22 @@ func ExecuteCommands(ctx context.Context, commands []string, dir string, stopOnE
 
 		// Stop if the command failed and stopOnError is true
 		if result.ExitCode != 0 && stopOnError {
-			log.Printf("Stopping command execution after failure of command %d/%d", i+1, len(commands))
+			logging.Infof("Stopping command execution after failure of command %d/%d", i+1, len(commands))
 			break
 		}
 	}
 
-	log.Printf("Completed execution of %d/%d commands", len(results), len(commands))
+	logging.Infof("Completed execution of %d/%d commands", len(results), len(commands))
 	return results, nil
 }
 
+// IsRunnableCommand reports whether ParseCommandString finds a command in commandStr. ExecuteCommands
+// skips the strings it doesn't, such as blank ones or a lone pair of quotes, without producing a result.
+func IsRunnableCommand(commandStr string) bool {
+	_, _, err := ParseCommandString(commandStr)
+	return err == nil
+}
+
 // ParseCommandString parses a shell command string that may contain pipes, redirects, etc.
 func ParseCommandString(commandStr string) (string, []string, error) {
 	// Remove any backticks or other shell-specific markers
@@ -298,13 +377,14 @@ func ParseCommandString(commandStr string) (string, []string, error) {
 	   strings.Contains(commandStr, "<") ||
 	   strings.Contains(commandStr, "&&") ||
 	   strings.Contains(commandStr, ";") {
-		return "/bin/sh", []string{"-c", commandStr}, nil
+		shell := DefaultShell()
+		return shell, shellArgs(shell, commandStr), nil
 	}
 	
 	// For simple commands, split into command and args
 	parts := strings.Fields(commandStr)
 	if len(parts) == 0 {
-		return "", nil, errors.New("empty command")
+		return "", nil, ErrEmptyCommand
 	}
 	
 	command := parts[0]
@@ -351,13 +431,25 @@ func ExecuteCommandWithStreaming(ctx context.Context, command string, args []str
 	}
 
 	// Log the command execution
-	log.Printf("Executing command with streaming: %s %s in directory: %s", command, strings.Join(args, " "), dir)
+	logging.Infof("Executing command with streaming: %s in directory: %s", commandForLog(command, args), dir)
 
-	// Prepare the command
-	cmd := exec.CommandContext(ctx, command, args...)
+	// Safety check for potentially unsafe commands, including shell invocations
+	if fullCommand := strings.TrimSpace(command + " " + strings.Join(args, " ")); containsUnsafeCommand(fullCommand) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsafeCommand, fullCommand)
+	}
+
+	// Prepare the command, wrapped in the resource limits and run as the configured user if there are any
+	cmd, err := limitedCommand(ctx, command, args, resourceLimits(ctx), runAsFor(ctx))
+	if err != nil {
+		return nil, err
+	}
 	if dir != "" {
+		if err := checkWorkDir(dir); err != nil {
+			return nil, err
+		}
 		cmd.Dir = dir
 	}
+	cmd.Env = commandEnv(ctx)
 
 	// Create pipes for stdout and stderr
 	stdoutPipe, err := cmd.StdoutPipe()
@@ -370,15 +462,20 @@ func ExecuteCommandWithStreaming(ctx context.Context, command string, args []str
 		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
 	}
 
-	// Set up buffers to collect all output
-	var stdoutBuffer, stderrBuffer bytes.Buffer
+	// Set up bounded buffers to collect the output
+	stdoutBuffer := newLimitedBuffer(DefaultMaxOutputBytes)
+	stderrBuffer := newLimitedBuffer(DefaultMaxOutputBytes)
 
 	// Start the command
 	startTime := time.Now()
 	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to start command: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrStartFailed, err)
 	}
 
+	// Coalesce lines from chatty processes into fewer callbacks when batching is enabled
+	onStdout, flushStdout := batchCallback(onStdout)
+	onStderr, flushStderr := batchCallback(onStderr)
+
 	// Create a wait group for both stdout and stderr goroutines
 	var wg sync.WaitGroup
 	wg.Add(2)
@@ -387,32 +484,20 @@ func ExecuteCommandWithStreaming(ctx context.Context, command string, args []str
 	go func() {
 		defer wg.Done()
 
-		scanner := bufio.NewScanner(stdoutPipe)
-		for scanner.Scan() {
-			line := scanner.Text() + "\n"
-			stdoutBuffer.WriteString(line)
-			if onStdout != nil {
-				onStdout(line)
-			}
-		}
+		streamOutput(stdoutPipe, stdoutBuffer, onStdout, keepANSI(ctx))
 	}()
 
 	// Process stderr
 	go func() {
 		defer wg.Done()
 
-		scanner := bufio.NewScanner(stderrPipe)
-		for scanner.Scan() {
-			line := scanner.Text() + "\n"
-			stderrBuffer.WriteString(line)
-			if onStderr != nil {
-				onStderr(line)
-			}
-		}
+		streamOutput(stderrPipe, stderrBuffer, onStderr, keepANSI(ctx))
 	}()
 
 	// Wait for both stdout and stderr to be fully read
 	wg.Wait()
+	flushStdout()
+	flushStderr()
 
 	// Wait for command to finish
 	err = cmd.Wait()
@@ -430,6 +515,7 @@ func ExecuteCommandWithStreaming(ctx context.Context, command string, args []str
 		StartTime: startTime,
 		EndTime:   endTime,
 		Duration:  duration,
+		Truncated: stdoutBuffer.Truncated() || stderrBuffer.Truncated(),
 	}
 
 	// Handle errors
@@ -437,19 +523,110 @@ func ExecuteCommandWithStreaming(ctx context.Context, command string, args []str
 		var exitErr *exec.ExitError
 		if errors.As(err, &exitErr) {
 			result.ExitCode = exitErr.ExitCode()
-			log.Printf("Command exited with code %d: %s %s", result.ExitCode, command, strings.Join(args, " "))
+			result.Signal = exitSignal(exitErr)
+		}
+
+		// Killed at its deadline, which Wait may report as an exit by signal or as a plain error;
+		// either way the result keeps the output produced until then
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			result.TimedOut = true
+			logging.Warnf("Command timed out: %s", commandForLog(command, args))
+			if timeout <= 0 {
+				// The deadline came from the caller's context
+				return result, ErrTimeout
+			}
+			return result, fmt.Errorf("%w after %s", ErrTimeout, timeout.String())
+		}
+
+		if exitErr != nil {
+			logging.Infof("Command exited with code %d: %s", result.ExitCode, commandForLog(command, args))
 		} else {
-			log.Printf("Error executing command: %v", err)
+			logging.Errorf("Error executing command: %s", logging.RedactSecrets(err.Error()))
 			return result, fmt.Errorf("failed to execute command: %w", err)
 		}
 	} else {
 		result.ExitCode = 0
-		log.Printf("Command executed successfully: %s %s", command, strings.Join(args, " "))
+		logging.Infof("Command executed successfully: %s", commandForLog(command, args))
 	}
 
 	return result, nil
 }
 
+// maxStreamChunkBytes is the longest piece of output forwarded at once; longer lines, such as
+// minified bundler output, are streamed in several chunks instead of stalling the reader
+const maxStreamChunkBytes = 64 * 1024
+
+// streamOutput reads a command's output pipe until it is closed, forwarding each line as it arrives.
+// ANSI escape sequences are stripped from each line unless keepANSI is set.
+func streamOutput(pipe io.Reader, buffer *limitedBuffer, callback func(string), keepANSI bool) {
+	scanner := bufio.NewScanner(pipe)
+	scanner.Buffer(make([]byte, 0, 4096), maxStreamChunkBytes)
+	scanner.Split(scanOutputChunks)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasSuffix(line, "\r\n") {
+			line = strings.TrimSuffix(line, "\r\n") + "\n"
+		}
+		if !keepANSI {
+			line = StripANSI(line)
+		}
+		streamLine(buffer, line, callback)
+	}
+
+	// The process may have closed the pipe on exit; anything else means output was lost
+	if err := scanner.Err(); err != nil && !errors.Is(err, os.ErrClosed) {
+		logging.Warnf("Error reading command output: %v", err)
+	}
+}
+
+// scanOutputChunks is a bufio.SplitFunc that ends a token at "\n", "\r\n" or a lone "\r", so progress
+// bars that redraw with carriage returns stream every update. Terminators are kept in the token, an
+// unterminated final line gets a newline, and lines that fill the buffer are returned as they are.
+func scanOutputChunks(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\r' {
+			// Wait for the next byte to tell a lone "\r" from "\r\n"
+			if i+1 == len(data) && !atEOF && len(data) < maxStreamChunkBytes {
+				return 0, nil, nil
+			}
+			if i+1 < len(data) && data[i+1] == '\n' {
+				return i + 2, data[:i+2], nil
+			}
+		}
+		return i + 1, data[:i+1], nil
+	}
+
+	if atEOF {
+		return len(data), append(data, '\n'), nil
+	}
+	if len(data) >= maxStreamChunkBytes {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// streamLine records a line of output and forwards it to the callback until the size limit is hit.
+// Once the buffer truncates, the callback receives the truncation marker once and nothing after it.
+func streamLine(buffer *limitedBuffer, line string, callback func(string)) {
+	if buffer.Truncated() {
+		return
+	}
+	buffer.WriteString(line)
+	if callback == nil {
+		return
+	}
+	if buffer.Truncated() {
+		callback(truncationMarker)
+		return
+	}
+	callback(line)
+}
+
 // ExecuteShellCommandWithStreaming executes a shell command with streaming output
 func ExecuteShellCommandWithStreaming(ctx context.Context, commandStr string, dir string, timeout time.Duration,
 	onStdout func(string), onStderr func(string)) (*CommandResult, error) {
@@ -475,22 +652,88 @@ func ExecuteShellCommandWithStreaming(ctx context.Context, commandStr string, di
 	return result, err
 }
 
-// containsUnsafeCommand checks if a command contains potentially unsafe operations
-func containsUnsafeCommand(command string) bool {
-	// List of potentially dangerous commands or arguments
-	unsafePatterns := []string{
-		"rm -rf /", "rm -rf /*", "rm -rf ~", "rm -rf .", "rm -rf *",
-		"> /dev/sda", "> /dev/hda",
-		"mkfs", "dd if=/dev/zero",
-		":(){:|:&};:", ":(){ :|:& };:", // Fork bomb patterns
+// ExecutionPlan describes how a command would be executed, without running it
+type ExecutionPlan struct {
+	Command   string   `json:"command"`   // Executable that would be started
+	Args      []string `json:"args"`      // Arguments passed to the executable
+	Directory string   `json:"directory"` // Absolute working directory
+	UsesShell bool     `json:"usesShell"` // Whether the command goes through ParseCommandString's shell path
+	Blocked   bool     `json:"blocked"`   // Whether the safety check would reject the command
+}
+
+// Helper function to render a command line for logs, with values that look like secrets masked
+func commandForLog(command string, args []string) string {
+	return logging.RedactSecrets(strings.TrimSpace(command + " " + strings.Join(args, " ")))
+}
+
+// Helper function to check that a working directory exists
+func checkWorkDir(dir string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrWorkDirNotFound, dir)
 	}
-	
-	commandLower := strings.ToLower(command)
-	for _, pattern := range unsafePatterns {
-		if strings.Contains(commandLower, pattern) {
-			return true
+	return nil
+}
+
+// Plan resolves how the API would execute command in workDir, mirroring the shell/simple split
+// used by the execution handlers, without starting any process
+func (e *CommandExecutor) Plan(command, workDir string) (*ExecutionPlan, error) {
+	directory := workDir
+	if directory != "" {
+		absDir, err := filepath.Abs(directory)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve working directory: %w", err)
 		}
+		if err := checkWorkDir(absDir); err != nil {
+			return nil, err
+		}
+		directory = absDir
 	}
-	
-	return false
+
+	plan := &ExecutionPlan{
+		Directory: directory,
+		UsesShell: isComplexCommand(command),
+		Blocked:   containsUnsafeCommand(command),
+	}
+
+	if plan.UsesShell {
+		shell, args, err := ParseCommandString(command)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse command: %w", err)
+		}
+		plan.Command, plan.Args = shell, args
+	} else {
+		plan.Command, plan.Args = e.ShellPath, shellArgs(e.ShellPath, command)
+	}
+
+	return plan, nil
+}
+
+// signalNames maps the signals commonly seen killing commands to their conventional names
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGTRAP: "SIGTRAP",
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGALRM: "SIGALRM",
+	syscall.SIGTERM: "SIGTERM",
+}
+
+// exitSignal returns the name of the signal that terminated the process, or "" if it exited normally.
+// A SIGKILL nobody asked for usually means the out-of-memory killer stopped the command.
+func exitSignal(exitErr *exec.ExitError) string {
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+	if name, ok := signalNames[status.Signal()]; ok {
+		return name
+	}
+	return status.Signal().String()
 }
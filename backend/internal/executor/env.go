@@ -0,0 +1,59 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/joho/godotenv"
+)
+
+// envContextKey is the context key for extra environment variables set with WithEnv
+type envContextKey struct{}
+
+// WithEnv returns a context whose commands run with env, a list of KEY=VALUE entries, added on top of
+// the server's own environment. Entries override server variables of the same name.
+func WithEnv(ctx context.Context, env []string) context.Context {
+	if len(env) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, envContextKey{}, env)
+}
+
+// commandEnv returns the environment for a command run with ctx, or nil to inherit the server's
+func commandEnv(ctx context.Context) []string {
+	env, _ := ctx.Value(envContextKey{}).([]string)
+	return mergeEnv(append(runAsFor(ctx).env(), env...))
+}
+
+// Helper function to append extra KEY=VALUE entries to the server's environment, nil when there are none
+func mergeEnv(env []string) []string {
+	if len(env) == 0 {
+		return nil
+	}
+	// Later entries win when a name repeats, so the extra variables override the server's
+	return append(os.Environ(), env...)
+}
+
+// LoadRepoEnv parses the .env file in a repository's root and returns its variables as sorted
+// KEY=VALUE entries. A repository without a .env file has no variables; .env.example is never read.
+func LoadRepoEnv(repoPath string) ([]string, error) {
+	values, err := godotenv.Read(filepath.Join(repoPath, ".env"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read .env: %w", err)
+	}
+
+	env := make([]string, 0, len(values))
+	for key, value := range values {
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+	return env, nil
+}
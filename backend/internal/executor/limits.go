@@ -0,0 +1,64 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// ErrResourceLimitsUnsupported is returned when the requested resource limits can't be enforced here
+var ErrResourceLimitsUnsupported = errors.New("resource limits are not supported on this system")
+
+// ResourceLimits caps the memory and CPU a command may use; zero fields are unlimited
+type ResourceLimits struct {
+	MemoryMB   int // Maximum memory in megabytes
+	CPUPercent int // CPU quota as a percentage of one core, so 200 allows two full cores
+}
+
+// IsZero reports whether no limit is set
+func (l ResourceLimits) IsZero() bool {
+	return l.MemoryMB == 0 && l.CPUPercent == 0
+}
+
+// ValidateResourceLimits checks that limits are non-negative and can be enforced on this system
+func ValidateResourceLimits(limits ResourceLimits) error {
+	if limits.MemoryMB < 0 || limits.CPUPercent < 0 {
+		return errors.New("resource limits must not be negative")
+	}
+	_, _, _, err := limitCommand("true", nil, limits, nil)
+	return err
+}
+
+// limitsContextKey is the context key for resource limits set with WithResourceLimits
+type limitsContextKey struct{}
+
+// WithResourceLimits returns a context whose commands run under limits
+func WithResourceLimits(ctx context.Context, limits ResourceLimits) context.Context {
+	if limits.IsZero() {
+		return ctx
+	}
+	return context.WithValue(ctx, limitsContextKey{}, limits)
+}
+
+// resourceLimits returns the limits for commands run with ctx
+func resourceLimits(ctx context.Context) ResourceLimits {
+	limits, _ := ctx.Value(limitsContextKey{}).(ResourceLimits)
+	return limits
+}
+
+// Helper function to prepare a command wrapped in the limits and started as runAs when it is set,
+// describing the failure when either can't be applied
+func limitedCommand(ctx context.Context, command string, args []string, limits ResourceLimits, runAs *RunAs) (*exec.Cmd, error) {
+	name, limitedArgs, switchesUser, err := limitCommand(command, args, limits, runAs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply resource limits: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, name, limitedArgs...)
+	if runAs != nil && !switchesUser {
+		if err := setCredential(cmd, runAs); err != nil {
+			return nil, fmt.Errorf("failed to run as %s: %w", runAs, err)
+		}
+	}
+	return cmd, nil
+}
@@ -0,0 +1,56 @@
+//go:build linux
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// limitCommand returns the command line that runs command under limits. With systemd the command runs
+// in a transient scope with MemoryMax and CPUQuota; otherwise prlimit caps its address space, which
+// covers memory but not CPU. switchesUser reports whether the wrapper itself switches to runAs, since
+// systemd-run has to register the scope before dropping privileges.
+func limitCommand(command string, args []string, limits ResourceLimits, runAs *RunAs) (name string, limitedArgs []string, switchesUser bool, err error) {
+	if limits.IsZero() {
+		return command, args, false, nil
+	}
+
+	if systemdRun, ok := systemdRunPath(); ok {
+		wrapped := []string{"--scope", "--quiet"}
+		if limits.MemoryMB > 0 {
+			wrapped = append(wrapped, "-p", fmt.Sprintf("MemoryMax=%dM", limits.MemoryMB))
+		}
+		if limits.CPUPercent > 0 {
+			wrapped = append(wrapped, "-p", fmt.Sprintf("CPUQuota=%d%%", limits.CPUPercent))
+		}
+		if runAs != nil {
+			wrapped = append(wrapped, fmt.Sprintf("--uid=%d", runAs.UID), fmt.Sprintf("--gid=%d", runAs.GID))
+		}
+		wrapped = append(append(wrapped, "--", command), args...)
+		return systemdRun, wrapped, runAs != nil, nil
+	}
+
+	if limits.CPUPercent > 0 {
+		return "", nil, false, fmt.Errorf("%w: CPU limits need systemd-run on a host running systemd", ErrResourceLimitsUnsupported)
+	}
+	prlimit, err := exec.LookPath("prlimit")
+	if err != nil {
+		return "", nil, false, fmt.Errorf("%w: memory limits need systemd-run or prlimit", ErrResourceLimitsUnsupported)
+	}
+	bytes := int64(limits.MemoryMB) * 1024 * 1024
+	wrapped := append([]string{"--as=" + strconv.FormatInt(bytes, 10), "--", command}, args...)
+	return prlimit, wrapped, false, nil
+}
+
+// systemdRunPath returns the systemd-run binary when systemd is actually managing the host; containers
+// often ship the binary without running systemd
+func systemdRunPath() (string, bool) {
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		return "", false
+	}
+	path, err := exec.LookPath("systemd-run")
+	return path, err == nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package executor
+
+// limitCommand only supports limits on Linux; elsewhere any limit is an error
+func limitCommand(command string, args []string, limits ResourceLimits, runAs *RunAs) (string, []string, bool, error) {
+	if limits.IsZero() {
+		return command, args, false, nil
+	}
+	return "", nil, false, ErrResourceLimitsUnsupported
+}
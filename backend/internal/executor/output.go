@@ -0,0 +1,174 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxOutputBytes bounds how much stdout or stderr a single command may buffer.
+// It is used by the package-level execution functions and as the default for new executors.
+var DefaultMaxOutputBytes = 10 * 1024 * 1024
+
+// truncationMarker is appended to output that exceeded the size limit
+const truncationMarker = "\n[output truncated]\n"
+
+// limitedBuffer is an io.Writer that keeps at most limit bytes and silently discards the rest,
+// so the command's pipe keeps draining and the process never blocks on a full pipe
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// newLimitedBuffer creates a buffer capped at limit bytes; zero or less means unlimited
+func newLimitedBuffer(limit int) *limitedBuffer {
+	return &limitedBuffer{limit: limit}
+}
+
+// Write appends as much of p as fits and always reports the full length as written
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit <= 0 {
+		return b.buf.Write(p)
+	}
+	if b.truncated {
+		return len(p), nil
+	}
+
+	remaining := b.limit - b.buf.Len()
+	if len(p) > remaining {
+		b.buf.Write(p[:remaining])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// WriteString appends s subject to the same limit as Write
+func (b *limitedBuffer) WriteString(s string) (int, error) {
+	return b.Write([]byte(s))
+}
+
+// Truncated reports whether any output was discarded
+func (b *limitedBuffer) Truncated() bool {
+	return b.truncated
+}
+
+// String returns the buffered output, with a marker appended when it was truncated
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + truncationMarker
+	}
+	return b.buf.String()
+}
+
+// ansiEscape matches ANSI escape sequences: CSI sequences such as colors and cursor movement, OSC
+// sequences such as window titles and hyperlinks, and the remaining two-byte escapes
+var ansiEscape = regexp.MustCompile(`\x1b(?:\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(?:\x07|\x1b\\)|[@-_])`)
+
+// StripANSI removes ANSI escape sequences, such as the colors build tools print, from command output
+func StripANSI(text string) string {
+	if !strings.Contains(text, "\x1b") {
+		return text
+	}
+	return ansiEscape.ReplaceAllString(text, "")
+}
+
+// keepANSIContextKey is the context key for the setting made with WithKeepANSI
+type keepANSIContextKey struct{}
+
+// WithKeepANSI returns a context whose commands keep ANSI escape sequences in their output when keep
+// is true, for clients that render them; by default they are stripped
+func WithKeepANSI(ctx context.Context, keep bool) context.Context {
+	if !keep {
+		return ctx
+	}
+	return context.WithValue(ctx, keepANSIContextKey{}, true)
+}
+
+// keepANSI reports whether commands run with ctx keep ANSI escape sequences in their output
+func keepANSI(ctx context.Context) bool {
+	keep, _ := ctx.Value(keepANSIContextKey{}).(bool)
+	return keep
+}
+
+// Helper function to read a buffer's output, stripping ANSI escape sequences unless keep is set
+func bufferedOutput(buffer *limitedBuffer, keep bool) string {
+	if keep {
+		return buffer.String()
+	}
+	return StripANSI(buffer.String())
+}
+
+// OutputBatchWindow coalesces streamed output lines for this long before invoking the callback.
+// Zero or less keeps the default of one callback per line.
+var OutputBatchWindow time.Duration
+
+// OutputBatchBytes flushes a batch early once this much output is pending
+var OutputBatchBytes = 64 * 1024
+
+// outputBatcher collects streamed lines and hands them to a callback in batches, either when the
+// window since the first pending line elapses or when the pending output reaches maxBytes
+type outputBatcher struct {
+	mutex    sync.Mutex
+	pending  strings.Builder
+	timer    *time.Timer
+	callback func(string)
+	window   time.Duration
+	maxBytes int
+}
+
+// newOutputBatcher creates a batcher that delivers output to callback
+func newOutputBatcher(callback func(string), window time.Duration, maxBytes int) *outputBatcher {
+	return &outputBatcher{callback: callback, window: window, maxBytes: maxBytes}
+}
+
+// add queues text, flushing immediately when the size threshold is reached
+func (b *outputBatcher) add(text string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.pending.WriteString(text)
+	if b.maxBytes > 0 && b.pending.Len() >= b.maxBytes {
+		b.flushLocked()
+		return
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.window, b.flush)
+	}
+}
+
+// flush delivers any pending output
+func (b *outputBatcher) flush() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.flushLocked()
+}
+
+// flushLocked delivers pending output and stops the timer; the caller must hold the mutex.
+// The callback runs under the mutex so batches are always delivered in order.
+func (b *outputBatcher) flushLocked() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if b.pending.Len() == 0 {
+		return
+	}
+	text := b.pending.String()
+	b.pending.Reset()
+	b.callback(text)
+}
+
+// batchCallback wraps callback in a batcher when OutputBatchWindow is set. The returned flush func
+// must be called once streaming ends so no output is left pending.
+func batchCallback(callback func(string)) (func(string), func()) {
+	if callback == nil || OutputBatchWindow <= 0 {
+		return callback, func() {}
+	}
+	batcher := newOutputBatcher(callback, OutputBatchWindow, OutputBatchBytes)
+	return batcher.add, batcher.flush
+}
@@ -0,0 +1,57 @@
+package executor
+
+import (
+	"strings"
+)
+
+// lineRing keeps the most recent lines of a stream in a fixed-size ring buffer
+type lineRing struct {
+	lines   []string
+	start   int    // Index of the oldest line
+	count   int    // Number of complete lines stored
+	partial string // Trailing text not yet terminated by a newline
+}
+
+// newLineRing creates a ring that holds up to capacity complete lines
+func newLineRing(capacity int) *lineRing {
+	return &lineRing{lines: make([]string, capacity)}
+}
+
+// write appends text to the ring, evicting the oldest lines once it is full
+func (r *lineRing) write(text string) {
+	parts := strings.Split(r.partial+text, "\n")
+	r.partial = parts[len(parts)-1]
+
+	for _, line := range parts[:len(parts)-1] {
+		if r.count < len(r.lines) {
+			r.lines[(r.start+r.count)%len(r.lines)] = line
+			r.count++
+			continue
+		}
+		r.lines[r.start] = line
+		r.start = (r.start + 1) % len(r.lines)
+	}
+}
+
+// last returns up to n of the most recent lines, counting an unterminated trailing line as one
+func (r *lineRing) last(n int) string {
+	if n <= 0 {
+		return ""
+	}
+
+	var builder strings.Builder
+	complete := r.count
+	if r.partial != "" {
+		n--
+	}
+	if complete > n {
+		complete = n
+	}
+
+	for i := r.count - complete; i < r.count; i++ {
+		builder.WriteString(r.lines[(r.start+i)%len(r.lines)])
+		builder.WriteByte('\n')
+	}
+	builder.WriteString(r.partial)
+	return builder.String()
+}
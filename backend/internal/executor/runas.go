@@ -0,0 +1,143 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// ErrRunAsUnsupported is returned when commands can't be run as another user on this system
+var ErrRunAsUnsupported = errors.New("running commands as another user is not supported on this system")
+
+// RunAs is the user and group a command runs as instead of the server's own
+type RunAs struct {
+	UID  uint32
+	GID  uint32
+	Name string // User name, given to the command as USER and LOGNAME
+	Home string // Home directory, given to the command as HOME so tools don't write to the server's
+}
+
+// DefaultRunAs, when set, is the user commands run as unless a request picks another one
+var DefaultRunAs *RunAs
+
+// AllowedRunAs are the other users requests may pick while DefaultRunAs is set
+var AllowedRunAs []*RunAs
+
+// RunAsAllowed reports whether runAs is DefaultRunAs or one of AllowedRunAs, comparing both user and group
+func RunAsAllowed(runAs *RunAs) bool {
+	for _, allowed := range append([]*RunAs{DefaultRunAs}, AllowedRunAs...) {
+		if allowed != nil && allowed.UID == runAs.UID && allowed.GID == runAs.GID {
+			return true
+		}
+	}
+	return false
+}
+
+// String describes the user for logs and errors
+func (r *RunAs) String() string {
+	return fmt.Sprintf("%s (uid %d, gid %d)", r.Name, r.UID, r.GID)
+}
+
+// LookupRunAs resolves "user" or "user:group", each a name or numeric ID, to an existing user and group.
+// Without a group the user's primary group is used.
+func LookupRunAs(spec string) (*RunAs, error) {
+	userName, groupName, hasGroup := strings.Cut(strings.TrimSpace(spec), ":")
+	if userName == "" {
+		return nil, errors.New("no user given")
+	}
+
+	u, err := lookupUser(userName)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %q has no numeric uid", userName)
+	}
+
+	gidText := u.Gid
+	if hasGroup {
+		g, err := lookupGroup(groupName)
+		if err != nil {
+			return nil, err
+		}
+		gidText = g.Gid
+	}
+	gid, err := strconv.ParseUint(gidText, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("group %q has no numeric gid", gidText)
+	}
+
+	runAs := &RunAs{UID: uint32(uid), GID: uint32(gid), Name: u.Username, Home: u.HomeDir}
+	if err := checkRunAs(runAs); err != nil {
+		return nil, err
+	}
+	return runAs, nil
+}
+
+// Helper function to look up a user by name or numeric uid
+func lookupUser(name string) (*user.User, error) {
+	var u *user.User
+	var err error
+	if _, numErr := strconv.ParseUint(name, 10, 32); numErr == nil {
+		u, err = user.LookupId(name)
+	} else {
+		u, err = user.Lookup(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unknown user %q", name)
+	}
+	return u, nil
+}
+
+// Helper function to look up a group by name or numeric gid
+func lookupGroup(name string) (*user.Group, error) {
+	var g *user.Group
+	var err error
+	if _, numErr := strconv.ParseUint(name, 10, 32); numErr == nil {
+		g, err = user.LookupGroupId(name)
+	} else {
+		g, err = user.LookupGroup(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unknown group %q", name)
+	}
+	return g, nil
+}
+
+// runAsContextKey is the context key for the user set with WithRunAs
+type runAsContextKey struct{}
+
+// WithRunAs returns a context whose commands run as runAs; nil keeps DefaultRunAs
+func WithRunAs(ctx context.Context, runAs *RunAs) context.Context {
+	if runAs == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, runAsContextKey{}, runAs)
+}
+
+// runAsFor returns the user commands run with ctx run as, or nil for the server's own user
+func runAsFor(ctx context.Context) *RunAs {
+	if runAs, ok := ctx.Value(runAsContextKey{}).(*RunAs); ok {
+		return runAs
+	}
+	return DefaultRunAs
+}
+
+// env returns the variables that point tools at the user's own home directory
+func (r *RunAs) env() []string {
+	if r == nil {
+		return nil
+	}
+	var env []string
+	if r.Home != "" {
+		env = append(env, "HOME="+r.Home)
+	}
+	if r.Name != "" {
+		env = append(env, "USER="+r.Name, "LOGNAME="+r.Name)
+	}
+	return env
+}
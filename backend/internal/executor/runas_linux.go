@@ -0,0 +1,35 @@
+//go:build linux
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// checkRunAs reports whether the server may start processes as runAs; switching users needs root
+func checkRunAs(runAs *RunAs) error {
+	if os.Geteuid() != 0 && !isServerUser(runAs) {
+		return fmt.Errorf("running commands as uid %d needs the server to run as root", runAs.UID)
+	}
+	return nil
+}
+
+// setCredential makes cmd start as runAs, without the server's supplementary groups
+func setCredential(cmd *exec.Cmd, runAs *RunAs) error {
+	if isServerUser(runAs) {
+		return nil
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: runAs.UID, Gid: runAs.GID, Groups: []uint32{}}
+	return nil
+}
+
+// Helper function to check whether runAs is the user and group the server already runs as
+func isServerUser(runAs *RunAs) bool {
+	return runAs.UID == uint32(os.Geteuid()) && runAs.GID == uint32(os.Getegid())
+}
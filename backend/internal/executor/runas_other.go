@@ -0,0 +1,15 @@
+//go:build !linux
+
+package executor
+
+import "os/exec"
+
+// checkRunAs only supports other users on Linux
+func checkRunAs(runAs *RunAs) error {
+	return ErrRunAsUnsupported
+}
+
+// setCredential only supports other users on Linux
+func setCredential(cmd *exec.Cmd, runAs *RunAs) error {
+	return ErrRunAsUnsupported
+}
@@ -0,0 +1,122 @@
+package executor
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// defaultUnsafePatterns are substrings that mark a command as potentially destructive.
+// They are matched case-insensitively with all whitespace removed, so spacing tricks don't bypass them.
+var defaultUnsafePatterns = []string{
+	"> /dev/sda", "> /dev/hda",
+	"mkfs", "dd if=/dev/zero",
+	":(){:|:&};:", // Fork bomb
+}
+
+// dangerousRmTargets are paths that must never be removed recursively
+var dangerousRmTargets = map[string]bool{
+	"/": true, "/*": true, "~": true, "~/": true, "~/*": true,
+	"$home": true, "${home}": true, ".": true, "./": true, "*": true,
+}
+
+// extraUnsafePatterns holds operator-supplied patterns loaded once from the environment
+var (
+	extraUnsafePatterns     []string
+	extraUnsafePatternsOnce sync.Once
+)
+
+// loadExtraUnsafePatterns reads additional patterns from UNSAFE_COMMAND_PATTERNS (comma-separated)
+// and from the file named by UNSAFE_COMMAND_PATTERNS_FILE (one pattern per line, # for comments)
+func loadExtraUnsafePatterns() []string {
+	extraUnsafePatternsOnce.Do(func() {
+		for _, pattern := range strings.Split(os.Getenv("UNSAFE_COMMAND_PATTERNS"), ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				extraUnsafePatterns = append(extraUnsafePatterns, pattern)
+			}
+		}
+
+		path := os.Getenv("UNSAFE_COMMAND_PATTERNS_FILE")
+		if path == "" {
+			return
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Warning: failed to read UNSAFE_COMMAND_PATTERNS_FILE %s: %v", path, err)
+			return
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				extraUnsafePatterns = append(extraUnsafePatterns, line)
+			}
+		}
+	})
+	return extraUnsafePatterns
+}
+
+// containsUnsafeCommand checks if a command contains potentially unsafe operations
+func containsUnsafeCommand(command string) bool {
+	commandLower := strings.ToLower(command)
+	compact := removeWhitespace(commandLower)
+
+	patterns := append(append([]string{}, defaultUnsafePatterns...), loadExtraUnsafePatterns()...)
+	for _, pattern := range patterns {
+		if strings.Contains(compact, removeWhitespace(strings.ToLower(pattern))) {
+			return true
+		}
+	}
+
+	return containsDangerousRm(commandLower)
+}
+
+// containsDangerousRm detects recursive, forced rm invocations targeting root, home or the whole
+// working directory, regardless of flag order or spacing (rm -rf /, rm -fr ~, rm -r -f /, ...)
+func containsDangerousRm(command string) bool {
+	segments := strings.FieldsFunc(command, func(r rune) bool {
+		return r == ';' || r == '&' || r == '|' || r == '\n'
+	})
+
+	for _, segment := range segments {
+		fields := strings.Fields(segment)
+		for i, field := range fields {
+			if field != "rm" && !strings.HasSuffix(field, "/rm") {
+				continue
+			}
+
+			recursive, force := false, false
+			var targets []string
+			for _, arg := range fields[i+1:] {
+				switch {
+				case arg == "--recursive":
+					recursive = true
+				case arg == "--force":
+					force = true
+				case strings.HasPrefix(arg, "--"):
+					// Other long options don't change what gets removed
+				case strings.HasPrefix(arg, "-"):
+					recursive = recursive || strings.Contains(arg, "r")
+					force = force || strings.Contains(arg, "f")
+				default:
+					targets = append(targets, strings.Trim(arg, `"'`))
+				}
+			}
+
+			if !recursive || !force {
+				continue
+			}
+			for _, target := range targets {
+				if dangerousRmTargets[target] {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// removeWhitespace strips all whitespace so patterns match regardless of spacing
+func removeWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
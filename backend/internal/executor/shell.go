@@ -0,0 +1,50 @@
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// unixShells are tried in order when STARTIT_SHELL is not set
+var unixShells = []string{"/bin/bash", "/bin/zsh", "/bin/sh"}
+
+// DefaultShell returns the shell used to run command strings. STARTIT_SHELL overrides it; otherwise
+// Windows uses cmd.exe (from COMSPEC) and other systems the first of bash, zsh and sh that exists.
+func DefaultShell() string {
+	if shell := strings.TrimSpace(os.Getenv("STARTIT_SHELL")); shell != "" {
+		return shell
+	}
+
+	if runtime.GOOS == "windows" {
+		if comspec := os.Getenv("COMSPEC"); comspec != "" {
+			return comspec
+		}
+		return "cmd.exe"
+	}
+
+	for _, shell := range unixShells {
+		if _, err := os.Stat(shell); err == nil {
+			return shell
+		}
+	}
+	if shell, err := exec.LookPath("sh"); err == nil {
+		return shell
+	}
+	return "/bin/sh"
+}
+
+// shellArgs returns the arguments that make shell run command, using each shell's own flag
+func shellArgs(shell, command string) []string {
+	name := strings.ToLower(strings.TrimSuffix(filepath.Base(filepath.ToSlash(shell)), filepath.Ext(shell)))
+	switch name {
+	case "cmd":
+		return []string{"/C", command}
+	case "powershell", "pwsh":
+		return []string{"-NoProfile", "-NonInteractive", "-Command", command}
+	default:
+		return []string{"-c", command}
+	}
+}
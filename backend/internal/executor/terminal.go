@@ -0,0 +1,101 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// ErrTerminalUnsupported is returned by StartTerminal on platforms without pseudo-terminal support
+var ErrTerminalUnsupported = errors.New("interactive terminals are not supported on this platform")
+
+// TerminalSession is a shell running on a pseudo-terminal, so programs that need a TTY (prompts,
+// REPLs, progress bars) behave as they would in a real terminal
+type TerminalSession struct {
+	cmd       *exec.Cmd
+	pty       *os.File
+	closeOnce sync.Once
+}
+
+// ValidateTerminal checks that terminals are supported on this platform and that command passes the
+// same safety checks as any other command, so callers can reject a session before setting it up
+func ValidateTerminal(command string) error {
+	if !terminalSupported {
+		return ErrTerminalUnsupported
+	}
+	if command != "" && containsUnsafeCommand(command) {
+		return fmt.Errorf("%w: %s", ErrUnsafeCommand, command)
+	}
+	return nil
+}
+
+// StartTerminal starts a shell in dir attached to a new pseudo-terminal of the given size. When command
+// is set the shell runs it and exits; otherwise an interactive shell is started. The command is checked
+// with ValidateTerminal. Callers must call Wait once the session ends, even after Close.
+func StartTerminal(command, dir string, cols, rows uint16) (*TerminalSession, error) {
+	if err := ValidateTerminal(command); err != nil {
+		return nil, err
+	}
+
+	shell := DefaultShell()
+	var cmd *exec.Cmd
+	if command != "" {
+		cmd = exec.Command(shell, shellArgs(shell, command)...)
+	} else {
+		cmd = exec.Command(shell)
+	}
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), DefaultRunAs.env()...), "TERM=xterm-256color")
+	if DefaultRunAs != nil {
+		if err := setCredential(cmd, DefaultRunAs); err != nil {
+			return nil, fmt.Errorf("failed to run as %s: %w", DefaultRunAs, err)
+		}
+	}
+
+	pty, err := startOnTerminal(cmd, cols, rows)
+	if err != nil {
+		return nil, err
+	}
+	return &TerminalSession{cmd: cmd, pty: pty}, nil
+}
+
+// Read reads output written to the terminal
+func (s *TerminalSession) Read(p []byte) (int, error) {
+	return s.pty.Read(p)
+}
+
+// Write sends input to the terminal as if it were typed
+func (s *TerminalSession) Write(p []byte) (int, error) {
+	return s.pty.Write(p)
+}
+
+// Resize changes the terminal size so full-screen programs redraw to fit
+func (s *TerminalSession) Resize(cols, rows uint16) error {
+	return resizeTerminal(s.pty, cols, rows)
+}
+
+// Wait waits for the shell to exit and returns its exit code and, if it was killed, the signal name
+func (s *TerminalSession) Wait() (int, string) {
+	err := s.cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), exitSignal(exitErr)
+	}
+	if err != nil {
+		return -1, ""
+	}
+	return 0, ""
+}
+
+// Close kills the shell and releases the terminal. It is safe to call more than once; Wait must still
+// be called to reap the shell.
+func (s *TerminalSession) Close() {
+	s.closeOnce.Do(func() {
+		if s.cmd.Process != nil {
+			s.cmd.Process.Kill()
+		}
+		s.pty.Close()
+	})
+}
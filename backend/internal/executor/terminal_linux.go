@@ -0,0 +1,71 @@
+//go:build linux
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+)
+
+// terminalSupported reports whether StartTerminal can open pseudo-terminals on this platform
+const terminalSupported = true
+
+// startOnTerminal starts cmd as the session leader with a new pseudo-terminal of the given size as its
+// controlling TTY and stdio, and returns the master side
+func startOnTerminal(cmd *exec.Cmd, cols, rows uint16) (*os.File, error) {
+	// pty keeps any credential already set, so the shell still runs as the configured user
+	master, err := pty.StartWithSize(cmd, &pty.Winsize{Cols: cols, Rows: rows})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start shell: %w", err)
+	}
+
+	pollable, err := pollableFile(master)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, fmt.Errorf("failed to open pseudo-terminal: %w", err)
+	}
+	return pollable, nil
+}
+
+// pollableFile replaces file with a non-blocking copy. pty hands back the master in blocking mode, where
+// closing the session wouldn't interrupt a pending Read while a background job still holds the terminal.
+func pollableFile(file *os.File) (*os.File, error) {
+	defer file.Close()
+	fd, err := unix.FcntlInt(file.Fd(), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), file.Name()), nil
+}
+
+// resizeTerminal sets the window size of the terminal, which also signals SIGWINCH to its programs.
+// pty.Setsize isn't used since it would put the master back into blocking mode.
+func resizeTerminal(terminal *os.File, cols, rows uint16) error {
+	if cols == 0 || rows == 0 {
+		return nil
+	}
+	conn, err := terminal.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var resizeErr error
+	err = conn.Control(func(fd uintptr) {
+		resizeErr = unix.IoctlSetWinsize(int(fd), unix.TIOCSWINSZ, &unix.Winsize{Col: cols, Row: rows})
+	})
+	if err != nil {
+		return err
+	}
+	if resizeErr != nil {
+		return fmt.Errorf("failed to resize terminal: %w", resizeErr)
+	}
+	return nil
+}
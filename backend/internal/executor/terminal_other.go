@@ -0,0 +1,21 @@
+//go:build !linux
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+)
+
+// terminalSupported reports whether StartTerminal can open pseudo-terminals on this platform
+const terminalSupported = false
+
+// startOnTerminal is only implemented on Linux
+func startOnTerminal(cmd *exec.Cmd, cols, rows uint16) (*os.File, error) {
+	return nil, ErrTerminalUnsupported
+}
+
+// resizeTerminal is only implemented on Linux
+func resizeTerminal(terminal *os.File, cols, rows uint16) error {
+	return ErrTerminalUnsupported
+}
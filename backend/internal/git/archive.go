@@ -0,0 +1,235 @@
+package git
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// VCSArchive marks a repository downloaded as a source archive; it has files but no history
+const VCSArchive = "archive"
+
+// archiveMarkerFile records where an archive snapshot came from, since it has no .git directory
+const archiveMarkerFile = ".startit-archive.json"
+
+// codeloadBaseURL serves GitHub source archives
+const codeloadBaseURL = "https://codeload.github.com"
+
+// maxArchiveBytes caps the extracted size of a downloaded archive
+const maxArchiveBytes = 2 << 30
+
+// archiveInfo is the content of archiveMarkerFile
+type archiveInfo struct {
+	URL    string `json:"url"`
+	Branch string `json:"branch,omitempty"`
+	Ref    string `json:"ref,omitempty"`
+	Commit string `json:"commit,omitempty"`
+}
+
+// SetArchive makes GitHub clones download a source archive instead, falling back to git clone when
+// the download fails. Archives have no history and no submodules.
+func (r *Repository) SetArchive(archive bool) {
+	r.Archive = archive
+}
+
+// IsArchive reports whether the repository is an archive snapshot rather than a clone
+func (r *Repository) IsArchive() bool {
+	return r.VCS == VCSArchive
+}
+
+// cloneArchive downloads the repository as a source archive when that was requested and is possible.
+// It returns false when the caller should run a normal clone instead.
+func (r *Repository) cloneArchive(ctx context.Context) bool {
+	if !r.Archive || r.Submodules || r.SSHKeyPath != "" {
+		return false
+	}
+
+	archiveURL, ok := r.archiveURL()
+	if !ok {
+		log.Printf("Archive download is only available for GitHub repositories, cloning %s instead", r.URL)
+		return false
+	}
+
+	if err := r.downloadArchive(ctx, archiveURL); err != nil {
+		log.Printf("Archive download of %s failed, falling back to git clone: %v", r.URL, r.redactToken(err.Error()))
+		os.RemoveAll(r.LocalDir)
+		return false
+	}
+	return true
+}
+
+// archiveURL returns the codeload URL of the requested branch, tag or commit of a GitHub repository
+func (r *Repository) archiveURL() (string, bool) {
+	repoURL, err := NormalizeGitURL(r.URL)
+	if err != nil {
+		return "", false
+	}
+	repoPath, found := strings.CutPrefix(repoURL, "https://github.com/")
+	if !found {
+		return "", false
+	}
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	if strings.Count(repoPath, "/") != 1 {
+		return "", false
+	}
+
+	// codeload resolves bare tag names and commit SHAs itself; branches get an explicit ref
+	ref := "refs/heads/" + r.Branch
+	if r.Ref != "" {
+		ref = r.Ref
+	}
+	return codeloadBaseURL + "/" + repoPath + "/tar.gz/" + (&url.URL{Path: ref}).EscapedPath(), true
+}
+
+// downloadArchive fetches a tar.gz archive and extracts it into LocalDir, recording its origin
+func (r *Repository) downloadArchive(ctx context.Context, archiveURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, archiveURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create archive request: %w", err)
+	}
+	if r.Token != "" {
+		req.Header.Set("Authorization", "token "+r.Token)
+	}
+
+	resp, err := r.httpClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download archive: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download archive: %s", resp.Status)
+	}
+
+	commit, err := extractTarGz(resp.Body, r.LocalDir)
+	if err != nil {
+		return err
+	}
+
+	info := archiveInfo{URL: r.URL, Branch: r.Branch, Ref: r.Ref, Commit: commit}
+	if r.Ref != "" {
+		info.Branch = ""
+	}
+	content, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to record archive origin: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(r.LocalDir, archiveMarkerFile), content, 0644); err != nil {
+		return fmt.Errorf("failed to record archive origin: %w", err)
+	}
+
+	r.VCS = VCSArchive
+	r.Commit = commit
+	r.Branch = info.Branch
+	return nil
+}
+
+// extractTarGz extracts a GitHub source archive into dir, dropping the archive's top-level directory.
+// It returns the commit SHA that git archive stores in the global header, if any.
+func extractTarGz(body io.Reader, dir string) (string, error) {
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return "", fmt.Errorf("archive is not gzip-compressed: %w", err)
+	}
+	defer gz.Close()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	var commit string
+	var written int64
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return commit, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("malformed archive: %w", err)
+		}
+
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			commit = header.PAXRecords["comment"]
+			continue
+		}
+
+		// Entries sit under a "<repo>-<ref>/" directory
+		_, name, found := strings.Cut(header.Name, "/")
+		if !found || name == "" {
+			continue
+		}
+		name = path.Clean(name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return "", fmt.Errorf("archive entry escapes the repository: %s", header.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return "", fmt.Errorf("failed to extract %s: %w", name, err)
+			}
+		case tar.TypeReg:
+			written += header.Size
+			if written > maxArchiveBytes {
+				return "", fmt.Errorf("archive is larger than %d bytes", int64(maxArchiveBytes))
+			}
+			if err := extractFile(reader, target, header.FileInfo().Mode().Perm()); err != nil {
+				return "", fmt.Errorf("failed to extract %s: %w", name, err)
+			}
+		case tar.TypeSymlink:
+			// Links that point outside the repository are left out rather than trusted
+			linkTarget := path.Join(path.Dir(name), header.Linkname)
+			if path.IsAbs(header.Linkname) || linkTarget == ".." || strings.HasPrefix(linkTarget, "../") {
+				log.Printf("Skipping archive symlink outside the repository: %s -> %s", name, header.Linkname)
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return "", fmt.Errorf("failed to extract %s: %w", name, err)
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return "", fmt.Errorf("failed to extract %s: %w", name, err)
+			}
+		}
+	}
+}
+
+// Helper function to write one archive entry to disk
+func extractFile(content io.Reader, target string, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// readArchiveInfo reads the origin of an archive snapshot from its marker file
+func readArchiveInfo(dir string) (archiveInfo, error) {
+	var info archiveInfo
+	content, err := os.ReadFile(filepath.Join(dir, archiveMarkerFile))
+	if err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal(content, &info); err != nil {
+		return info, fmt.Errorf("malformed %s: %w", archiveMarkerFile, err)
+	}
+	return info, nil
+}
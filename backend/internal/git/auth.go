@@ -0,0 +1,129 @@
+package git
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tokenUsername is the user name sent with access tokens; GitHub, GitLab and Bitbucket all accept a
+// token as the password regardless of the user name
+const tokenUsername = "x-access-token"
+
+// authEnv returns the environment that makes git send the access token to the repository's host in an
+// Authorization header. The header is passed through GIT_CONFIG_* rather than the clone URL so the token
+// is never written to .git/config, and it is scoped to the host so redirects and submodules on other hosts
+// don't receive it.
+func (r *Repository) authEnv() []string {
+	prefix := r.authPrefix()
+	if prefix == "" {
+		return nil
+	}
+	credentials := base64.StdEncoding.EncodeToString([]byte(tokenUsername + ":" + r.Token))
+	return []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http." + prefix + "/.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic " + credentials,
+	}
+}
+
+// runRemoteHg runs an hg command that talks to the remote and returns its combined output. The access
+// token is written to a private temporary hgrc that HGRCPATH points to, so it never appears on hg's
+// command line or in the default path stored in .hg/hgrc, and is limited to the repository's host.
+func (r *Repository) runRemoteHg(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := r.hgCommand(ctx, args...)
+	if prefix := r.authPrefix(); prefix != "" {
+		hgrc, err := r.writeHgAuthConfig(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare Mercurial credentials: %w", err)
+		}
+		defer os.Remove(hgrc)
+		cmd.Env = append(cmd.Env, "HGRCPATH="+strings.Join(append(hgConfigPaths(), hgrc), string(os.PathListSeparator)))
+	}
+	return cmd.CombinedOutput()
+}
+
+// writeHgAuthConfig writes an hgrc with an [auth] section for prefix to a temporary file only the server
+// can read and returns its path
+func (r *Repository) writeHgAuthConfig(prefix string) (string, error) {
+	// A line break in the token would let it add arbitrary configuration
+	if strings.ContainsAny(r.Token, "\r\n") {
+		return "", errors.New("access token contains a line break")
+	}
+
+	file, err := os.CreateTemp("", "startit-hgrc-*")
+	if err != nil {
+		return "", err
+	}
+	config := fmt.Sprintf("[auth]\nstartit.prefix = %s\nstartit.username = %s\nstartit.password = %s\n", prefix, tokenUsername, r.Token)
+	if _, err := file.WriteString(config); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// hgConfigPaths returns the configuration files hg reads when HGRCPATH is unset, or the inherited
+// HGRCPATH, so pointing hg at the credentials keeps the server's own Mercurial configuration
+func hgConfigPaths() []string {
+	if inherited := os.Getenv("HGRCPATH"); inherited != "" {
+		return filepath.SplitList(inherited)
+	}
+	paths := []string{"/etc/mercurial/hgrc", "/etc/mercurial/hgrc.d"}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".hgrc"))
+	}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(configDir, "hg", "hgrc"))
+	}
+	return paths
+}
+
+// authPrefix returns the https://host the access token may be sent to, or "" when there is no token or
+// the remote is not an HTTPS URL
+func (r *Repository) authPrefix() string {
+	if r.Token == "" || r.SSHKeyPath != "" {
+		return ""
+	}
+
+	remote, err := r.remoteURL()
+	if err != nil {
+		return ""
+	}
+	parsed, err := url.Parse(remote)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return ""
+	}
+	return "https://" + parsed.Host
+}
+
+// remoteURL returns the normalized URL of the remote: the one the repository was created with, or for
+// opened clones, the one their origin (or hg default path) points to
+func (r *Repository) remoteURL() (string, error) {
+	if r.URL != "" {
+		if r.VCS == VCSMercurial {
+			return NormalizeMercurialURL(r.URL)
+		}
+		return NormalizeGitURL(r.URL)
+	}
+
+	cmd := gitCommand("-C", r.LocalDir, "remote", "get-url", "origin")
+	if r.VCS == VCSMercurial {
+		cmd = r.hgCommand(context.Background(), "--repository", r.LocalDir, "paths", "default")
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
@@ -0,0 +1,278 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CI systems whose configuration is read for commands
+const (
+	CISystemGitHubActions = "github-actions"
+	CISystemGitLab        = "gitlab-ci"
+)
+
+// githubWorkflowsDir holds GitHub Actions workflow files
+const githubWorkflowsDir = ".github/workflows"
+
+// gitlabCIFile is GitLab CI's configuration file in the repository root
+const gitlabCIFile = ".gitlab-ci.yml"
+
+// maxCICommands caps how many CI commands are collected, so huge pipelines don't flood the analysis
+const maxCICommands = 50
+
+// gitlabReservedKeys are top-level .gitlab-ci.yml keys that configure the pipeline rather than define jobs
+var gitlabReservedKeys = map[string]bool{
+	"default": true, "include": true, "stages": true, "variables": true, "workflow": true,
+	"image": true, "services": true, "cache": true, "before_script": true, "after_script": true,
+}
+
+// CICommand is a shell command run by a CI job, in the order the job runs it
+type CICommand struct {
+	System     string `json:"system"` // CISystemGitHubActions or CISystemGitLab
+	File       string `json:"file"`   // Configuration file, relative to the repository root
+	Job        string `json:"job"`
+	Step       string `json:"step,omitempty"` // GitHub Actions step name, when it has one
+	Run        string `json:"run"`
+	WorkingDir string `json:"workingDir,omitempty"` // Relative to the repository root; empty for the root
+}
+
+// DetectCICommands returns the shell commands run by the repository's GitHub Actions workflows and
+// GitLab CI jobs. Steps that use actions instead of running commands are left out. Files that can't be
+// parsed are reported as an error after the commands that could be read.
+func (r *Repository) DetectCICommands() ([]CICommand, error) {
+	var commands []CICommand
+	var errs []string
+
+	workflows, err := r.githubWorkflowFiles()
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	for _, file := range workflows {
+		found, err := parseGitHubWorkflow(r.LocalDir, file)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		commands = append(commands, found...)
+	}
+
+	if fileExists(filepath.Join(r.LocalDir, gitlabCIFile)) {
+		found, err := parseGitLabCI(r.LocalDir, gitlabCIFile)
+		if err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			commands = append(commands, found...)
+		}
+	}
+
+	if len(commands) > maxCICommands {
+		commands = commands[:maxCICommands]
+	}
+	if len(errs) > 0 {
+		return commands, fmt.Errorf("error reading CI configuration: %s", strings.Join(errs, "; "))
+	}
+	return commands, nil
+}
+
+// githubWorkflowFiles returns the sorted workflow files under .github/workflows, relative to the repository root
+func (r *Repository) githubWorkflowFiles() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(r.LocalDir, filepath.FromSlash(githubWorkflowsDir)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading %s: %w", githubWorkflowsDir, err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if !entry.IsDir() && (ext == ".yml" || ext == ".yaml") {
+			files = append(files, path.Join(githubWorkflowsDir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// parseGitHubWorkflow returns the run steps of a GitHub Actions workflow, job by job in file order
+func parseGitHubWorkflow(repoDir, file string) ([]CICommand, error) {
+	var workflow struct {
+		Defaults githubDefaults `yaml:"defaults"`
+		Jobs     yaml.Node      `yaml:"jobs"`
+	}
+	if err := readCIFile(repoDir, file, &workflow); err != nil {
+		return nil, err
+	}
+
+	var commands []CICommand
+	err := forEachMappingEntry(&workflow.Jobs, func(name string, node *yaml.Node) error {
+		var job struct {
+			Defaults githubDefaults `yaml:"defaults"`
+			Steps    []struct {
+				Name             string `yaml:"name"`
+				Run              string `yaml:"run"`
+				WorkingDirectory string `yaml:"working-directory"`
+			} `yaml:"steps"`
+		}
+		if err := node.Decode(&job); err != nil {
+			return fmt.Errorf("malformed job %q in %s: %w", name, file, err)
+		}
+
+		defaultDir := workflow.Defaults.Run.WorkingDirectory
+		if job.Defaults.Run.WorkingDirectory != "" {
+			defaultDir = job.Defaults.Run.WorkingDirectory
+		}
+		for _, step := range job.Steps {
+			run := strings.TrimSpace(step.Run)
+			if run == "" {
+				continue
+			}
+			dir := defaultDir
+			if step.WorkingDirectory != "" {
+				dir = step.WorkingDirectory
+			}
+			commands = append(commands, CICommand{
+				System:     CISystemGitHubActions,
+				File:       file,
+				Job:        name,
+				Step:       step.Name,
+				Run:        run,
+				WorkingDir: ciWorkingDir(dir),
+			})
+		}
+		return nil
+	})
+	return commands, err
+}
+
+// githubDefaults holds the defaults a workflow or job sets for its run steps
+type githubDefaults struct {
+	Run struct {
+		WorkingDirectory string `yaml:"working-directory"`
+	} `yaml:"run"`
+}
+
+// parseGitLabCI returns the before_script and script lines of each GitLab CI job in file order.
+// Hidden jobs (starting with ".") are templates and are skipped.
+func parseGitLabCI(repoDir, file string) ([]CICommand, error) {
+	var config yaml.Node
+	if err := readCIFile(repoDir, file, &config); err != nil {
+		return nil, err
+	}
+	if len(config.Content) == 0 {
+		return nil, nil
+	}
+
+	var commands []CICommand
+	err := forEachMappingEntry(config.Content[0], func(name string, node *yaml.Node) error {
+		if gitlabReservedKeys[name] || strings.HasPrefix(name, ".") || node.Kind != yaml.MappingNode {
+			return nil
+		}
+
+		var job struct {
+			BeforeScript yaml.Node `yaml:"before_script"`
+			Script       yaml.Node `yaml:"script"`
+		}
+		if err := node.Decode(&job); err != nil {
+			return fmt.Errorf("malformed job %q in %s: %w", name, file, err)
+		}
+
+		for _, script := range []*yaml.Node{&job.BeforeScript, &job.Script} {
+			lines, err := gitlabScriptLines(script)
+			if err != nil {
+				return fmt.Errorf("malformed script in job %q in %s: %w", name, file, err)
+			}
+			for _, line := range lines {
+				commands = append(commands, CICommand{System: CISystemGitLab, File: file, Job: name, Run: line})
+			}
+		}
+		return nil
+	})
+	return commands, err
+}
+
+// gitlabScriptLines returns the commands of a GitLab script, which is a single string or a list of strings
+func gitlabScriptLines(node *yaml.Node) ([]string, error) {
+	var lines []string
+	switch node.Kind {
+	case 0:
+		return nil, nil
+	case yaml.ScalarNode:
+		lines = []string{node.Value}
+	default:
+		// Nested lists come from YAML anchors and are flattened, as GitLab does
+		var items []interface{}
+		if err := node.Decode(&items); err != nil {
+			return nil, err
+		}
+		lines = flattenScript(items)
+	}
+
+	var commands []string
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			commands = append(commands, line)
+		}
+	}
+	return commands, nil
+}
+
+// Helper function to flatten nested script lists into their string items
+func flattenScript(items []interface{}) []string {
+	var lines []string
+	for _, item := range items {
+		switch value := item.(type) {
+		case string:
+			lines = append(lines, value)
+		case []interface{}:
+			lines = append(lines, flattenScript(value)...)
+		}
+	}
+	return lines
+}
+
+// readCIFile reads and decodes a YAML CI configuration file relative to the repository root
+func readCIFile(repoDir, file string, out interface{}) error {
+	content, err := os.ReadFile(filepath.Join(repoDir, filepath.FromSlash(file)))
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", file, err)
+	}
+	if err := yaml.Unmarshal(content, out); err != nil {
+		return fmt.Errorf("malformed %s: %w", file, err)
+	}
+	return nil
+}
+
+// forEachMappingEntry calls fn for each key of a YAML mapping in file order; other nodes have no entries
+func forEachMappingEntry(node *yaml.Node, fn func(key string, value *yaml.Node) error) error {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if err := fn(node.Content[i].Value, node.Content[i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ciWorkingDir cleans a CI working directory relative to the repository root. Directories that leave
+// the repository or use CI expressions can't be resolved locally and are dropped.
+func ciWorkingDir(dir string) string {
+	dir = strings.TrimSpace(dir)
+	if dir == "" || strings.Contains(dir, "${") || strings.Contains(dir, "$(") {
+		return ""
+	}
+	dir = path.Clean(strings.TrimPrefix(dir, "./"))
+	if dir == "." || path.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, "../") {
+		return ""
+	}
+	return dir
+}
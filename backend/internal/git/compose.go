@@ -0,0 +1,108 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// composeFileNames are the Compose file names checked, in Docker's order of precedence
+var composeFileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// ComposeService describes a service defined in a Docker Compose file
+type ComposeService struct {
+	Name  string   `json:"name"`
+	Image string   `json:"image,omitempty"`
+	Ports []string `json:"ports,omitempty"`
+}
+
+// composeServiceSpec is the subset of a Compose service definition we read
+type composeServiceSpec struct {
+	Image string        `yaml:"image"`
+	Build interface{}   `yaml:"build"`
+	Ports []interface{} `yaml:"ports"`
+}
+
+// GetComposeFile returns the name of the Compose file in the repository root, if any
+func (r *Repository) GetComposeFile() (string, bool) {
+	for _, name := range composeFileNames {
+		if fileExists(filepath.Join(r.LocalDir, name)) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// GetComposeServices parses the repository's Compose file and returns its services and published ports.
+// Both the v2/v3 schema (services under a top-level "services" key) and the legacy v1 schema are supported.
+func (r *Repository) GetComposeServices() ([]ComposeService, error) {
+	name, found := r.GetComposeFile()
+	if !found {
+		return nil, fmt.Errorf("no compose file found")
+	}
+
+	content, err := os.ReadFile(filepath.Join(r.LocalDir, name))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", name, err)
+	}
+
+	var document map[string]yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("malformed %s: %w", name, err)
+	}
+
+	specs := make(map[string]composeServiceSpec)
+	if servicesNode, ok := document["services"]; ok {
+		if err := servicesNode.Decode(&specs); err != nil {
+			return nil, fmt.Errorf("malformed services in %s: %w", name, err)
+		}
+	} else {
+		// v1 files list services at the top level
+		for key, node := range document {
+			var spec composeServiceSpec
+			if node.Decode(&spec) == nil && (spec.Image != "" || spec.Build != nil) {
+				specs[key] = spec
+			}
+		}
+	}
+
+	services := make([]ComposeService, 0, len(specs))
+	for serviceName, spec := range specs {
+		services = append(services, ComposeService{
+			Name:  serviceName,
+			Image: spec.Image,
+			Ports: parseComposePorts(spec.Ports),
+		})
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+
+	return services, nil
+}
+
+// parseComposePorts normalizes short ("8080:80", 3000) and long ({published, target}) port syntax
+func parseComposePorts(ports []interface{}) []string {
+	var result []string
+	for _, port := range ports {
+		switch value := port.(type) {
+		case string:
+			result = append(result, value)
+		case int:
+			result = append(result, fmt.Sprint(value))
+		case map[string]interface{}:
+			target, published := value["target"], value["published"]
+			switch {
+			case target != nil && published != nil:
+				result = append(result, fmt.Sprintf("%v:%v", published, target))
+			case target != nil:
+				result = append(result, fmt.Sprint(target))
+			}
+		}
+	}
+	return result
+}
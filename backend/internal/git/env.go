@@ -0,0 +1,51 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// envExampleFile is the conventional template listing the environment variables a project expects
+const envExampleFile = ".env.example"
+
+// envVarName matches a valid environment variable name
+var envVarName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// GetRequiredEnvVars returns the variable names declared in the repository's .env.example, in file order.
+// Lines of the form KEY= or KEY=value count (an "export " prefix is allowed); comments and blank lines are ignored.
+func (r *Repository) GetRequiredEnvVars() ([]string, error) {
+	content, err := os.ReadFile(filepath.Join(r.LocalDir, envExampleFile))
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", envExampleFile, err)
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, _, found := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !found || !envVarName.MatchString(key) || seen[key] {
+			continue
+		}
+
+		names = append(names, key)
+		seen[key] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", envExampleFile, err)
+	}
+
+	return names, nil
+}
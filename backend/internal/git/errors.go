@@ -0,0 +1,96 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CloneErrorKind classifies why a git clone failed
+type CloneErrorKind string
+
+const (
+	CloneErrorNotFound       CloneErrorKind = "repository_not_found"
+	CloneErrorAuthRequired   CloneErrorKind = "authentication_required"
+	CloneErrorBranchNotFound CloneErrorKind = "branch_not_found"
+	CloneErrorNetwork        CloneErrorKind = "network_error"
+	CloneErrorTimeout        CloneErrorKind = "timeout"
+	CloneErrorUnknown        CloneErrorKind = "unknown"
+)
+
+// CloneError is returned by Clone when git fails, classified from git's output
+type CloneError struct {
+	Kind   CloneErrorKind
+	Output string // git output with any access token redacted
+	Err    error
+}
+
+// Error implements the error interface
+func (e *CloneError) Error() string {
+	return fmt.Sprintf("git clone failed: %v - %s", e.Err, e.Output)
+}
+
+// Unwrap returns the underlying command error
+func (e *CloneError) Unwrap() error {
+	return e.Err
+}
+
+// newCloneError builds a CloneError, inspecting git's output to determine its kind
+func newCloneError(err error, output string) *CloneError {
+	kind := classifyCloneOutput(output)
+	if errors.Is(err, context.DeadlineExceeded) {
+		kind = CloneErrorTimeout
+	}
+
+	return &CloneError{
+		Kind:   kind,
+		Output: output,
+		Err:    err,
+	}
+}
+
+// classifyCloneOutput maps well-known git error messages to a CloneErrorKind
+func classifyCloneOutput(output string) CloneErrorKind {
+	text := strings.ToLower(output)
+
+	switch {
+	case strings.Contains(text, "remote branch") && strings.Contains(text, "not found"),
+		strings.Contains(text, "abort: unknown revision"),
+		strings.Contains(text, "abort: unknown branch"):
+		return CloneErrorBranchNotFound
+	case strings.Contains(text, "could not read username"),
+		strings.Contains(text, "could not read password"),
+		strings.Contains(text, "authentication failed"),
+		strings.Contains(text, "permission denied"),
+		strings.Contains(text, "the requested url returned error: 401"),
+		strings.Contains(text, "the requested url returned error: 403"),
+		strings.Contains(text, "authorization failed"),
+		strings.Contains(text, "http error 401"),
+		strings.Contains(text, "http error 403"):
+		return CloneErrorAuthRequired
+	case strings.Contains(text, "repository not found"),
+		strings.Contains(text, "does not appear to be a git repository"),
+		strings.Contains(text, "the requested url returned error: 404"),
+		strings.Contains(text, "http error 404"):
+		return CloneErrorNotFound
+	case strings.Contains(text, "could not resolve host"),
+		strings.Contains(text, "connection timed out"),
+		strings.Contains(text, "connection refused"),
+		strings.Contains(text, "network is unreachable"),
+		strings.Contains(text, "failed to connect"),
+		strings.Contains(text, "operation timed out"),
+		strings.Contains(text, "name or service not known"),
+		strings.Contains(text, "temporary failure in name resolution"),
+		strings.Contains(text, "connection reset by peer"),
+		strings.Contains(text, "early eof"),
+		strings.Contains(text, "unexpected disconnect while reading sideband packet"),
+		strings.Contains(text, "gnutls_handshake() failed"),
+		strings.Contains(text, "the requested url returned error: 502"),
+		strings.Contains(text, "the requested url returned error: 503"),
+		strings.Contains(text, "the requested url returned error: 504"):
+		return CloneErrorNetwork
+	}
+
+	return CloneErrorUnknown
+}
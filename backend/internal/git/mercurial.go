@@ -0,0 +1,136 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Version control systems a Repository can be cloned with or opened as
+const (
+	VCSGit       = "git"
+	VCSMercurial = "hg"
+	VCSNone      = "none" // A plain directory opened with OpenDirectory
+)
+
+// mercurialDefaultBranch is the branch Mercurial checks out when none is requested
+const mercurialDefaultBranch = "default"
+
+// IsMercurialURL reports whether a URL names a Mercurial repository: either it uses the hg+ scheme
+// prefix (hg+https://, hg+ssh://) or its host starts with "hg." as with hg.mozilla.org
+func IsMercurialURL(raw string) bool {
+	url := strings.TrimSpace(raw)
+	if strings.HasPrefix(url, "hg+") {
+		return true
+	}
+
+	for _, scheme := range []string{"https://", "http://", "ssh://"} {
+		if strings.HasPrefix(url, scheme) {
+			host := strings.TrimPrefix(url, scheme)
+			if at := strings.Index(host, "@"); at >= 0 && at < strings.Index(host+"/", "/") {
+				host = host[at+1:]
+			}
+			return strings.HasPrefix(host, "hg.")
+		}
+	}
+	return false
+}
+
+// NormalizeMercurialURL strips the hg+ prefix and checks that the URL uses a scheme hg can clone
+func NormalizeMercurialURL(raw string) (string, error) {
+	url := strings.TrimPrefix(strings.TrimSpace(raw), "hg+")
+	if url == "" {
+		return "", errors.New("Mercurial URL is empty")
+	}
+
+	for _, scheme := range []string{"https://", "http://", "ssh://"} {
+		if strings.HasPrefix(url, scheme) && len(url) > len(scheme) {
+			return url, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported Mercurial URL: %s", raw)
+}
+
+// cloneMercurial clones the repository with hg, then updates to the pinned ref or requested branch.
+// As with git, a missing main or master branch falls back to the repository's default branch.
+func (r *Repository) cloneMercurial(ctx context.Context) error {
+	if _, err := exec.LookPath("hg"); err != nil {
+		return errors.New("Mercurial (hg) is not installed on the server")
+	}
+
+	repoURL, err := NormalizeMercurialURL(r.URL)
+	if err != nil {
+		return err
+	}
+	cloneOutput, err := r.withCloneRetry(ctx, func() (string, error) {
+		output, err := r.runRemoteHg(ctx, "clone", repoURL, r.LocalDir)
+		return string(output), err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return newCloneError(err, r.redactToken(cloneOutput))
+	}
+
+	target := r.Ref
+	if target == "" {
+		target = r.Branch
+	}
+	if target == "" || target == mercurialDefaultBranch {
+		r.Branch = mercurialDefaultBranch
+		return nil
+	}
+
+	output, err := r.hgCommand(ctx, "--repository", r.LocalDir, "update", "--clean", target).CombinedOutput()
+	if err != nil {
+		// main and master are git conventions; Mercurial repositories usually only have "default"
+		if r.Ref == "" && (target == "main" || target == "master") {
+			r.Branch = mercurialDefaultBranch
+			return nil
+		}
+		return newCloneError(err, string(output))
+	}
+
+	if r.Ref == "" {
+		r.Branch = target
+	}
+	return nil
+}
+
+// updateMercurial pulls the latest changes and updates the working copy to the branch, discarding local changes
+func (r *Repository) updateMercurial() error {
+	branch := r.Branch
+	if branch == "" {
+		branch = mercurialDefaultBranch
+	}
+
+	ctx := context.Background()
+	if output, err := r.runRemoteHg(ctx, "--repository", r.LocalDir, "pull"); err != nil {
+		return fmt.Errorf("hg pull failed: %w - %s", err, r.redactToken(string(output)))
+	}
+
+	if output, err := r.hgCommand(ctx, "--repository", r.LocalDir, "update", "--clean", branch).CombinedOutput(); err != nil {
+		return fmt.Errorf("hg update to %s failed: %w - %s", branch, err, string(output))
+	}
+
+	r.Branch = branch
+	return nil
+}
+
+// hgCommand creates an hg command bound to ctx that never prompts, authenticating with the SSH key if one
+// is set. Commands that talk to the remote go through runRemoteHg, which adds the access token.
+func (r *Repository) hgCommand(ctx context.Context, args ...string) *exec.Cmd {
+	if r.SSHKeyPath != "" {
+		args = append([]string{"--ssh", r.sshCommand()}, args...)
+	}
+	cmd := exec.CommandContext(ctx, "hg", append([]string{"--noninteractive"}, args...)...)
+	// HGPLAIN disables user configuration that changes hg's output, such as aliases and localization
+	cmd.Env = append(os.Environ(), "HGPLAIN=1")
+	r.applyProxy(cmd)
+	cmd.WaitDelay = gitWaitDelay
+	return cmd
+}
@@ -0,0 +1,83 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"strings"
+)
+
+// runClone runs git with the given clone arguments and returns its combined output, retrying network
+// failures. When a progress callback is set, --progress is passed so git reports progress even without a
+// terminal, and each progress line is forwarded as it arrives.
+func (r *Repository) runClone(ctx context.Context, args []string) (string, error) {
+	return r.withCloneRetry(ctx, func() (string, error) {
+		return r.runCloneOnce(ctx, args)
+	})
+}
+
+// runCloneOnce makes a single clone attempt for runClone
+func (r *Repository) runCloneOnce(ctx context.Context, args []string) (string, error) {
+	if r.onProgress != nil && len(args) > 0 {
+		args = append([]string{args[0], "--progress"}, args[1:]...)
+	}
+
+	// The same writer is used for stdout and stderr so exec serializes the writes
+	writer := &progressWriter{onLine: r.reportProgress}
+	cmd := r.remoteCommand(ctx, args...)
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	err := cmd.Run()
+	writer.flush()
+
+	// Report cancellation and timeouts as such rather than as "signal: killed"
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	return writer.output.String(), err
+}
+
+// reportProgress forwards a progress line to the callback with any access token masked
+func (r *Repository) reportProgress(line string) {
+	if r.onProgress != nil {
+		r.onProgress(r.redactToken(line))
+	}
+}
+
+// progressWriter keeps everything written to it and calls onLine for each completed line.
+// git redraws progress with carriage returns, so both \r and \n end a line.
+type progressWriter struct {
+	output  bytes.Buffer
+	pending strings.Builder
+	onLine  func(string)
+}
+
+// Write records p and emits any lines it completes
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.output.Write(p)
+
+	for _, b := range p {
+		if b == '\r' || b == '\n' {
+			w.emit()
+			continue
+		}
+		w.pending.WriteByte(b)
+	}
+
+	return len(p), nil
+}
+
+// flush emits a trailing line that was not terminated
+func (w *progressWriter) flush() {
+	w.emit()
+}
+
+// emit sends the pending line to onLine if it has any content
+func (w *progressWriter) emit() {
+	line := strings.TrimSpace(w.pending.String())
+	w.pending.Reset()
+	if line != "" && w.onLine != nil {
+		w.onLine(line)
+	}
+}
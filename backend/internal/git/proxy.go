@@ -0,0 +1,65 @@
+package git
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+)
+
+// proxySchemes are the proxy URL schemes git (through libcurl) and Go's HTTP client both understand
+var proxySchemes = map[string]bool{"http": true, "https": true, "socks5": true, "socks5h": true}
+
+// proxyEnvVars are the variables that carry the proxy to git, hg and their helpers; both spellings are
+// set because tools disagree on which one they read
+var proxyEnvVars = []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy", "ALL_PROXY", "all_proxy"}
+
+// ValidateProxyURL checks that proxy is an absolute http, https or socks5 proxy URL
+func ValidateProxyURL(proxy string) error {
+	parsed, err := url.Parse(proxy)
+	if err != nil || parsed.Host == "" || !proxySchemes[parsed.Scheme] {
+		return fmt.Errorf("invalid proxy URL %q: use http://, https://, socks5:// or socks5h://host:port", proxy)
+	}
+	return nil
+}
+
+// SetProxy routes the repository's network traffic through an HTTP(S) or SOCKS proxy. It takes precedence
+// over the server's HTTPS_PROXY/HTTP_PROXY variables and any http.proxy in its git configuration.
+func (r *Repository) SetProxy(proxy string) {
+	r.Proxy = proxy
+}
+
+// proxyArgs returns the git arguments that force the proxy, since git's http.proxy setting would
+// otherwise win over the environment variables
+func (r *Repository) proxyArgs() []string {
+	if r.Proxy == "" {
+		return nil
+	}
+	return []string{"-c", "http.proxy=" + r.Proxy}
+}
+
+// applyProxy adds the proxy to a command's environment
+func (r *Repository) applyProxy(cmd *exec.Cmd) {
+	if r.Proxy == "" {
+		return
+	}
+	// Later entries win, so these override the inherited variables
+	for _, name := range proxyEnvVars {
+		cmd.Env = append(cmd.Env, name+"="+r.Proxy)
+	}
+}
+
+// httpClient returns the client for archive downloads, using the proxy when one is set and the
+// server's proxy environment otherwise
+func (r *Repository) httpClient() *http.Client {
+	if r.Proxy == "" {
+		return http.DefaultClient
+	}
+	proxyURL, err := url.Parse(r.Proxy)
+	if err != nil {
+		return http.DefaultClient
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,102 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// RemoteRefs lists the branches and tags advertised by a remote repository
+type RemoteRefs struct {
+	DefaultBranch string   `json:"defaultBranch,omitempty"`
+	Branches      []string `json:"branches"`
+	Tags          []string `json:"tags"`
+}
+
+// ListRemoteRefs runs git ls-remote against the repository URL without cloning it. Failures are
+// returned as a *CloneError so callers can tell unreachable, missing and private repositories apart.
+func (r *Repository) ListRemoteRefs(ctx context.Context) (*RemoteRefs, error) {
+	output, err := r.lsRemote(ctx, []string{"--symref"})
+	if err != nil {
+		return nil, err
+	}
+	return parseRemoteRefs(output), nil
+}
+
+// RemoteDefaultBranch returns the branch the remote's HEAD points to, using git ls-remote --symref
+// <url> HEAD. Failures are returned as a *CloneError; a remote that doesn't advertise HEAD as a
+// symbolic ref, as some dumb HTTP servers don't, is an error too.
+func (r *Repository) RemoteDefaultBranch(ctx context.Context) (string, error) {
+	output, err := r.lsRemote(ctx, []string{"--symref"}, "HEAD")
+	if err != nil {
+		return "", err
+	}
+	branch := parseRemoteRefs(output).DefaultBranch
+	if branch == "" {
+		return "", errors.New("remote did not report a default branch")
+	}
+	return branch, nil
+}
+
+// ListRemoteBranches returns the sorted branch names of the remote repository using git ls-remote --heads.
+// Like ListRemoteRefs, failures are returned as a *CloneError.
+func (r *Repository) ListRemoteBranches(ctx context.Context) ([]string, error) {
+	output, err := r.lsRemote(ctx, []string{"--heads"})
+	if err != nil {
+		return nil, err
+	}
+	return parseRemoteRefs(output).Branches, nil
+}
+
+// lsRemote runs git ls-remote with the given flags against the repository URL, listing only the refs
+// matching patterns when any are given
+func (r *Repository) lsRemote(ctx context.Context, flags []string, patterns ...string) (string, error) {
+	repoURL, err := r.cloneURL()
+	if err != nil {
+		return "", err
+	}
+
+	args := append(append(append([]string{"ls-remote"}, flags...), repoURL), patterns...)
+	output, err := r.remoteCommand(ctx, args...).CombinedOutput()
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return "", newCloneError(err, r.redactToken(string(output)))
+	}
+	return string(output), nil
+}
+
+// parseRemoteRefs extracts branch and tag names from git ls-remote --symref output
+func parseRemoteRefs(output string) *RemoteRefs {
+	refs := &RemoteRefs{Branches: []string{}, Tags: []string{}}
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		// "ref: refs/heads/main	HEAD" names the branch HEAD points to
+		if fields[0] == "ref:" {
+			if len(fields) == 3 && fields[2] == "HEAD" {
+				refs.DefaultBranch = strings.TrimPrefix(fields[1], "refs/heads/")
+			}
+			continue
+		}
+
+		name := fields[1]
+		switch {
+		case strings.HasPrefix(name, "refs/heads/"):
+			refs.Branches = append(refs.Branches, strings.TrimPrefix(name, "refs/heads/"))
+		case strings.HasPrefix(name, "refs/tags/") && !strings.HasSuffix(name, "^{}"):
+			// Annotated tags are listed twice; the ^{} entry is the peeled commit
+			refs.Tags = append(refs.Tags, strings.TrimPrefix(name, "refs/tags/"))
+		}
+	}
+
+	sort.Strings(refs.Branches)
+	sort.Strings(refs.Tags)
+	return refs
+}
@@ -1,21 +1,46 @@
 package git
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Repository represents a Git repository
 type Repository struct {
-	URL      string
-	Branch   string
-	LocalDir string
+	URL        string
+	Branch     string
+	LocalDir   string
+	Depth        int           // Clone depth; zero or less means full history
+	Token        string        // Access token for private HTTPS clones
+	Ref          string        // Optional tag or commit SHA to pin the clone to
+	Submodules   bool          // Initialize git submodules recursively when cloning
+	Timeout      time.Duration // Clone time limit; zero or less means DefaultCloneTimeout
+	SSHKeyPath   string        // Private key for SSH clones; when set the URL is kept as (or turned into) SSH
+	SingleBranch bool          // Fetch only the cloned branch's refs instead of every branch
+	VCS          string        // VCSGit, VCSMercurial, VCSArchive or VCSNone; empty means git
+	Archive      bool          // Download a GitHub source archive instead of cloning, when possible
+	Proxy        string        // HTTP(S) or SOCKS proxy for network access; empty uses the server's proxy settings
+	Commit       string        // Commit checked out when the repository was opened
+	FastForward  bool          // Fast-forward an existing checkout that a clone reuses
+	onProgress   func(string)
+	reused       bool
 }
 
+// DefaultCloneTimeout is how long a clone may run before git is killed
+const DefaultCloneTimeout = 5 * time.Minute
+
+// gitWaitDelay is how long to wait for a killed git command's output pipes to close
+const gitWaitDelay = 5 * time.Second
+
 // NewRepository creates a new Repository instance
 func NewRepository(url, branch, localDir string) *Repository {
 	if branch == "" {
@@ -35,68 +60,350 @@ func OpenRepository(localDir string) (*Repository, error) {
 		return nil, fmt.Errorf("directory does not exist: %s", localDir)
 	}
 	
-	// Check if this is a git repository by looking for .git directory
-	gitDir := filepath.Join(localDir, ".git")
-	if !dirExists(gitDir) {
-		return nil, fmt.Errorf("not a git repository (missing .git directory): %s", localDir)
+	// Check if this is a git or Mercurial repository by looking for its metadata directory
+	repo := &Repository{LocalDir: localDir, VCS: VCSGit}
+	if dirExists(filepath.Join(localDir, ".hg")) {
+		repo.VCS = VCSMercurial
+	} else if !dirExists(filepath.Join(localDir, ".git")) {
+		// Archive snapshots have no metadata directory, only the marker recording their origin
+		info, err := readArchiveInfo(localDir)
+		if err != nil {
+			return nil, fmt.Errorf("not a git or Mercurial repository (missing .git or .hg directory): %s", localDir)
+		}
+		repo.VCS = VCSArchive
+		repo.URL = info.URL
 	}
 	
-	return &Repository{
-		LocalDir: localDir,
-	}, nil
+	// A repository without commits or on a detached HEAD still opens; the fields just stay empty
+	repo.Commit, _ = repo.CurrentCommit()
+	repo.Branch, _ = repo.CurrentBranch()
+	
+	return repo, nil
+}
+
+// OpenDirectory opens a plain directory, such as an extracted archive, as a repository without version
+// control. Files, README and structure can be read as usual, but there is no commit, branch or remote.
+// Directories that are git or Mercurial repositories are opened with OpenRepository instead.
+func OpenDirectory(localDir string) (*Repository, error) {
+	if repo, err := OpenRepository(localDir); err == nil {
+		return repo, nil
+	}
+	if !dirExists(localDir) {
+		return nil, fmt.Errorf("directory does not exist: %s", localDir)
+	}
+	return &Repository{LocalDir: localDir, VCS: VCSNone}, nil
+}
+
+// SetDepth sets the history depth used for shallow clones
+func (r *Repository) SetDepth(depth int) {
+	r.Depth = depth
+}
+
+// SetToken sets the access token used to authenticate HTTPS clones
+func (r *Repository) SetToken(token string) {
+	r.Token = token
+}
+
+// SetRef pins the clone to a tag, commit SHA or branch name
+func (r *Repository) SetRef(ref string) {
+	r.Ref = ref
+}
+
+// SetSubmodules controls whether submodules are initialized during clone
+func (r *Repository) SetSubmodules(submodules bool) {
+	r.Submodules = submodules
+}
+
+// SetTimeout sets how long a clone may run before it is aborted
+func (r *Repository) SetTimeout(timeout time.Duration) {
+	r.Timeout = timeout
+}
+
+// SetSSHKeyPath makes clones and fetches authenticate over SSH with the given private key
+func (r *Repository) SetSSHKeyPath(keyPath string) {
+	r.SSHKeyPath = keyPath
+}
+
+// SetSingleBranch controls whether clones fetch only the branch being checked out
+func (r *Repository) SetSingleBranch(singleBranch bool) {
+	r.SingleBranch = singleBranch
+}
+
+// SetVCS selects the version control system used to clone, VCSGit or VCSMercurial
+func (r *Repository) SetVCS(vcs string) {
+	r.VCS = vcs
+}
+
+// SetProgressCallback registers a callback that receives git's clone progress lines as they arrive
+func (r *Repository) SetProgressCallback(onProgress func(string)) {
+	r.onProgress = onProgress
 }
 
 // Clone clones a repository to the local filesystem
 func (r *Repository) Clone() error {
+	return r.CloneContext(context.Background())
+}
+
+// CloneContext clones a repository to the local filesystem, stopping git if ctx is cancelled
+// or the clone timeout elapses
+func (r *Repository) CloneContext(ctx context.Context) error {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCloneTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
 	// Ensure the directory exists
 	if err := os.MkdirAll(filepath.Dir(r.LocalDir), 0755); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	// Check if directory already exists and is not empty
+	// Check if directory already exists and is not empty; a checkout of the same repository, such as
+	// one left by an earlier attempt, is reused so retrying a clone is safe
+	r.reused = false
 	if dirExists(r.LocalDir) {
+		if reused, err := r.reuseExistingClone(ctx); reused || err != nil {
+			return err
+		}
 		return fmt.Errorf("directory already exists and is not empty: %s", r.LocalDir)
 	}
 
-	// For public GitHub repositories, use HTTPS instead of SSH
-	repoURL := r.URL
-	if strings.Contains(repoURL, "github.com") && !strings.HasPrefix(repoURL, "https://") {
-		repoURL = "https://" + strings.TrimPrefix(repoURL, "git@")
-		repoURL = strings.Replace(repoURL, ":", "/", 1)
+	if r.VCS == VCSMercurial {
+		return r.cloneMercurial(ctx)
 	}
 
-	// Run git clone command
-	cmd := exec.Command("git", "clone", "-b", r.Branch, repoURL, r.LocalDir)
-	output, err := cmd.CombinedOutput()
+	// Archive downloads fall back to a regular clone when they fail
+	if r.cloneArchive(ctx) {
+		return nil
+	}
+
+	// Expand shorthands and use HTTPS instead of SSH for public hosting services,
+	// unless an SSH key was provided
+	repoURL, err := r.cloneURL()
 	if err != nil {
-		// Try with default branch if specified branch fails
-		if r.Branch != "main" && r.Branch != "master" {
-			// Try with main branch
-			r.Branch = "main"
-			cmd = exec.Command("git", "clone", "-b", r.Branch, repoURL, r.LocalDir)
-			output, err = cmd.CombinedOutput()
-			if err != nil {
-				// Try with master branch
-				r.Branch = "master"
-				cmd = exec.Command("git", "clone", "-b", r.Branch, repoURL, r.LocalDir)
-				output, err = cmd.CombinedOutput()
-				if err != nil {
-					// Just try without specifying a branch
-					cmd = exec.Command("git", "clone", repoURL, r.LocalDir)
-					output, err = cmd.CombinedOutput()
-					if err != nil {
-						return fmt.Errorf("git clone failed: %w - %s", err, string(output))
-					}
-				}
+		return err
+	}
+
+	// Pinned refs: commit SHAs are checked out after cloning, tags are cloned directly
+	if r.Ref != "" {
+		if isCommitSHA(r.Ref) {
+			return r.cloneCommit(ctx, repoURL)
+		}
+		if r.isRemoteTag(ctx, repoURL) {
+			if output, err := r.runClone(ctx, r.cloneArgs(r.Ref, repoURL)); err != nil {
+				return newCloneError(err, r.redactToken(output))
 			}
-		} else {
-			return fmt.Errorf("git clone failed: %w - %s", err, string(output))
+			return nil
 		}
+		// Anything else is treated as a branch name
+		r.Branch = r.Ref
+	}
+
+	// Run git clone command
+	output, err := r.runClone(ctx, r.cloneArgs(r.Branch, repoURL))
+	if err != nil {
+		// Trying other branches is pointless once the clone was cancelled or timed out
+		if ctx.Err() != nil {
+			return newCloneError(err, r.redactToken(output))
+		}
+
+		// Unreachable or private repositories fail the same way on every branch, so only retry missing branches
+		cloneErr := newCloneError(err, r.redactToken(output))
+		if cloneErr.Kind != CloneErrorBranchNotFound {
+			return cloneErr
+		}
+
+		// Ask the remote for its real default branch, such as develop or trunk, instead of guessing
+		branch, lookupErr := r.RemoteDefaultBranch(ctx)
+		if lookupErr == nil && branch == r.Branch {
+			return cloneErr
+		}
+		if lookupErr != nil {
+			// Without a symbolic HEAD, let git check out whatever the remote's default is
+			log.Printf("Could not detect the default branch of %s, cloning without a branch: %v", r.redactToken(r.URL), lookupErr)
+			branch = ""
+		}
+
+		output, err = r.runClone(ctx, r.cloneArgs(branch, repoURL))
+		if err != nil {
+			return newCloneError(err, r.redactToken(output))
+		}
+		if branch == "" {
+			branch, _ = r.CurrentBranch()
+		}
+		r.Branch = branch
 	}
 
 	return nil
 }
 
+// cloneCommit clones the default branch and checks out the pinned commit SHA
+func (r *Repository) cloneCommit(ctx context.Context, repoURL string) error {
+	// A shallow clone may not contain the commit, so always fetch full history here
+	if output, err := r.runClone(ctx, []string{"clone", repoURL, r.LocalDir}); err != nil {
+		return newCloneError(err, r.redactToken(output))
+	}
+
+	cmd := gitCommandContext(ctx, "-C", r.LocalDir, "checkout", r.Ref)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git checkout %s failed: %w - %s", r.Ref, err, string(output))
+	}
+
+	// Submodules must match the pinned commit rather than the default branch
+	return r.initSubmodules(ctx)
+}
+
+// initSubmodules initializes and updates submodules recursively when enabled
+func (r *Repository) initSubmodules(ctx context.Context) error {
+	if !r.Submodules {
+		return nil
+	}
+
+	cmd := r.remoteCommand(ctx, "-C", r.LocalDir, "submodule", "update", "--init", "--recursive")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git submodule update failed: %w - %s", err, r.redactToken(string(output)))
+	}
+
+	return nil
+}
+
+// isRemoteTag checks whether the ref exists as a tag on the remote
+func (r *Repository) isRemoteTag(ctx context.Context, repoURL string) bool {
+	cmd := r.remoteCommand(ctx, "ls-remote", "--exit-code", "--tags", repoURL, "refs/tags/"+r.Ref)
+	return cmd.Run() == nil
+}
+
+// Update fetches the latest changes and hard-resets the working tree to the remote branch.
+// When no branch is set, the currently checked-out branch is updated.
+func (r *Repository) Update() error {
+	if r.VCS == VCSMercurial {
+		return r.updateMercurial()
+	}
+	if r.VCS == VCSArchive {
+		return errors.New("archive snapshots have no history to update; clone the repository again instead")
+	}
+	if r.VCS == VCSNone {
+		return errors.New("directory is not under version control, so it cannot be updated")
+	}
+
+	branch := r.Branch
+	if branch == "" {
+		cmd := gitCommand("-C", r.LocalDir, "rev-parse", "--abbrev-ref", "HEAD")
+		output, err := cmd.Output()
+		if err != nil {
+			return fmt.Errorf("failed to determine current branch: %w", err)
+		}
+		branch = strings.TrimSpace(string(output))
+		if branch == "HEAD" {
+			return errors.New("repository is in detached HEAD state; specify a branch to update")
+		}
+	}
+
+	// Use an explicit refspec so single-branch (shallow) clones still update origin/<branch>
+	refspec := fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", branch, branch)
+	fetchArgs := []string{"-C", r.LocalDir, "fetch", "origin", refspec}
+	if r.Depth > 0 {
+		fetchArgs = append(fetchArgs, "--depth", strconv.Itoa(r.Depth))
+	}
+	cmd := r.remoteCommand(context.Background(), fetchArgs...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git fetch failed: %w - %s", err, r.redactToken(string(output)))
+	}
+
+	// Force-checkout the branch at the remote commit, discarding local changes (a hard reset)
+	cmd = gitCommand("-C", r.LocalDir, "checkout", "-f", "-B", branch, "origin/"+branch)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git reset to origin/%s failed: %w - %s", branch, err, string(output))
+	}
+
+	r.Branch = branch
+	return nil
+}
+
+// IsCloneOf reports whether the local directory is a clone of the given remote URL
+func (r *Repository) IsCloneOf(url string) bool {
+	if r.VCS == VCSNone {
+		return false
+	}
+	if r.VCS == VCSArchive {
+		info, err := readArchiveInfo(r.LocalDir)
+		if err != nil {
+			return false
+		}
+		origin := info.URL
+		if normalized, err := NormalizeGitURL(origin); err == nil {
+			origin = normalized
+		}
+		if normalized, err := NormalizeGitURL(url); err == nil {
+			url = normalized
+		}
+		return normalizeRemoteURL(origin) == normalizeRemoteURL(url)
+	}
+	if r.VCS == VCSMercurial {
+		output, err := r.hgCommand(context.Background(), "--repository", r.LocalDir, "paths", "default").Output()
+		if err != nil {
+			return false
+		}
+		if normalized, err := NormalizeMercurialURL(url); err == nil {
+			url = normalized
+		}
+		return normalizeRemoteURL(string(output)) == normalizeRemoteURL(url)
+	}
+
+	cmd := gitCommand("-C", r.LocalDir, "remote", "get-url", "origin")
+	output, err := cmd.Output()
+	if err != nil {
+		return false
+	}
+	// Compare against the URL a clone would use so owner/repo shorthands match too
+	if normalized, err := NormalizeGitURL(url); err == nil {
+		url = normalized
+	}
+	return normalizeRemoteURL(string(output)) == normalizeRemoteURL(url)
+}
+
+// cloneURL returns the URL to clone from: an SSH URL when an SSH key is set, otherwise the
+// normalized HTTPS URL. The access token is sent separately, see authEnv.
+func (r *Repository) cloneURL() (string, error) {
+	if r.SSHKeyPath != "" {
+		return NormalizeSSHGitURL(r.URL)
+	}
+
+	repoURL, err := NormalizeGitURL(r.URL)
+	if err != nil {
+		return "", err
+	}
+	return repoURL, nil
+}
+
+// redactToken masks the access token so it never ends up in errors or logs
+func (r *Repository) redactToken(text string) string {
+	if r.Token == "" {
+		return text
+	}
+	return strings.ReplaceAll(text, r.Token, "***")
+}
+
+// cloneArgs builds the git clone arguments for the given branch, carrying the depth and
+// single-branch flags. Without a branch, --single-branch fetches only the remote's default branch.
+func (r *Repository) cloneArgs(branch, repoURL string) []string {
+	args := []string{"clone"}
+	if branch != "" {
+		args = append(args, "-b", branch)
+	}
+	if r.SingleBranch {
+		args = append(args, "--single-branch")
+	}
+	if r.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(r.Depth))
+	}
+	if r.Submodules {
+		args = append(args, "--recurse-submodules")
+	}
+	return append(args, repoURL, r.LocalDir)
+}
+
 // GetReadmeContent returns the content of the README file
 func (r *Repository) GetReadmeContent() (string, error) {
 	if !dirExists(r.LocalDir) {
@@ -164,17 +471,9 @@ func (r *Repository) GetFiles() ([]string, error) {
 		return nil, errors.New("repository directory does not exist")
 	}
 
+	// Unreadable directories are logged and skipped rather than failing the listing
 	var files []string
-	err := filepath.Walk(r.LocalDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Skip .git directory
-		if info.IsDir() && info.Name() == ".git" {
-			return filepath.SkipDir
-		}
-
+	_, err := r.walkReadable(func(path string, info os.FileInfo, err error) error {
 		// Only include regular files
 		if !info.IsDir() {
 			relPath, err := filepath.Rel(r.LocalDir, path)
@@ -193,9 +492,92 @@ func (r *Repository) GetFiles() ([]string, error) {
 	return files, nil
 }
 
+// CountTrackedFiles returns how many files git (or Mercurial) tracks. Unlike GetTrackedFiles it never
+// walks the directory, so it stays cheap for huge working trees; it fails when the VCS can't answer.
+func (r *Repository) CountTrackedFiles() (int, error) {
+	if r.VCS == VCSArchive || r.VCS == VCSNone {
+		// Archives only contain tracked files, and plain directories track nothing, so count what is on disk
+		files, err := r.GetFiles()
+		return len(files), err
+	}
+	cmd := gitCommand("-C", r.LocalDir, "ls-files", "-z")
+	if r.VCS == VCSMercurial {
+		cmd = r.hgCommand(context.Background(), "--repository", r.LocalDir, "files", "--print0")
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list tracked files: %w", err)
+	}
+	return bytes.Count(output, []byte{0}), nil
+}
+
+// GetTrackedFiles returns the files tracked by git, so ignored build output and dependencies are left out.
+// It falls back to GetFiles when git is unavailable or the directory is not a git repository.
+func (r *Repository) GetTrackedFiles() ([]string, error) {
+	if !dirExists(r.LocalDir) {
+		return nil, errors.New("repository directory does not exist")
+	}
+
+	// Archives hold exactly the tracked files and plain directories have no git metadata to ask; asking git
+	// would list the files of an enclosing repository instead
+	if r.VCS == VCSArchive || r.VCS == VCSNone {
+		return r.GetFiles()
+	}
+
+	// -z keeps paths with spaces or unusual characters intact
+	output, err := gitCommand("-C", r.LocalDir, "ls-files", "-z").Output()
+	if err != nil {
+		// git is missing or this isn't a work tree; walk the directory instead
+		return r.GetFiles()
+	}
+
+	var files []string
+	for _, path := range strings.Split(string(output), "\x00") {
+		if path != "" {
+			files = append(files, filepath.FromSlash(path))
+		}
+	}
+
+	return files, nil
+}
+
+// ErrPathOutsideRepository is returned when a relative path escapes the repository directory
+var ErrPathOutsideRepository = errors.New("path is outside the repository")
+
+// ErrPathInVCSMetadata is returned when a relative path points into the .git or .hg directory, which
+// holds the remote configuration and is never served
+var ErrPathInVCSMetadata = errors.New("path is inside the version control metadata")
+
+// ResolvePath joins a repository-relative path onto LocalDir, following symlinks, and rejects
+// any path that ends up outside the repository or inside its .git or .hg directory
+func (r *Repository) ResolvePath(relPath string) (string, error) {
+	root, err := filepath.EvalSymlinks(r.LocalDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve repository directory: %w", err)
+	}
+
+	fullPath := filepath.Join(root, filepath.FromSlash(relPath))
+	if resolved, err := filepath.EvalSymlinks(fullPath); err == nil {
+		fullPath = resolved
+	}
+
+	rel, err := filepath.Rel(root, fullPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrPathOutsideRepository
+	}
+	if first, _, _ := strings.Cut(filepath.ToSlash(rel), "/"); isVCSDir(first) {
+		return "", ErrPathInVCSMetadata
+	}
+
+	return fullPath, nil
+}
+
 // GetFileContent returns the content of a file in the repository
 func (r *Repository) GetFileContent(filePath string) ([]byte, error) {
-	fullPath := filepath.Join(r.LocalDir, filePath)
+	fullPath, err := r.ResolvePath(filePath)
+	if err != nil {
+		return nil, err
+	}
 	if !fileExists(fullPath) {
 		return nil, fmt.Errorf("file does not exist: %s", filePath)
 	}
@@ -219,66 +601,45 @@ func (r *Repository) GetRepositoryName() string {
 	return "unknown-repo"
 }
 
-// GetAllMarkdownFiles retrieves all markdown files from the repository
-func (r *Repository) GetAllMarkdownFiles() (map[string]string, error) {
-	markdownFiles := make(map[string]string)
+// markdownReadWorkers bounds how many markdown files are read at once
+const markdownReadWorkers = 8
+
+// GetAllMarkdownFiles retrieves all markdown files from the repository. Paths are collected first and the
+// files read concurrently, which matters for documentation-heavy repositories. Files and directories that
+// can't be read are skipped rather than failing the walk; their relative paths are returned as skipped.
+func (r *Repository) GetAllMarkdownFiles() (map[string]string, []string, error) {
+	var paths []string
 	
-	err := filepath.Walk(r.LocalDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		
-		// Skip .git directory
-		if info.IsDir() && filepath.Base(path) == ".git" {
-			return filepath.SkipDir
-		}
-		
+	skipped, err := r.walkReadable(func(path string, info os.FileInfo, err error) error {
 		// Check if file is markdown
 		if !info.IsDir() && (strings.HasSuffix(strings.ToLower(info.Name()), ".md") || 
 							 strings.HasSuffix(strings.ToLower(info.Name()), ".markdown")) {
-			// Read file content
-			content, err := os.ReadFile(path)
-			if err != nil {
-				return nil // Skip files we can't read
-			}
-			
-			// Store file content with relative path
-			relPath, err := filepath.Rel(r.LocalDir, path)
-			if err != nil {
-				relPath = path // Fallback to full path if we can't get relative path
-			}
-			
-			markdownFiles[relPath] = string(content)
+			paths = append(paths, path)
 		}
 		
 		return nil
 	})
 	
 	if err != nil {
-		return nil, err
+		return nil, skipped, err
 	}
 	
+	markdownFiles, unreadableFiles := r.readFiles(paths, markdownReadWorkers)
+	skipped = append(skipped, unreadableFiles...)
+	
 	if len(markdownFiles) == 0 {
-		return nil, fmt.Errorf("no markdown files found in repository")
+		return nil, skipped, fmt.Errorf("no markdown files found in repository")
 	}
 	
-	return markdownFiles, nil
+	return markdownFiles, skipped, nil
 }
 
 // GetReadmeFiles retrieves README files from the repository
 func (r *Repository) GetReadmeFiles() (map[string]string, error) {
 	readmeFiles := make(map[string]string)
 	
-	err := filepath.Walk(r.LocalDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		
-		// Skip .git directory
-		if info.IsDir() && filepath.Base(path) == ".git" {
-			return filepath.SkipDir
-		}
-		
+	// Unreadable directories are logged and skipped rather than failing the search
+	_, err := r.walkReadable(func(path string, info os.FileInfo, err error) error {
 		// Check if file is a README
 		fileName := strings.ToLower(info.Name())
 		if !info.IsDir() && (strings.HasPrefix(fileName, "readme") || 
@@ -314,11 +675,134 @@ func (r *Repository) GetReadmeFiles() (map[string]string, error) {
 	return readmeFiles, nil
 }
 
+// CurrentCommit returns the commit hash currently checked out in the local directory
+func (r *Repository) CurrentCommit() (string, error) {
+	if r.VCS == VCSNone {
+		return "", errors.New("directory is not under version control")
+	}
+	if r.VCS == VCSArchive {
+		info, err := readArchiveInfo(r.LocalDir)
+		if err != nil || info.Commit == "" {
+			return "", errors.New("archive does not record its commit")
+		}
+		return info.Commit, nil
+	}
+	cmd := gitCommand("-C", r.LocalDir, "rev-parse", "HEAD")
+	if r.VCS == VCSMercurial {
+		cmd = r.hgCommand(context.Background(), "--repository", r.LocalDir, "log", "--rev", ".", "--template", "{node}")
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD commit: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// CurrentBranch returns the branch checked out in the local directory. A detached HEAD is an error,
+// since no branch is checked out.
+func (r *Repository) CurrentBranch() (string, error) {
+	if r.VCS == VCSNone {
+		return "", errors.New("directory is not under version control")
+	}
+	if r.VCS == VCSArchive {
+		info, err := readArchiveInfo(r.LocalDir)
+		if err != nil || info.Branch == "" {
+			return "", errors.New("archive was not downloaded from a branch")
+		}
+		return info.Branch, nil
+	}
+	cmd := gitCommand("-C", r.LocalDir, "rev-parse", "--abbrev-ref", "HEAD")
+	if r.VCS == VCSMercurial {
+		cmd = r.hgCommand(context.Background(), "--repository", r.LocalDir, "branch")
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve current branch: %w", err)
+	}
+
+	branch := strings.TrimSpace(string(output))
+	if branch == "HEAD" {
+		return "", errors.New("HEAD is detached")
+	}
+	return branch, nil
+}
+
 // GetName returns the name of the repository derived from the local directory
 func (r *Repository) GetName() string {
 	return filepath.Base(r.LocalDir)
 }
 
+// Helper function to create a git command that fails instead of prompting for credentials
+func gitCommand(args ...string) *exec.Cmd {
+	return gitCommandContext(context.Background(), args...)
+}
+
+// remoteCommand creates a git command that may talk to the remote, authenticating with the access token
+// or SSH key and going through the proxy if they are set
+func (r *Repository) remoteCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := gitCommandContext(ctx, append(r.proxyArgs(), args...)...)
+	if r.SSHKeyPath != "" {
+		cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND="+r.sshCommand())
+	}
+	cmd.Env = append(cmd.Env, r.authEnv()...)
+	r.applyProxy(cmd)
+	return cmd
+}
+
+// sshCommand returns the ssh invocation that authenticates with the SSH key.
+// BatchMode makes ssh fail instead of prompting for a passphrase or password.
+func (r *Repository) sshCommand() string {
+	return "ssh -i " + shellQuote(r.SSHKeyPath) + " -o IdentitiesOnly=yes -o BatchMode=yes -o StrictHostKeyChecking=no"
+}
+
+// Helper function to check if a directory holds git or Mercurial metadata
+func isVCSDir(name string) bool {
+	return name == ".git" || name == ".hg"
+}
+
+// Helper function to quote a value for the shell that runs GIT_SSH_COMMAND
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// Helper function to create a git command bound to ctx that fails instead of prompting for credentials
+func gitCommandContext(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	// Killing git leaves helpers such as git-remote-https holding its output pipes,
+	// so stop waiting on them shortly after the context ends
+	cmd.WaitDelay = gitWaitDelay
+	return cmd
+}
+
+// Helper function to reduce a remote URL to host/owner/repo so different spellings compare equal
+func normalizeRemoteURL(url string) string {
+	url = strings.TrimSpace(url)
+	for _, prefix := range []string{"https://", "http://", "ssh://", "git://"} {
+		url = strings.TrimPrefix(url, prefix)
+	}
+	// Drop credentials such as x-access-token:TOKEN@ or git@
+	if at := strings.Index(url, "@"); at >= 0 && at < strings.Index(url+"/", "/") {
+		url = url[at+1:]
+	}
+	url = strings.Replace(url, ":", "/", 1)
+	url = strings.TrimSuffix(strings.TrimSuffix(url, "/"), ".git")
+	return strings.ToLower(url)
+}
+
+// Helper function to check if a ref looks like a full 40-character commit SHA
+func isCommitSHA(ref string) bool {
+	if len(ref) != 40 {
+		return false
+	}
+	for _, c := range ref {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
 // Helper function to check if a directory exists and is not empty
 func dirExists(path string) bool {
 	info, err := os.Stat(path)
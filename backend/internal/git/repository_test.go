@@ -0,0 +1,98 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestFile creates a file under dir, creating its parent directories
+func writeTestFile(t *testing.T, dir, relPath, content string) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetAllMarkdownFilesReadsManyFiles(t *testing.T) {
+	dir := t.TempDir()
+	want := make(map[string]string)
+
+	// Several hundred markdown files spread over nested directories, more than there are read workers
+	for i := 0; i < 400; i++ {
+		ext := ".md"
+		if i%4 == 0 {
+			ext = ".markdown"
+		}
+		if i%10 == 0 {
+			ext = ".MD"
+		}
+		relPath := fmt.Sprintf("docs/section%d/part%d/page%d%s", i%7, i%3, i, ext)
+		content := fmt.Sprintf("# Page %d\n\nContent of page %d.\n", i, i)
+		writeTestFile(t, dir, relPath, content)
+		want[filepath.FromSlash(relPath)] = content
+	}
+	writeTestFile(t, dir, "README.md", "# Project\n")
+	want["README.md"] = "# Project\n"
+
+	// Files that must be left out: other extensions and anything in version control metadata
+	writeTestFile(t, dir, "main.go", "package main\n")
+	writeTestFile(t, dir, "docs/notes.txt", "not markdown\n")
+	writeTestFile(t, dir, "docs/page.md.bak", "backup\n")
+	writeTestFile(t, dir, ".git/description.md", "git metadata\n")
+	writeTestFile(t, dir, "vendor/.hg/store/notes.md", "hg metadata\n")
+	if err := os.MkdirAll(filepath.Join(dir, "directory.md"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A markdown entry that can't be read, even as root
+	if err := os.Symlink(filepath.Join(dir, "missing.md"), filepath.Join(dir, "docs", "broken.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &Repository{LocalDir: dir}
+	files, skipped, err := repo.GetAllMarkdownFiles()
+	if err != nil {
+		t.Fatalf("GetAllMarkdownFiles() error = %v", err)
+	}
+
+	if len(files) != len(want) {
+		t.Errorf("GetAllMarkdownFiles() returned %d files, want %d", len(files), len(want))
+	}
+	for relPath, content := range want {
+		got, ok := files[relPath]
+		if !ok {
+			t.Errorf("missing %s", relPath)
+			continue
+		}
+		if got != content {
+			t.Errorf("content of %s = %q, want %q", relPath, got, content)
+		}
+	}
+	for relPath := range files {
+		if _, ok := want[relPath]; !ok {
+			t.Errorf("unexpected file %s", relPath)
+		}
+	}
+
+	wantSkipped := []string{filepath.Join("docs", "broken.md")}
+	if !reflect.DeepEqual(skipped, wantSkipped) {
+		t.Errorf("skipped = %v, want %v", skipped, wantSkipped)
+	}
+}
+
+func TestGetAllMarkdownFilesWithoutMarkdown(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "main.go", "package main\n")
+
+	repo := &Repository{LocalDir: dir}
+	if _, _, err := repo.GetAllMarkdownFiles(); err == nil {
+		t.Error("GetAllMarkdownFiles() error = nil, want an error when there is no markdown")
+	}
+}
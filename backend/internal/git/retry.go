@@ -0,0 +1,44 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// CloneAttempts is how many times a clone that fails with a network error is attempted in total
+var CloneAttempts = 3
+
+const (
+	// cloneRetryBaseDelay is the wait before the second attempt; it doubles on each retry
+	cloneRetryBaseDelay = 2 * time.Second
+	// cloneRetryMaxDelay caps the wait between attempts
+	cloneRetryMaxDelay = 30 * time.Second
+)
+
+// withCloneRetry runs a clone command up to CloneAttempts times, backing off while it fails with a
+// network error such as an unresolvable host or a dropped connection. Authentication, not-found and
+// other failures are returned at once since another attempt won't fix them. All attempts share ctx,
+// so the clone timeout covers the retries too.
+func (r *Repository) withCloneRetry(ctx context.Context, run func() (string, error)) (string, error) {
+	delay := cloneRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		output, err := run()
+		if err == nil || ctx.Err() != nil || attempt >= CloneAttempts || classifyCloneOutput(output) != CloneErrorNetwork {
+			return output, err
+		}
+
+		log.Printf("Clone of %s failed with a network error (attempt %d/%d), retrying in %s", r.redactToken(r.URL), attempt, CloneAttempts, delay)
+		r.reportProgress(fmt.Sprintf("Network error, retrying in %s (attempt %d of %d)", delay, attempt+1, CloneAttempts))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return output, ctx.Err()
+		case <-timer.C:
+		}
+		delay = min(delay*2, cloneRetryMaxDelay)
+	}
+}
@@ -0,0 +1,134 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// SetFastForward controls whether a clone that reuses an existing checkout first fast-forwards it to
+// the remote branch. Without it the checkout is reused exactly as it is.
+func (r *Repository) SetFastForward(fastForward bool) {
+	r.FastForward = fastForward
+}
+
+// Reused reports whether the last clone found the requested repository already checked out in
+// LocalDir and kept it instead of cloning again
+func (r *Repository) Reused() bool {
+	return r.reused
+}
+
+// reuseExistingClone checks whether LocalDir already holds a checkout of the requested repository on
+// the requested branch or ref, so that retrying a clone succeeds instead of failing on the existing
+// directory. It adopts the checkout's details and fast-forwards it when asked to.
+func (r *Repository) reuseExistingClone(ctx context.Context) (bool, error) {
+	existing, err := OpenRepository(r.LocalDir)
+	if err != nil || !r.sameVCS(existing) || !existing.IsCloneOf(r.URL) || !r.matchesCheckout(ctx, existing) {
+		return false, nil
+	}
+
+	log.Printf("Reusing existing clone of %s at %s", r.redactToken(r.URL), r.LocalDir)
+	r.VCS = existing.VCS
+	r.Branch = existing.Branch
+	r.Commit = existing.Commit
+	r.reused = true
+
+	if r.FastForward {
+		if err := r.fastForward(ctx); err != nil {
+			return true, err
+		}
+		r.Commit, _ = r.CurrentCommit()
+	}
+	return true, nil
+}
+
+// sameVCS reports whether an existing checkout was made with the version control system this clone
+// would use. A git clone may reuse an archive snapshot only when an archive was requested, and the
+// other way around, since archive downloads fall back to cloning.
+func (r *Repository) sameVCS(existing *Repository) bool {
+	vcs := r.VCS
+	if vcs == "" {
+		vcs = VCSGit
+	}
+	return existing.VCS == vcs || r.Archive && existing.VCS == VCSArchive
+}
+
+// matchesCheckout reports whether an existing checkout is on the ref or branch this clone asks for.
+// Clones of main or master fall back to the remote's default branch, so those accept the default branch.
+func (r *Repository) matchesCheckout(ctx context.Context, existing *Repository) bool {
+	if r.Ref != "" {
+		if isCommitSHA(r.Ref) {
+			return strings.EqualFold(existing.Commit, r.Ref)
+		}
+		if existing.Branch == r.Ref {
+			return true
+		}
+		// Tags are checked out on a detached HEAD at the tag's commit
+		switch existing.VCS {
+		case VCSGit:
+			output, err := gitCommandContext(ctx, "-C", r.LocalDir, "rev-parse", "-q", "--verify", "refs/tags/"+r.Ref+"^{commit}").Output()
+			return err == nil && existing.Commit != "" && strings.TrimSpace(string(output)) == existing.Commit
+		case VCSArchive:
+			info, err := readArchiveInfo(r.LocalDir)
+			return err == nil && info.Ref == r.Ref
+		}
+		return false
+	}
+
+	if existing.Branch == r.Branch {
+		return true
+	}
+	switch r.Branch {
+	case "", "main", "master", mercurialDefaultBranch:
+		return existing.isDefaultBranch(ctx)
+	}
+	return false
+}
+
+// isDefaultBranch reports whether the checkout is on its remote's default branch
+func (r *Repository) isDefaultBranch(ctx context.Context) bool {
+	switch r.Branch {
+	case "":
+		return false
+	case "main", "master", mercurialDefaultBranch:
+		return true
+	}
+	if r.VCS != VCSGit {
+		return false
+	}
+	// origin/HEAD records the remote's default branch at clone time
+	output, err := gitCommandContext(ctx, "-C", r.LocalDir, "symbolic-ref", "--short", "refs/remotes/origin/HEAD").Output()
+	return err == nil && strings.TrimSpace(string(output)) == "origin/"+r.Branch
+}
+
+// fastForward brings a reused checkout up to date with its remote without discarding local commits or
+// changes; unlike Update it fails rather than resetting when the branches have diverged. Pinned refs,
+// detached checkouts and archive snapshots are left as they are.
+func (r *Repository) fastForward(ctx context.Context) error {
+	if r.Ref != "" || r.Branch == "" || r.VCS == VCSArchive {
+		return nil
+	}
+	if r.VCS == VCSMercurial {
+		if output, err := r.runRemoteHg(ctx, "--repository", r.LocalDir, "pull", "--update"); err != nil {
+			return fmt.Errorf("hg pull failed: %w - %s", err, r.redactToken(string(output)))
+		}
+		return nil
+	}
+
+	refspec := fmt.Sprintf("+refs/heads/%s:refs/remotes/origin/%s", r.Branch, r.Branch)
+	fetchArgs := []string{"-C", r.LocalDir, "fetch", "origin", refspec}
+	if r.Depth > 0 {
+		fetchArgs = append(fetchArgs, "--depth", strconv.Itoa(r.Depth))
+	}
+	if output, err := r.remoteCommand(ctx, fetchArgs...).CombinedOutput(); err != nil {
+		return fmt.Errorf("git fetch failed: %w - %s", err, r.redactToken(string(output)))
+	}
+
+	cmd := gitCommandContext(ctx, "-C", r.LocalDir, "merge", "--ff-only", "origin/"+r.Branch)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git fast-forward to origin/%s failed: %w - %s", r.Branch, err, string(output))
+	}
+	return nil
+}
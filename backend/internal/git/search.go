@@ -0,0 +1,157 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxSearchFileBytes skips files too large to be hand-written source or configuration
+	maxSearchFileBytes = 1 << 20
+	// maxSearchLineLength truncates matched lines, such as minified bundles, in the results
+	maxSearchLineLength = 300
+)
+
+// SearchOptions controls how SearchContent matches file contents
+type SearchOptions struct {
+	Regex         bool   // Treat the query as a regular expression instead of literal text
+	CaseSensitive bool   // Match case exactly; searches ignore case by default
+	Path          string // Only search below this directory, relative to the repository root
+	MaxResults    int    // Stop after this many matching lines
+}
+
+// SearchMatch is a line that matched a content search
+type SearchMatch struct {
+	Path   string `json:"path"`   // Slash-separated path relative to the repository root
+	Line   int    `json:"line"`   // 1-based line number
+	Column int    `json:"column"` // 1-based byte offset of the match in the line
+	Text   string `json:"text"`   // The matching line, truncated if it is very long
+}
+
+// SearchResult holds the matches of a content search in path order
+type SearchResult struct {
+	Matches       []SearchMatch `json:"matches"`
+	FilesSearched int           `json:"filesSearched"`
+	Truncated     bool          `json:"truncated"`         // MaxResults was reached, so later matches are missing
+	Skipped       []string      `json:"skipped,omitempty"` // Paths that could not be read
+}
+
+// SearchContent searches the text files of the repository for a query, like git grep but also for
+// Mercurial, archive and plain-directory checkouts. Dependency and build directories left out of the
+// directory tree, binary files and files over 1MB are not searched.
+func (r *Repository) SearchContent(ctx context.Context, query string, opts SearchOptions) (*SearchResult, error) {
+	if !dirExists(r.LocalDir) {
+		return nil, errors.New("repository directory does not exist")
+	}
+	if query == "" {
+		return nil, errors.New("search query is empty")
+	}
+
+	pattern := query
+	if !opts.Regex {
+		pattern = regexp.QuoteMeta(query)
+	}
+	if !opts.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %w", err)
+	}
+
+	scope := ""
+	if opts.Path != "" {
+		if _, err := r.ResolvePath(opts.Path); err != nil {
+			return nil, err
+		}
+		scope = filepath.Clean(filepath.FromSlash(opts.Path))
+		if scope == "." {
+			scope = ""
+		}
+	}
+
+	result := &SearchResult{Matches: []SearchMatch{}}
+	errLimitReached := errors.New("search result limit reached")
+	skipped, err := r.walkReadable(func(path string, info os.FileInfo, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		relPath := r.relativePath(path)
+		if info.IsDir() {
+			if path == r.LocalDir {
+				return nil
+			}
+			if treeSkipDirs[info.Name()] || !inSearchScope(relPath, scope) && !inSearchScope(scope, relPath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || info.Size() > maxSearchFileBytes || !inSearchScope(relPath, scope) {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			result.Skipped = r.skipUnreadable(result.Skipped, path, err)
+			return nil
+		}
+		if !utf8.Valid(content) {
+			return nil
+		}
+		result.FilesSearched++
+
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		scanner.Buffer(make([]byte, 0, 4096), maxSearchFileBytes)
+		for lineNumber := 1; scanner.Scan(); lineNumber++ {
+			line := scanner.Text()
+			loc := re.FindStringIndex(line)
+			if loc == nil {
+				continue
+			}
+			if opts.MaxResults > 0 && len(result.Matches) >= opts.MaxResults {
+				result.Truncated = true
+				return errLimitReached
+			}
+			result.Matches = append(result.Matches, SearchMatch{
+				Path:   filepath.ToSlash(relPath),
+				Line:   lineNumber,
+				Column: loc[0] + 1,
+				Text:   truncateSearchLine(line),
+			})
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errLimitReached) {
+		return nil, err
+	}
+
+	result.Skipped = append(skipped, result.Skipped...)
+	return result, nil
+}
+
+// Helper function to check if a relative path is scope itself or below it; everything is in the empty scope
+func inSearchScope(relPath, scope string) bool {
+	return scope == "" || relPath == scope || strings.HasPrefix(relPath, scope+string(filepath.Separator))
+}
+
+// Helper function to shorten a matched line for the results without splitting a UTF-8 character
+func truncateSearchLine(line string) string {
+	line = strings.TrimRight(line, "\r")
+	if len(line) <= maxSearchLineLength {
+		return line
+	}
+	cut := maxSearchLineLength
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut] + "..."
+}
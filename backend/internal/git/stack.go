@@ -0,0 +1,184 @@
+package git
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DetectedTech describes a language and package manager found in a repository
+type DetectedTech struct {
+	Language       string   `json:"language"`
+	PackageManager string   `json:"packageManager"`
+	Lockfiles      []string `json:"lockfiles,omitempty"` // Lockfiles and pinned requirement files found for the language
+	Warning        string   `json:"warning,omitempty"`   // Set when lockfiles from different package managers conflict
+}
+
+// lockfile maps a file that pins dependencies to the package manager that installs from it
+type lockfile struct {
+	name           string
+	packageManager string
+}
+
+// lockfiles are checked in order of preference; the first one found picks the package manager
+var lockfiles = map[string][]lockfile{
+	"JavaScript": {
+		{"pnpm-lock.yaml", "pnpm"},
+		{"yarn.lock", "yarn"},
+		{"bun.lockb", "bun"},
+		{"bun.lock", "bun"},
+		{"package-lock.json", "npm"},
+		{"npm-shrinkwrap.json", "npm"},
+	},
+	"Python": {
+		{"poetry.lock", "poetry"},
+		{"uv.lock", "uv"},
+		{"Pipfile.lock", "pipenv"},
+	},
+}
+
+// competingRequirements aren't lockfiles, so they never pick the package manager, but installing from
+// them alongside another manager's lockfile gives a different environment
+var competingRequirements = map[string][]lockfile{
+	"Python": {{"requirements.txt", "pip"}},
+}
+
+// stackMarker maps a build or manifest file to the technology it implies
+type stackMarker struct {
+	pattern        string
+	language       string
+	packageManager string
+}
+
+// stackMarkers are checked in order; the first marker found for a language wins
+var stackMarkers = []stackMarker{
+	{"package.json", "JavaScript", "npm"},
+	{"go.mod", "Go", "go modules"},
+	{"pyproject.toml", "Python", "pip"},
+	{"Pipfile", "Python", "pipenv"},
+	{"requirements.txt", "Python", "pip"},
+	{"setup.py", "Python", "pip"},
+	{"Cargo.toml", "Rust", "cargo"},
+	{"pom.xml", "Java", "maven"},
+	{"build.gradle", "Java", "gradle"},
+	{"build.gradle.kts", "Kotlin", "gradle"},
+	{"Gemfile", "Ruby", "bundler"},
+	{"composer.json", "PHP", "composer"},
+	{"mix.exs", "Elixir", "mix"},
+	{"pubspec.yaml", "Dart", "pub"},
+	{"*.csproj", "C#", "dotnet"},
+	{"*.sln", "C#", "dotnet"},
+	{"CMakeLists.txt", "C/C++", "cmake"},
+}
+
+// DetectStack inspects well-known manifest files to determine the languages and package managers in use
+func (r *Repository) DetectStack() ([]DetectedTech, error) {
+	if !dirExists(r.LocalDir) {
+		return nil, errors.New("repository directory does not exist")
+	}
+
+	var stack []DetectedTech
+	seen := make(map[string]bool)
+
+	for _, marker := range stackMarkers {
+		if seen[marker.language] {
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(r.LocalDir, marker.pattern))
+		if err != nil || len(matches) == 0 {
+			continue
+		}
+
+		tech := DetectedTech{Language: marker.language, PackageManager: marker.packageManager}
+		r.refineTech(&tech)
+
+		stack = append(stack, tech)
+		seen[marker.language] = true
+	}
+
+	return stack, nil
+}
+
+// refineTech uses lockfiles and config files to narrow down the language and package manager
+func (r *Repository) refineTech(tech *DetectedTech) {
+	language := tech.Language
+	if language == "JavaScript" && fileExists(filepath.Join(r.LocalDir, "tsconfig.json")) {
+		tech.Language = "TypeScript"
+	}
+
+	var found []lockfile
+	for _, lock := range lockfiles[language] {
+		if fileExists(filepath.Join(r.LocalDir, lock.name)) {
+			found = append(found, lock)
+		}
+	}
+	if len(found) == 0 {
+		return
+	}
+	tech.PackageManager = found[0].packageManager
+
+	for _, requirements := range competingRequirements[language] {
+		if fileExists(filepath.Join(r.LocalDir, requirements.name)) {
+			found = append(found, requirements)
+		}
+	}
+
+	managers := make(map[string]bool)
+	for _, lock := range found {
+		tech.Lockfiles = append(tech.Lockfiles, lock.name)
+		managers[lock.packageManager] = true
+	}
+	if len(managers) < 2 {
+		return
+	}
+
+	// The manager package.json declares for Corepack is authoritative when its lockfile is one of them
+	if declared := r.declaredPackageManager(); language == "JavaScript" && managers[declared] {
+		tech.PackageManager = declared
+	}
+	tech.Warning = fmt.Sprintf("Conflicting lockfiles (%s) make the install command ambiguous; using %s. Remove the lockfiles of the other package managers.",
+		strings.Join(tech.Lockfiles, ", "), tech.PackageManager)
+}
+
+// declaredPackageManager returns the package manager named by the "packageManager" field of the root
+// package.json, e.g. "yarn" for "yarn@4.1.0", or "" when there is none
+func (r *Repository) declaredPackageManager() string {
+	content, err := os.ReadFile(filepath.Join(r.LocalDir, "package.json"))
+	if err != nil {
+		return ""
+	}
+
+	var manifest struct {
+		PackageManager string `json:"packageManager"`
+	}
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return ""
+	}
+
+	name, _, _ := strings.Cut(manifest.PackageManager, "@")
+	return name
+}
+
+// GetPackageScripts returns the scripts defined in the root package.json, keyed by script name
+func (r *Repository) GetPackageScripts() (map[string]string, error) {
+	content, err := os.ReadFile(filepath.Join(r.LocalDir, "package.json"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading package.json: %w", err)
+	}
+
+	var manifest struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("malformed package.json: %w", err)
+	}
+
+	if manifest.Scripts == nil {
+		manifest.Scripts = make(map[string]string)
+	}
+	return manifest.Scripts, nil
+}
@@ -0,0 +1,174 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Task runners supported besides Make
+const (
+	TaskRunnerTask = "task" // go-task, configured by a Taskfile
+	TaskRunnerJust = "just" // just, configured by a justfile
+)
+
+// taskfileNames are the Taskfile names go-task looks for, in its order of precedence
+var taskfileNames = []string{"Taskfile.yml", "taskfile.yml", "Taskfile.yaml", "taskfile.yaml", "Taskfile.dist.yml", "taskfile.dist.yml", "Taskfile.dist.yaml", "taskfile.dist.yaml"}
+
+// justfileNames are the justfile names just looks for
+var justfileNames = []string{"justfile", "Justfile", "JUSTFILE", ".justfile"}
+
+// TaskRunner is a task runner configured in the repository root and the tasks it defines
+type TaskRunner struct {
+	Name  string   `json:"name"` // The command that runs the tasks: "task" or "just"
+	File  string   `json:"file"`
+	Tasks []string `json:"tasks"`
+}
+
+// DetectTaskRunners returns the Taskfile and justfile task runners configured in the repository root
+// along with their public task names. Files that can't be parsed are reported as an error after the
+// runners that could be read.
+func (r *Repository) DetectTaskRunners() ([]TaskRunner, error) {
+	var runners []TaskRunner
+	var errs []string
+
+	if name, found := firstExistingFile(r.LocalDir, taskfileNames); found {
+		tasks, err := parseTaskfile(filepath.Join(r.LocalDir, name))
+		if err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			runners = append(runners, TaskRunner{Name: TaskRunnerTask, File: name, Tasks: tasks})
+		}
+	}
+
+	if name, found := firstExistingFile(r.LocalDir, justfileNames); found {
+		tasks, err := parseJustfile(filepath.Join(r.LocalDir, name))
+		if err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			runners = append(runners, TaskRunner{Name: TaskRunnerJust, File: name, Tasks: tasks})
+		}
+	}
+
+	if len(errs) > 0 {
+		return runners, fmt.Errorf("error reading task runner files: %s", strings.Join(errs, "; "))
+	}
+	return runners, nil
+}
+
+// parseTaskfile returns the sorted names of the non-internal tasks in a Taskfile
+func parseTaskfile(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", filepath.Base(path), err)
+	}
+
+	var taskfile struct {
+		Tasks map[string]yaml.Node `yaml:"tasks"`
+	}
+	if err := yaml.Unmarshal(content, &taskfile); err != nil {
+		return nil, fmt.Errorf("malformed %s: %w", filepath.Base(path), err)
+	}
+
+	tasks := make([]string, 0, len(taskfile.Tasks))
+	for name, node := range taskfile.Tasks {
+		// A task can be a full definition, a single command string or a list of commands
+		var spec struct {
+			Internal bool `yaml:"internal"`
+		}
+		if node.Kind == yaml.MappingNode {
+			if err := node.Decode(&spec); err != nil {
+				return nil, fmt.Errorf("malformed task %q in %s: %w", name, filepath.Base(path), err)
+			}
+		}
+		if !spec.Internal {
+			tasks = append(tasks, name)
+		}
+	}
+
+	sort.Strings(tasks)
+	return tasks, nil
+}
+
+// justRecipePattern matches a recipe header such as "build target='debug': deps", capturing the name.
+// Parameters may have defaults; the character after the colon rules out assignments ("name := value").
+var justRecipePattern = regexp.MustCompile(`^@?([A-Za-z_][A-Za-z0-9_-]*)[^:]*:([^=]|$)`)
+
+// justKeywords start justfile lines that look like recipes but are settings, aliases or assignments
+var justKeywords = []string{"set", "alias", "export", "import", "mod"}
+
+// parseJustfile returns the sorted names of the public recipes in a justfile. Recipes whose name starts
+// with an underscore or that carry a [private] attribute are left out, as with "just --list".
+func parseJustfile(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", filepath.Base(path), err)
+	}
+
+	var recipes []string
+	private := false
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Recipe bodies and blank lines are indented or empty; comments are skipped
+		if line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if strings.Contains(line, "private") {
+				private = true
+			}
+			continue
+		}
+		if isJustKeywordLine(line) {
+			private = false
+			continue
+		}
+
+		if match := justRecipePattern.FindStringSubmatch(line); match != nil {
+			name := match[1]
+			if !private && !strings.HasPrefix(name, "_") {
+				recipes = append(recipes, name)
+			}
+		}
+		private = false
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", filepath.Base(path), err)
+	}
+
+	sort.Strings(recipes)
+	return recipes, nil
+}
+
+// isJustKeywordLine reports whether a justfile line starts with a keyword rather than a recipe name
+func isJustKeywordLine(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return false
+	}
+	for _, keyword := range justKeywords {
+		if fields[0] == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function to find the first of names that exists as a file in dir
+func firstExistingFile(dir string, names []string) (string, bool) {
+	for _, name := range names {
+		if fileExists(filepath.Join(dir, name)) {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,108 @@
+package git
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DirectoryNode is a file or directory in a repository's directory tree
+type DirectoryNode struct {
+	Name       string           `json:"name"`
+	Path       string           `json:"path"` // Slash-separated path relative to the repository root
+	IsDir      bool             `json:"isDir"`
+	Unreadable bool             `json:"unreadable,omitempty"` // The directory could not be listed, so its children are missing
+	Children   []*DirectoryNode `json:"children,omitempty"`
+}
+
+// treeSkipDirs are large directories that add noise without helping anyone understand the project
+var treeSkipDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	"dist":         true,
+	"build":        true,
+	".git":         true,
+	".hg":          true,
+}
+
+// GetDirectoryTree returns the repository's directory tree down to maxDepth levels. Hidden files and
+// common dependency or build directories are left out. Directories are listed before files, each sorted by name.
+func (r *Repository) GetDirectoryTree(maxDepth int) (*DirectoryNode, error) {
+	if !dirExists(r.LocalDir) {
+		return nil, errors.New("repository directory does not exist")
+	}
+
+	root := &DirectoryNode{Name: filepath.Base(r.LocalDir), IsDir: true}
+	if err := r.walkDirectoryTree(root, 0, maxDepth); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// walkDirectoryTree fills in the children of node, recursing until maxDepth
+func (r *Repository) walkDirectoryTree(node *DirectoryNode, depth, maxDepth int) error {
+	if depth >= maxDepth {
+		return nil
+	}
+
+	entries, err := os.ReadDir(filepath.Join(r.LocalDir, filepath.FromSlash(node.Path)))
+	if err != nil {
+		if node.Path == "" {
+			return err
+		}
+		// One unreadable subdirectory shouldn't hide the rest of the tree
+		log.Printf("Skipping unreadable directory %s: %v", node.Path, err)
+		node.Unreadable = true
+		return nil
+	}
+
+	// Sort files and directories to make output consistent
+	sort.Slice(entries, func(i, j int) bool {
+		// Directories come first, then files
+		if entries[i].IsDir() != entries[j].IsDir() {
+			return entries[i].IsDir()
+		}
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	for _, entry := range entries {
+		if skipInDirectoryTree(entry.Name()) {
+			continue
+		}
+
+		child := &DirectoryNode{
+			Name:  entry.Name(),
+			Path:  strings.TrimPrefix(node.Path+"/"+entry.Name(), "/"),
+			IsDir: entry.IsDir(),
+		}
+		if child.IsDir {
+			if err := r.walkDirectoryTree(child, depth+1, maxDepth); err != nil {
+				return err
+			}
+		}
+		node.Children = append(node.Children, child)
+	}
+
+	return nil
+}
+
+// UnreadablePaths returns the paths of the directories below node that could not be listed
+func (n *DirectoryNode) UnreadablePaths() []string {
+	var paths []string
+	if n.Unreadable {
+		paths = append(paths, n.Path)
+	}
+	for _, child := range n.Children {
+		paths = append(paths, child.UnreadablePaths()...)
+	}
+	return paths
+}
+
+// Helper function to check if a file or directory should be left out of the directory tree
+func skipInDirectoryTree(name string) bool {
+	// Skip hidden files and common directories to avoid noise
+	return strings.HasPrefix(name, ".") || treeSkipDirs[name]
+}
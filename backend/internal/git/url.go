@@ -0,0 +1,114 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// knownGitHosts are hosting services whose shorthand and SSH URLs are rewritten to HTTPS
+var knownGitHosts = []string{"github.com", "gitlab.com", "bitbucket.org"}
+
+// NormalizeGitURL turns the URL forms accepted by the API into a URL git can clone:
+//   - owner/repo is treated as a GitHub repository
+//   - github.com/owner/repo, gitlab.com/group/repo and bitbucket.org/owner/repo get an https:// prefix
+//   - git@<known host>:owner/repo is rewritten to HTTPS so public repositories clone without SSH keys
+//
+// Other http(s), ssh, git and git@ URLs are returned unchanged.
+func NormalizeGitURL(raw string) (string, error) {
+	url := strings.TrimSpace(raw)
+	if url == "" {
+		return "", errors.New("git URL is empty")
+	}
+
+	// Fully qualified URLs are passed through as-is
+	for _, scheme := range []string{"https://", "http://", "ssh://", "git://"} {
+		if strings.HasPrefix(url, scheme) {
+			return url, nil
+		}
+	}
+
+	// SCP-style SSH URLs: rewrite known hosts, leave self-hosted servers alone
+	if strings.HasPrefix(url, "git@") {
+		hostAndPath := strings.TrimPrefix(url, "git@")
+		host, path, found := strings.Cut(hostAndPath, ":")
+		if !found || host == "" || !hasRepoPath(path) {
+			return "", fmt.Errorf("invalid SSH git URL: %s", raw)
+		}
+		if isKnownGitHost(host) {
+			return "https://" + host + "/" + path, nil
+		}
+		return url, nil
+	}
+
+	// host/owner/repo shorthand for known hosts
+	if host, path, found := strings.Cut(url, "/"); found && isKnownGitHost(host) {
+		if !hasRepoPath(path) {
+			return "", fmt.Errorf("invalid %s repository URL: %s", host, raw)
+		}
+		return "https://" + host + "/" + path, nil
+	}
+
+	// owner/repo shorthand defaults to GitHub
+	if strings.Count(url, "/") == 1 && hasRepoPath(url) && !strings.Contains(url, ":") {
+		return "https://github.com/" + url, nil
+	}
+
+	return "", fmt.Errorf("unsupported git URL: %s", raw)
+}
+
+// NormalizeSSHGitURL turns the URL forms accepted by NormalizeGitURL into an SSH URL, for clones
+// authenticated with an SSH key. git@ and ssh:// URLs are returned unchanged; HTTPS URLs and
+// shorthands become git@host:owner/repo.git.
+func NormalizeSSHGitURL(raw string) (string, error) {
+	url := strings.TrimSpace(raw)
+	if strings.HasPrefix(url, "git@") || strings.HasPrefix(url, "ssh://") {
+		return url, nil
+	}
+
+	normalized, err := NormalizeGitURL(url)
+	if err != nil {
+		return "", err
+	}
+
+	for _, scheme := range []string{"https://", "http://"} {
+		if hostAndPath, found := strings.CutPrefix(normalized, scheme); found {
+			host, path, _ := strings.Cut(hostAndPath, "/")
+			// Credentials have no meaning over SSH
+			if at := strings.LastIndex(host, "@"); at >= 0 {
+				host = host[at+1:]
+			}
+			if !hasRepoPath(path) {
+				return "", fmt.Errorf("invalid repository URL for SSH: %s", raw)
+			}
+			return "git@" + host + ":" + strings.TrimSuffix(strings.Trim(path, "/"), ".git") + ".git", nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot clone %s over SSH", raw)
+}
+
+// Helper function to check whether a host is one of the known hosting services
+func isKnownGitHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, known := range knownGitHosts {
+		if host == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function to check that a path has at least an owner and a repository segment
+func hasRepoPath(path string) bool {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) < 2 {
+		return false
+	}
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
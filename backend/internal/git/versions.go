@@ -0,0 +1,104 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RuntimeVersion is a language runtime version pinned by a file in the repository
+type RuntimeVersion struct {
+	Name    string `json:"name"` // Display name such as "Node.js"
+	Version string `json:"version"`
+	Source  string `json:"source"` // File the version was read from
+}
+
+// asdfToolNames maps asdf plugin names in .tool-versions to display names
+var asdfToolNames = map[string]string{
+	"nodejs": "Node.js",
+	"python": "Python",
+	"golang": "Go",
+	"ruby":   "Ruby",
+	"java":   "Java",
+	"rust":   "Rust",
+	"elixir": "Elixir",
+	"erlang": "Erlang",
+	"php":    "PHP",
+	"deno":   "Deno",
+	"bun":    "Bun",
+	"dotnet": ".NET",
+}
+
+// DetectRuntimeVersions reads .tool-versions, .nvmrc, .python-version and the go directive in go.mod
+// to find the runtime versions the project expects. When several files pin the same runtime,
+// .tool-versions wins, followed by the runtime-specific file.
+func (r *Repository) DetectRuntimeVersions() ([]RuntimeVersion, error) {
+	if !dirExists(r.LocalDir) {
+		return nil, errors.New("repository directory does not exist")
+	}
+
+	var versions []RuntimeVersion
+	seen := make(map[string]bool)
+	add := func(name, version, source string) {
+		if name == "" || version == "" || seen[name] {
+			return
+		}
+		versions = append(versions, RuntimeVersion{Name: name, Version: version, Source: source})
+		seen[name] = true
+	}
+
+	// .tool-versions lines look like "nodejs 18.17.0"; any further versions are fallbacks
+	for _, line := range r.readVersionFileLines(".tool-versions") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		name, ok := asdfToolNames[fields[0]]
+		if !ok {
+			name = fields[0]
+		}
+		add(name, fields[1], ".tool-versions")
+	}
+
+	if lines := r.readVersionFileLines(".nvmrc"); len(lines) > 0 {
+		add("Node.js", strings.TrimPrefix(lines[0], "v"), ".nvmrc")
+	}
+
+	if lines := r.readVersionFileLines(".python-version"); len(lines) > 0 {
+		add("Python", lines[0], ".python-version")
+	}
+
+	for _, line := range r.readVersionFileLines("go.mod") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "go" {
+			add("Go", fields[1], "go.mod")
+			break
+		}
+	}
+
+	return versions, nil
+}
+
+// readVersionFileLines returns the trimmed, non-empty lines of a file in the repository root with
+// comments removed. A missing or unreadable file yields no lines.
+func (r *Repository) readVersionFileLines(name string) []string {
+	content, err := os.ReadFile(filepath.Join(r.LocalDir, name))
+	if err != nil {
+		return nil
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,90 @@
+package git
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// walkReadable walks the repository like filepath.Walk, but logs and skips entries that can't be read
+// instead of aborting, so one permission-denied directory doesn't fail the whole walk. It returns the
+// skipped paths relative to the repository root. Only a failure to read the root itself is an error.
+func (r *Repository) walkReadable(walkFn filepath.WalkFunc) ([]string, error) {
+	var skipped []string
+	err := filepath.Walk(r.LocalDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == r.LocalDir {
+				return err
+			}
+			skipped = r.skipUnreadable(skipped, path, err)
+			// Returning nil skips the contents of a directory that could not be listed
+			return nil
+		}
+
+		// Skip .git and .hg directories
+		if info.IsDir() && isVCSDir(info.Name()) {
+			return filepath.SkipDir
+		}
+		// The archive marker is bookkeeping, not repository content
+		if path == filepath.Join(r.LocalDir, archiveMarkerFile) {
+			return nil
+		}
+		return walkFn(path, info, nil)
+	})
+	return skipped, err
+}
+
+// readFiles reads the files at paths using up to workers goroutines and returns their contents keyed by
+// path relative to the repository root, along with the sorted relative paths that could not be read
+func (r *Repository) readFiles(paths []string, workers int) (map[string]string, []string) {
+	contents := make(map[string]string, len(paths))
+	var unreadable []string
+	var mutex sync.Mutex
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < min(workers, len(paths)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				content, err := os.ReadFile(path)
+
+				mutex.Lock()
+				if err != nil {
+					unreadable = r.skipUnreadable(unreadable, path, err)
+				} else {
+					contents[r.relativePath(path)] = string(content)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, path := range paths {
+		jobs <- path
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Workers finish in any order, so sort for stable warnings
+	sort.Strings(unreadable)
+	return contents, unreadable
+}
+
+// skipUnreadable logs that path could not be read and adds it to skipped
+func (r *Repository) skipUnreadable(skipped []string, path string, err error) []string {
+	log.Printf("Skipping unreadable path %s: %v", path, err)
+	return append(skipped, r.relativePath(path))
+}
+
+// relativePath returns path relative to the repository root, falling back to path itself
+func (r *Repository) relativePath(path string) string {
+	relPath, err := filepath.Rel(r.LocalDir, path)
+	if err != nil {
+		return path
+	}
+	return relPath
+}
@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is a log severity; messages below the configured level are dropped
+type Level int32
+
+// Log levels, from most to least verbose
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// levelNames maps LOG_LEVEL values to levels
+var levelNames = map[string]Level{
+	"debug":   LevelDebug,
+	"info":    LevelInfo,
+	"warn":    LevelWarn,
+	"warning": LevelWarn,
+	"error":   LevelError,
+}
+
+// currentLevel is the minimum level that is logged; info by default
+var currentLevel atomic.Int32
+
+func init() {
+	currentLevel.Store(int32(LevelInfo))
+}
+
+// ParseLevel parses a level name: debug, info, warn or error
+func ParseLevel(name string) (Level, error) {
+	level, ok := levelNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return LevelInfo, fmt.Errorf("unknown log level %q (use debug, info, warn or error)", name)
+	}
+	return level, nil
+}
+
+// SetLevel sets the minimum level that is logged
+func SetLevel(level Level) {
+	currentLevel.Store(int32(level))
+}
+
+// Enabled reports whether messages at level are logged, so callers can skip building expensive ones
+func Enabled(level Level) bool {
+	return level >= Level(currentLevel.Load())
+}
+
+// Debugf logs verbose details such as command output, only when the level is debug
+func Debugf(format string, args ...interface{}) {
+	logf(LevelDebug, format, args...)
+}
+
+// Infof logs routine events
+func Infof(format string, args ...interface{}) {
+	logf(LevelInfo, format, args...)
+}
+
+// Warnf logs problems the server recovers from
+func Warnf(format string, args ...interface{}) {
+	logf(LevelWarn, format, args...)
+}
+
+// Errorf logs failures
+func Errorf(format string, args ...interface{}) {
+	logf(LevelError, format, args...)
+}
+
+// Helper function to log a message when its level is enabled
+func logf(level Level, format string, args ...interface{}) {
+	if Enabled(level) {
+		log.Printf(format, args...)
+	}
+}
+
+// redacted replaces masked values
+const redacted = "***"
+
+// secretPatterns match values that look like credentials, with the replacement that masks them while
+// keeping context such as the variable or flag name
+var secretPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// user:password@ in URLs, including x-access-token:TOKEN@
+	{regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+@`), "${1}" + redacted + "@"},
+	// NAME=value and NAME: value where the name mentions a secret, e.g. API_KEY=... or --password=...
+	{regexp.MustCompile(`(?i)((?:^|[\s"'])[\w.-]*(?:token|secret|passw(?:or)?d|api[_-]?key|access[_-]?key|private[_-]?key|credential)[\w.-]*\s*[=:]\s*)(?:"[^"]*"|'[^']*'|\S+)`), "${1}" + redacted},
+	// --password value style flags followed by a separate value
+	{regexp.MustCompile(`(?i)(--?(?:token|secret|password|passwd|api-key|apikey|access-key)\s+)\S+`), "${1}" + redacted},
+	// Authorization header values
+	{regexp.MustCompile(`(?i)((?:bearer|basic|token)\s+)[A-Za-z0-9._~+/=-]{8,}`), "${1}" + redacted},
+	// Well-known token formats: GitHub, GitLab, Slack, OpenAI/Anthropic and AWS access key IDs
+	{regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,}|glpat-[A-Za-z0-9_-]{20,}|xox[abprs]-[A-Za-z0-9-]{10,}|sk-[A-Za-z0-9_-]{20,}|AKIA[0-9A-Z]{16})\b`), redacted},
+}
+
+// RedactSecrets masks values that look like tokens, keys or passwords, so commands can be logged safely
+func RedactSecrets(text string) string {
+	for _, secret := range secretPatterns {
+		text = secret.pattern.ReplaceAllString(text, secret.replacement)
+	}
+	return text
+}
@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Labels used for command exit-code classes
+const (
+	ExitSuccess   = "success"   // Exited with code 0
+	ExitFailure   = "failure"   // Exited with a non-zero code
+	ExitTimeout   = "timeout"   // Killed after running too long
+	ExitCancelled = "cancelled" // Stopped by a user
+	ExitError     = "error"     // Could not be run at all
+)
+
+// Labels used for operation results
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultCached  = "cached"
+)
+
+// CounterVec is a counter partitioned by a single label
+type CounterVec struct {
+	name   string
+	help   string
+	label  string
+	mutex  sync.Mutex
+	values map[string]float64
+}
+
+// Inc increments the counter for labelValue
+func (c *CounterVec) Inc(labelValue string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.values[labelValue]++
+}
+
+// SummaryVec tracks the count and total of observed durations, partitioned by a single label
+type SummaryVec struct {
+	name   string
+	help   string
+	label  string
+	mutex  sync.Mutex
+	counts map[string]float64
+	sums   map[string]float64
+}
+
+// Observe records a duration in seconds for labelValue
+func (s *SummaryVec) Observe(labelValue string, d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.counts[labelValue]++
+	s.sums[labelValue] += d.Seconds()
+}
+
+// gaugeFunc is a gauge whose values are read when metrics are scraped
+type gaugeFunc struct {
+	name   string
+	help   string
+	label  string
+	values func() map[string]float64
+}
+
+var (
+	// Clones counts repository clones by result
+	Clones = newCounterVec("startit_clones_total", "Repository clones by result.", "result")
+	// Analyses counts repository analyses by result, with cache hits counted separately
+	Analyses = newCounterVec("startit_analyses_total", "Repository analyses by result.", "result")
+	// CommandExecutions counts foreground and background command executions by exit-code class
+	CommandExecutions = newCounterVec("startit_command_executions_total", "Command executions by exit-code class.", "exit_class")
+	// AIRequests counts requests to the AI provider's API by provider
+	AIRequests = newCounterVec("startit_ai_requests_total", "AI provider API requests by provider.", "provider")
+	// AIRequestFailures counts failed requests to the AI provider's API by provider
+	AIRequestFailures = newCounterVec("startit_ai_request_failures_total", "Failed AI provider API requests by provider.", "provider")
+	// AIRequestDuration tracks how long AI provider API requests take by provider
+	AIRequestDuration = &SummaryVec{
+		name:   "startit_ai_request_duration_seconds",
+		help:   "Latency of AI provider API requests by provider.",
+		label:  "provider",
+		counts: make(map[string]float64),
+		sums:   make(map[string]float64),
+	}
+
+	counters = []*CounterVec{Clones, Analyses, CommandExecutions, AIRequests, AIRequestFailures}
+
+	gaugesMutex sync.Mutex
+	gauges      []gaugeFunc
+)
+
+// newCounterVec creates a counter partitioned by label
+func newCounterVec(name, help, label string) *CounterVec {
+	return &CounterVec{name: name, help: help, label: label, values: make(map[string]float64)}
+}
+
+// RegisterGaugeFunc adds a gauge whose values, keyed by label value, are computed on each scrape
+func RegisterGaugeFunc(name, help, label string, values func() map[string]float64) {
+	gaugesMutex.Lock()
+	defer gaugesMutex.Unlock()
+	gauges = append(gauges, gaugeFunc{name: name, help: help, label: label, values: values})
+}
+
+// ObserveAIRequest records one AI provider API request and how long it took
+func ObserveAIRequest(provider string, d time.Duration, err error) {
+	AIRequests.Inc(provider)
+	if err != nil {
+		AIRequestFailures.Inc(provider)
+	}
+	AIRequestDuration.Observe(provider, d)
+}
+
+// ExitClass returns the exit-code class for a command that finished with exitCode, or failed to run with err
+func ExitClass(exitCode int, err error) string {
+	switch {
+	case err != nil:
+		return ExitError
+	case exitCode == 0:
+		return ExitSuccess
+	default:
+		return ExitFailure
+	}
+}
+
+// WritePrometheus writes every metric in the Prometheus text exposition format
+func WritePrometheus(w io.Writer) {
+	for _, counter := range counters {
+		counter.mutex.Lock()
+		writeFamily(w, counter.name, counter.help, "counter", counter.label, counter.values)
+		counter.mutex.Unlock()
+	}
+
+	s := AIRequestDuration
+	s.mutex.Lock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s summary\n", s.name, s.help, s.name)
+	for _, value := range sortedKeys(s.counts) {
+		labels := fmt.Sprintf("{%s=\"%s\"}", s.label, escapeLabelValue(value))
+		fmt.Fprintf(w, "%s_sum%s %g\n%s_count%s %g\n", s.name, labels, s.sums[value], s.name, labels, s.counts[value])
+	}
+	s.mutex.Unlock()
+
+	gaugesMutex.Lock()
+	registered := append([]gaugeFunc(nil), gauges...)
+	gaugesMutex.Unlock()
+	for _, gauge := range registered {
+		writeFamily(w, gauge.name, gauge.help, "gauge", gauge.label, gauge.values())
+	}
+}
+
+// writeFamily writes one metric family with a sample per label value, sorted for stable output
+func writeFamily(w io.Writer, name, help, kind, label string, values map[string]float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	for _, value := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %g\n", name, label, escapeLabelValue(value), values[value])
+	}
+}
+
+// Helper function returning a map's keys in sorted order
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Helper function to escape a label value for the text format
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -100,7 +100,10 @@ class RepositoryProvider with ChangeNotifier {
         
         _description = data['description'] ?? '';
         _setupSteps = List<String>.from(data['setupSteps'] ?? []);
-        _commands = List<String>.from(data['commands'] ?? []);
+        // Commands are objects with the command line and the directory to run it in
+        _commands = (data['commands'] as List? ?? [])
+            .map((command) => command is Map ? command['cmd'] as String : command as String)
+            .toList();
         
         // Parse prerequisites from the API response
         if (data['prerequisites'] != null) {